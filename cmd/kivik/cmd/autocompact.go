@@ -0,0 +1,405 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+	"github.com/go-kivik/kivik/v4/couchdb/chttp"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type autocompact struct {
+	*root
+	threshold    float64
+	concurrency  int
+	views        bool
+	dryRun       bool
+	pollInterval string
+	until        string
+
+	parsedPollInterval time.Duration
+}
+
+func autocompactCmd(r *root) *cobra.Command {
+	c := &autocompact{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:   "autocompact [dsn]/[database] [database...]",
+		Short: "Compact fragmented databases and views",
+		Long: `Compact the databases and view indexes whose fragmentation ratio is at least --threshold, and wait for compaction to finish.
+
+Databases are selected as for 'describe dbs': named in the DSN and as additional arguments, optionally with shell-style wildcards, or all databases if none are named. The fragmentation ratio of each database, and of each of its view indexes, is compared to --threshold.
+
+At most --concurrency compactions run at once. The progress of each is tracked with /_active_tasks, and the space reclaimed is reported once all have finished.
+
+With --until, no compaction is started after the given time, given as a time of day (06:00), an RFC 3339 timestamp, or a duration from now (2h). Compactions already running are allowed to finish.
+
+To trigger compaction of a single database without waiting, use 'compact'.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.Float64Var(&c.threshold, "threshold", 0.3, "Minimum fragmentation ratio, between 0 and 1, at which to compact") // nolint:gomnd
+	pf.IntVar(&c.concurrency, "concurrency", 1, "Maximum number of compactions to run at once")
+	pf.BoolVar(&c.views, "views", true, "Also compact fragmented view indexes")
+	pf.BoolVar(&c.dryRun, "dry-run", false, "Show what would be compacted, without compacting")
+	pf.StringVar(&c.pollInterval, "poll-interval", "5s", "Interval between checks of /_active_tasks")
+	pf.StringVar(&c.until, "until", "", "Don't start compactions after this time")
+
+	return cmd
+}
+
+// compactJob is the compaction of a database, or of a design document's view
+// indexes.
+type compactJob struct {
+	DB            string  `json:"db_name"`
+	DesignDoc     string  `json:"design_doc,omitempty"`
+	Fragmentation float64 `json:"fragmentation"`
+	Before        int64   `json:"before"`
+	After         int64   `json:"after,omitempty"`
+	Reclaimed     int64   `json:"reclaimed,omitempty"`
+	Status        string  `json:"status"`
+	Reason        string  `json:"reason,omitempty"`
+
+	code int
+}
+
+func (j *compactJob) String() string {
+	if j.DesignDoc == "" {
+		return j.DB
+	}
+	return j.DB + "/_design/" + j.DesignDoc
+}
+
+func (j *compactJob) fail(err error) {
+	j.Status = "failed"
+	j.Reason = err.Error()
+	j.code = errors.InspectErrorCode(err)
+}
+
+// viewIndexInfo is the subset of /{db}/_design/{ddoc}/_info used to select
+// view indexes for compaction.
+type viewIndexInfo struct {
+	Name      string `json:"name"`
+	ViewIndex struct {
+		CompactRunning bool    `json:"compact_running"`
+		Sizes          dbSizes `json:"sizes"`
+	} `json:"view_index"`
+}
+
+func (c *autocompact) RunE(cmd *cobra.Command, args []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	patterns, err := c.dbPatterns(args)
+	if err != nil {
+		return err
+	}
+	if c.threshold < 0 || c.threshold >= 1 {
+		return errors.Code(errors.ErrUsage, "--threshold must be between 0 and 1")
+	}
+	if c.concurrency <= 0 {
+		return errors.Code(errors.ErrUsage, "concurrency must be positive")
+	}
+	if c.parsedPollInterval, err = parseDuration(c.pollInterval); err != nil {
+		return err
+	}
+	deadline, err := parseUntil(c.until, c.now())
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+
+	var jobs []*compactJob
+	err = c.retry(func() error {
+		var err error
+		jobs, err = c.candidates(ctx, client, patterns)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.dryRun {
+		for _, job := range jobs {
+			job.Status = "pending"
+		}
+		return c.output(jobs)
+	}
+
+	sem := make(chan struct{}, c.concurrency)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		sem <- struct{}{}
+		if !deadline.IsZero() && !c.now().Before(deadline) {
+			<-sem
+			c.log.Debugf("[autocompact] Skipping %s: past %s", job, deadline.Format(time.RFC3339))
+			job.Status = "skipped"
+			continue
+		}
+		wg.Add(1)
+		go func(job *compactJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			c.compactOne(ctx, client, job)
+		}(job)
+	}
+	wg.Wait()
+
+	if err := c.output(jobs); err != nil {
+		return err
+	}
+	var failed, code int
+	for _, job := range jobs {
+		if job.Status == "failed" {
+			failed++
+			if code == 0 {
+				code = job.code
+			}
+		}
+	}
+	if failed > 0 {
+		if code == 0 {
+			code = errors.ErrUnknown
+		}
+		return errors.Codef(code, "%d of %d compactions failed", failed, len(jobs))
+	}
+	return nil
+}
+
+// candidates returns a job for each database and design document with a
+// fragmentation ratio of at least the threshold.
+func (c *autocompact) candidates(ctx context.Context, client *kivik.Client, patterns []string) ([]*compactJob, error) {
+	dbs, err := c.selectDBs(ctx, client, patterns)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := c.dbsInfo(ctx, client, dbs, defaultDBsInfoBatch)
+	if err != nil {
+		return nil, err
+	}
+	couch, err := c.couch()
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*compactJob
+	for _, info := range infos {
+		switch {
+		case info.CompactRunning:
+			c.log.Debugf("[autocompact] Skipping %s: compaction already running", info.Name)
+		case info.Sizes.File > 0 && info.Fragmentation >= c.threshold:
+			jobs = append(jobs, &compactJob{
+				DB:            info.Name,
+				Fragmentation: info.Fragmentation,
+				Before:        info.Sizes.File,
+			})
+		}
+		if !c.views {
+			continue
+		}
+		ddocs, err := designDocs(ctx, client.DB(info.Name))
+		if err != nil {
+			return nil, err
+		}
+		for _, ddoc := range ddocs {
+			view, err := viewInfo(ctx, couch, info.Name, ddoc)
+			if err != nil {
+				return nil, err
+			}
+			sizes := view.ViewIndex.Sizes
+			switch {
+			case view.ViewIndex.CompactRunning:
+				c.log.Debugf("[autocompact] Skipping %s/_design/%s: compaction already running", info.Name, ddoc)
+			case sizes.File > 0 && sizes.fragmentation() >= c.threshold:
+				jobs = append(jobs, &compactJob{
+					DB:            info.Name,
+					DesignDoc:     ddoc,
+					Fragmentation: sizes.fragmentation(),
+					Before:        sizes.File,
+				})
+			}
+		}
+	}
+	return jobs, nil
+}
+
+// designDocs returns the names of the design documents in db, without the
+// _design/ prefix.
+func designDocs(ctx context.Context, db *kivik.DB) ([]string, error) {
+	rs := db.DesignDocs(ctx)
+	defer rs.Close() // nolint:errcheck
+	var ddocs []string
+	for rs.Next() {
+		id, err := rs.ID()
+		if err != nil {
+			return nil, err
+		}
+		ddocs = append(ddocs, strings.TrimPrefix(id, "_design/"))
+	}
+	return ddocs, rs.Err()
+}
+
+func viewInfo(ctx context.Context, couch *chttp.Client, db, ddoc string) (*viewIndexInfo, error) {
+	var info viewIndexInfo
+	err := couch.DoJSON(ctx, http.MethodGet, "/"+url.PathEscape(db)+"/_design/"+url.PathEscape(ddoc)+"/_info", nil, &info)
+	return &info, err
+}
+
+// compactOne compacts a single database or design document, waits for
+// compaction to finish, and records the space reclaimed.
+func (c *autocompact) compactOne(ctx context.Context, client *kivik.Client, job *compactJob) {
+	c.log.Debugf("[autocompact] Will compact: %s/%s", client.DSN(), job)
+	err := c.retry(func() error {
+		if job.DesignDoc == "" {
+			return client.DB(job.DB).Compact(ctx)
+		}
+		return client.DB(job.DB).CompactView(ctx, job.DesignDoc)
+	})
+	if err != nil {
+		job.fail(err)
+		return
+	}
+	if err := c.wait(ctx, job); err != nil {
+		job.fail(err)
+		return
+	}
+	var after int64
+	err = c.retry(func() error {
+		var err error
+		after, err = c.fileSize(ctx, client, job)
+		return err
+	})
+	if err != nil {
+		job.fail(err)
+		return
+	}
+	job.After = after
+	if reclaimed := job.Before - after; reclaimed > 0 {
+		job.Reclaimed = reclaimed
+	}
+	job.Status = "compacted"
+}
+
+// wait polls /_active_tasks until job's compaction task no longer appears.
+// As the task may not appear immediately, the first check is delayed by the
+// poll interval.
+func (c *autocompact) wait(ctx context.Context, job *compactJob) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.parsedPollInterval):
+	}
+	filter := taskFilter{typ: "database_compaction", db: job.DB}
+	if job.DesignDoc != "" {
+		filter = taskFilter{typ: "view_compaction", db: job.DB, ddoc: job.DesignDoc}
+	}
+	return c.waitTasks(ctx, filter, c.parsedPollInterval)
+}
+
+func (c *autocompact) fileSize(ctx context.Context, client *kivik.Client, job *compactJob) (int64, error) {
+	if job.DesignDoc == "" {
+		infos, err := c.dbsInfo(ctx, client, []string{job.DB}, 1)
+		if err != nil {
+			return 0, err
+		}
+		return infos[0].Sizes.File, nil
+	}
+	couch, err := c.couch()
+	if err != nil {
+		return 0, err
+	}
+	info, err := viewInfo(ctx, couch, job.DB, job.DesignDoc)
+	if err != nil {
+		return 0, err
+	}
+	return info.ViewIndex.Sizes.File, nil
+}
+
+func (c *autocompact) output(jobs []*compactJob) error {
+	var total int64
+	rows := make([][]string, 0, len(jobs)+1)
+	for _, job := range jobs {
+		ddoc, after, reclaimed := "-", "-", "-"
+		if job.DesignDoc != "" {
+			ddoc = job.DesignDoc
+		}
+		if job.Status == "compacted" {
+			after, reclaimed = formatBytes(float64(job.After)), formatBytes(float64(job.Reclaimed))
+		}
+		status := job.Status
+		if job.Reason != "" {
+			status += ": " + job.Reason
+		}
+		total += job.Reclaimed
+		rows = append(rows, []string{
+			job.DB,
+			ddoc,
+			fmt.Sprintf("%.2f", job.Fragmentation),
+			formatBytes(float64(job.Before)),
+			after,
+			reclaimed,
+			status,
+		})
+	}
+	if !c.dryRun {
+		rows = append(rows, []string{"TOTAL", "", "", "", "", formatBytes(float64(total))})
+	}
+	result := map[string]interface{}{
+		"jobs":      jobs,
+		"reclaimed": total,
+	}
+	header := []string{"DATABASE", "DESIGN DOC", "FRAGMENTATION", "BEFORE", "AFTER", "RECLAIMED", "STATUS"}
+	return c.fmt.Output(output.TableReader(header, rows, output.JSONReader(result)))
+}
+
+// parseUntil parses the --until flag, which may be a time of day, an RFC 3339
+// timestamp, or a duration relative to now. A time of day refers to its next
+// occurrence. An empty value returns the zero time.
+func parseUntil(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		clock, err := time.ParseInLocation(layout, value, now.Location())
+		if err != nil {
+			continue
+		}
+		t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, errors.Codef(errors.ErrUsage, "invalid --until value %q: expected a time of day, timestamp, or duration", value)
+	}
+	return now.Add(d), nil
+}
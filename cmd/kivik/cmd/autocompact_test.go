@@ -0,0 +1,427 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// compactDBInfo returns the /_dbs_info entry for db, with the given file and
+// active sizes.
+func compactDBInfo(db string, file, active int64) string {
+	return fmt.Sprintf(`{"key":%[1]q,"info":{"db_name":%[1]q,"compact_running":false,"sizes":{"file":%[2]d,"active":%[3]d,"external":%[4]d}}}`, db, file, active, active/2)
+}
+
+// compactViewInfo returns the _info response for ddoc, with the given file and
+// active sizes.
+func compactViewInfo(ddoc string, file, active int64) string {
+	return fmt.Sprintf(`{"name":%q,"view_index":{"compact_running":false,"sizes":{"file":%d,"active":%d,"external":%d}}}`, ddoc, file, active, active/2)
+}
+
+// compactTask returns the active task for the compaction of db, or of the
+// views of ddoc if it is not empty.
+func compactTask(db, ddoc string) string {
+	if ddoc == "" {
+		return fmt.Sprintf(`{"node":"node1@127.0.0.1","type":"database_compaction","database":"shards/00000000-ffffffff/%s.1600000000","progress":50}`, db)
+	}
+	return fmt.Sprintf(`{"node":"node1@127.0.0.1","type":"view_compaction","database":"shards/00000000-ffffffff/%s.1600000000","design_document":"_design/%s","progress":50}`, db, ddoc)
+}
+
+// designDocsResponse returns a _design_docs response listing ddocs.
+func designDocsResponse(ddocs ...string) string {
+	rows := make([]string, 0, len(ddocs))
+	for _, ddoc := range ddocs {
+		rows = append(rows, fmt.Sprintf(`{"id":"_design/%[1]s","key":"_design/%[1]s","value":{"rev":"1-abc"}}`, ddoc))
+	}
+	return fmt.Sprintf(`{"total_rows":%d,"offset":0,"rows":[%s]}`, len(rows), strings.Join(rows, ","))
+}
+
+func Test_autocompact_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("invalid threshold", cmdTest{
+		args:   []string{"autocompact", "http://example.com/", "--threshold", "1"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid concurrency", cmdTest{
+		args:   []string{"autocompact", "http://example.com/", "--concurrency", "0"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid until", cmdTest{
+		args:   []string{"autocompact", "http://example.com/", "--until", "dawn"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("dry run", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, `["logs","orders","users"]`)
+			case "POST /_dbs_info":
+				switch body := readBody(t, r); body {
+				case `{"keys":["logs","orders","users"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("logs", 10485760, 2097152)+","+compactDBInfo("orders", 1048576, 943718)+","+compactDBInfo("users", 65536, 32768)+"]")
+				default:
+					t.Errorf("Unexpected _dbs_info request: %s", body)
+				}
+			case "GET /logs/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse("by_day"))
+			case "GET /logs/_design/by_day/_info":
+				_, _ = io.WriteString(w, compactViewInfo("by_day", 4194304, 1048576))
+			case "GET /orders/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse("app"))
+			case "GET /orders/_design/app/_info":
+				_, _ = io.WriteString(w, compactViewInfo("app", 2097152, 1048576))
+			case "GET /users/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse())
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"autocompact", s.URL, "--dry-run"},
+		}
+	})
+	tests.Add("compact", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		compacted := map[string]bool{}
+		var running []string
+		var maxRunning int
+		t.Cleanup(func() {
+			if maxRunning != 2 {
+				t.Errorf("Expected at most 2 concurrent compactions, got %d", maxRunning)
+			}
+		})
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, `["logs","orders","users"]`)
+			case "POST /_dbs_info":
+				switch body := readBody(t, r); body {
+				case `{"keys":["logs","orders","users"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("logs", 10485760, 2097152)+","+compactDBInfo("orders", 1048576, 943718)+","+compactDBInfo("users", 65536, 32768)+"]")
+				case `{"keys":["logs"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("logs", 2097152, 2097152)+"]")
+				case `{"keys":["users"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("users", 32768, 32768)+"]")
+				default:
+					t.Errorf("Unexpected _dbs_info request: %s", body)
+				}
+			case "GET /logs/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse("by_day"))
+			case "GET /logs/_design/by_day/_info":
+				if compacted["logs/by_day"] {
+					_, _ = io.WriteString(w, compactViewInfo("by_day", 1048576, 1048576))
+					return
+				}
+				_, _ = io.WriteString(w, compactViewInfo("by_day", 4194304, 1048576))
+			case "GET /orders/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse("app"))
+			case "GET /orders/_design/app/_info":
+				if compacted["orders/app"] {
+					_, _ = io.WriteString(w, compactViewInfo("app", 1048576, 1048576))
+					return
+				}
+				_, _ = io.WriteString(w, compactViewInfo("app", 2097152, 1048576))
+			case "GET /users/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse())
+			case "POST /logs/_compact":
+				running = append(running, compactTask("logs", ""))
+				if len(running) > maxRunning {
+					maxRunning = len(running)
+				}
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /logs/_compact/by_day":
+				compacted["logs/by_day"] = true
+				running = append(running, compactTask("logs", "by_day"))
+				if len(running) > maxRunning {
+					maxRunning = len(running)
+				}
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /orders/_compact/app":
+				compacted["orders/app"] = true
+				running = append(running, compactTask("orders", "app"))
+				if len(running) > maxRunning {
+					maxRunning = len(running)
+				}
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /users/_compact":
+				running = append(running, compactTask("users", ""))
+				if len(running) > maxRunning {
+					maxRunning = len(running)
+				}
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "GET /_active_tasks":
+				// Each compaction finishes after it has been listed once.
+				_, _ = io.WriteString(w, "["+strings.Join(running, ",")+"]")
+				running = nil
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"autocompact", s.URL, "--concurrency", "2", "--poll-interval", "1ms"},
+		}
+	})
+	tests.Add("json", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		compacted := map[string]bool{}
+		var running []string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "HEAD /logs":
+				w.WriteHeader(http.StatusOK)
+			case "POST /_dbs_info":
+				switch body := readBody(t, r); body {
+				case `{"keys":["logs"]}`:
+					if compacted["logs"] {
+						_, _ = io.WriteString(w, "["+compactDBInfo("logs", 2097152, 2097152)+"]")
+						return
+					}
+					_, _ = io.WriteString(w, "["+compactDBInfo("logs", 10485760, 2097152)+"]")
+				default:
+					t.Errorf("Unexpected _dbs_info request: %s", body)
+				}
+			case "GET /logs/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse("by_day"))
+			case "GET /logs/_design/by_day/_info":
+				if compacted["logs/by_day"] {
+					_, _ = io.WriteString(w, compactViewInfo("by_day", 1048576, 1048576))
+					return
+				}
+				_, _ = io.WriteString(w, compactViewInfo("by_day", 4194304, 1048576))
+			case "POST /logs/_compact":
+				compacted["logs"] = true
+				running = append(running, compactTask("logs", ""))
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /logs/_compact/by_day":
+				compacted["logs/by_day"] = true
+				running = append(running, compactTask("logs", "by_day"))
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "GET /_active_tasks":
+				// Each compaction finishes after it has been listed once.
+				_, _ = io.WriteString(w, "["+strings.Join(running, ",")+"]")
+				running = nil
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"autocompact", s.URL + "/logs", "--poll-interval", "1ms", "-f", "json"},
+		}
+	})
+	tests.Add("threshold without views", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		var running []string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "HEAD /orders", "HEAD /users":
+				w.WriteHeader(http.StatusOK)
+			case "POST /_dbs_info":
+				switch body := readBody(t, r); body {
+				case `{"keys":["orders","users"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("orders", 1048576, 943718)+","+compactDBInfo("users", 65536, 32768)+"]")
+				case `{"keys":["orders"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("orders", 943718, 943718)+"]")
+				case `{"keys":["users"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("users", 32768, 32768)+"]")
+				default:
+					t.Errorf("Unexpected _dbs_info request: %s", body)
+				}
+			case "POST /orders/_compact":
+				running = append(running, compactTask("orders", ""))
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /users/_compact":
+				running = append(running, compactTask("users", ""))
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "GET /_active_tasks":
+				// Each compaction finishes after it has been listed once.
+				_, _ = io.WriteString(w, "["+strings.Join(running, ",")+"]")
+				running = nil
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"autocompact", s.URL + "/orders", "users", "--threshold", "0", "--views=false", "--poll-interval", "1ms"},
+		}
+	})
+	tests.Add("until passed", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, `["logs","orders","users"]`)
+			case "POST /_dbs_info":
+				switch body := readBody(t, r); body {
+				case `{"keys":["logs","orders","users"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("logs", 10485760, 2097152)+","+compactDBInfo("orders", 1048576, 943718)+","+compactDBInfo("users", 65536, 32768)+"]")
+				default:
+					t.Errorf("Unexpected _dbs_info request: %s", body)
+				}
+			case "GET /logs/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse("by_day"))
+			case "GET /logs/_design/by_day/_info":
+				_, _ = io.WriteString(w, compactViewInfo("by_day", 4194304, 1048576))
+			case "GET /orders/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse("app"))
+			case "GET /orders/_design/app/_info":
+				_, _ = io.WriteString(w, compactViewInfo("app", 2097152, 1048576))
+			case "GET /users/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse())
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"autocompact", s.URL, "--until", "2021-01-01T06:00:00Z", "--poll-interval", "1ms"},
+		}
+	})
+	tests.Add("failure", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		compacted := map[string]bool{}
+		var running []string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, `["logs","orders","users"]`)
+			case "POST /_dbs_info":
+				switch body := readBody(t, r); body {
+				case `{"keys":["logs","orders","users"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("logs", 10485760, 2097152)+","+compactDBInfo("orders", 1048576, 943718)+","+compactDBInfo("users", 65536, 32768)+"]")
+				case `{"keys":["users"]}`:
+					_, _ = io.WriteString(w, "["+compactDBInfo("users", 32768, 32768)+"]")
+				default:
+					t.Errorf("Unexpected _dbs_info request: %s", body)
+				}
+			case "GET /logs/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse("by_day"))
+			case "GET /logs/_design/by_day/_info":
+				if compacted["logs/by_day"] {
+					_, _ = io.WriteString(w, compactViewInfo("by_day", 1048576, 1048576))
+					return
+				}
+				_, _ = io.WriteString(w, compactViewInfo("by_day", 4194304, 1048576))
+			case "GET /orders/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse("app"))
+			case "GET /orders/_design/app/_info":
+				if compacted["orders/app"] {
+					_, _ = io.WriteString(w, compactViewInfo("app", 1048576, 1048576))
+					return
+				}
+				_, _ = io.WriteString(w, compactViewInfo("app", 2097152, 1048576))
+			case "GET /users/_design_docs":
+				_, _ = io.WriteString(w, designDocsResponse())
+			case "POST /logs/_compact":
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = io.WriteString(w, `{"error":"forbidden","reason":"You are not a server admin."}`)
+			case "POST /logs/_compact/by_day":
+				compacted["logs/by_day"] = true
+				running = append(running, compactTask("logs", "by_day"))
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /orders/_compact/app":
+				compacted["orders/app"] = true
+				running = append(running, compactTask("orders", "app"))
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /users/_compact":
+				running = append(running, compactTask("users", ""))
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "GET /_active_tasks":
+				// Each compaction finishes after it has been listed once.
+				_, _ = io.WriteString(w, "["+strings.Join(running, ",")+"]")
+				running = nil
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args:   []string{"autocompact", s.URL, "--poll-interval", "1ms"},
+			status: errors.ErrForbidden,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
+
+func Test_parseUntil(t *testing.T) {
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"18:30", time.Date(2021, 1, 1, 18, 30, 0, 0, time.UTC)},
+		{"06:00", time.Date(2021, 1, 2, 6, 0, 0, 0, time.UTC)},
+		{"12:00:00", time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC)},
+		{"2h", time.Date(2021, 1, 1, 14, 0, 0, 0, time.UTC)},
+		{"2021-01-01T06:00:00Z", time.Date(2021, 1, 1, 6, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseUntil(tt.value, now)
+		if err != nil {
+			t.Errorf("%q: %s", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%q: want %s, got %s", tt.value, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type clusterInit struct {
+	*root
+	nodes        []string
+	admin        string
+	bindAddress  string
+	port         int
+	pollInterval string
+	wait         string
+
+	parsedPollInterval time.Duration
+	parsedWait         time.Duration
+}
+
+func clusterInitCmd(r *root) *cobra.Command {
+	c := &clusterInit{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:   "init [dsn]",
+		Short: "Set up a multi-node cluster",
+		Long: `Set up a cluster of the nodes listed in --nodes, using the /_cluster_setup endpoint of the node addressed by the DSN, which coordinates the setup.
+
+The coordinating node must be listed in --nodes, by the same host and port used in the DSN. Each other node is enabled for clustering and added to the cluster, then the cluster is finished. After each step, the command waits for the change to take effect, and finally verifies that all nodes are cluster members.
+
+The credentials given by --admin are configured on every node, and used to authenticate with the remote nodes. Requests to the coordinating node use the credentials in the DSN, or the --admin credentials if the DSN has none.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringSliceVar(&c.nodes, "nodes", nil, "The nodes of the cluster, as host or host:port. May be repeated, or comma-separated.")
+	pf.StringVar(&c.admin, "admin", "", "The admin credentials for all nodes, as user:password")
+	pf.StringVar(&c.bindAddress, "bind-address", "0.0.0.0", "The address each node should listen on")
+	pf.IntVar(&c.port, "port", 5984, "The port of nodes listed without one") // nolint:gomnd
+	pf.StringVar(&c.pollInterval, "poll-interval", "1s", "Interval between status checks")
+	pf.StringVar(&c.wait, "wait", "60s", "Maximum time to wait for each step to take effect")
+
+	return cmd
+}
+
+// clusterNode is a node to be added to the cluster.
+type clusterNode struct {
+	host string
+	port int
+}
+
+func (c *clusterInit) RunE(cmd *cobra.Command, _ []string) error {
+	cx, err := c.conf.CurrentCx()
+	if err != nil {
+		return err
+	}
+	c.conf.Finalize()
+	if len(c.nodes) == 0 {
+		return errors.Code(errors.ErrUsage, "--nodes required")
+	}
+	user, password, ok := strings.Cut(c.admin, ":")
+	if !ok || user == "" || password == "" {
+		return errors.Code(errors.ErrUsage, "--admin must be provided as user:password")
+	}
+	if c.parsedPollInterval, err = parseDuration(c.pollInterval); err != nil {
+		return err
+	}
+	if c.parsedWait, err = parseDuration(c.wait); err != nil {
+		return err
+	}
+	remotes, err := c.remoteNodes(cx.Host)
+	if err != nil {
+		return err
+	}
+
+	coordinator := *cx
+	if coordinator.User == "" {
+		coordinator.User, coordinator.Password = user, password
+	}
+	client, err := coordinator.KivikClient(c.parsedConnectTimeout, c.parsedRequestTimeout)
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	nodeCount := len(remotes) + 1
+
+	c.log.Debugf("[cluster] Will set up a %d-node cluster: %s", nodeCount, cx.ServerDSN())
+	state, err := c.status(ctx, client)
+	if err != nil {
+		return err
+	}
+	if state != "cluster_finished" {
+		if state != "cluster_enabled" {
+			c.log.Debugf("[cluster] Enabling cluster on coordinating node")
+			err := c.setup(ctx, client, map[string]interface{}{
+				"action":       "enable_cluster",
+				"bind_address": c.bindAddress,
+				"username":     user,
+				"password":     password,
+				"node_count":   nodeCount,
+			})
+			if err != nil {
+				return err
+			}
+			if err := c.waitForState(ctx, client, "cluster_enabled"); err != nil {
+				return err
+			}
+		}
+
+		for i, node := range remotes {
+			c.log.Debugf("[cluster] Adding node %s:%d", node.host, node.port)
+			err := c.setup(ctx, client, map[string]interface{}{
+				"action":                  "enable_cluster",
+				"bind_address":            c.bindAddress,
+				"username":                user,
+				"password":                password,
+				"port":                    node.port,
+				"node_count":              nodeCount,
+				"remote_node":             node.host,
+				"remote_current_user":     user,
+				"remote_current_password": password,
+			})
+			if err != nil {
+				return err
+			}
+			err = c.setup(ctx, client, map[string]interface{}{
+				"action":   "add_node",
+				"host":     node.host,
+				"port":     node.port,
+				"username": user,
+				"password": password,
+			})
+			if err != nil {
+				return err
+			}
+			if err := c.waitForMembers(ctx, client, i+2); err != nil { // nolint:gomnd
+				return err
+			}
+		}
+
+		c.log.Debugf("[cluster] Finishing cluster")
+		if err := c.setup(ctx, client, map[string]interface{}{"action": "finish_cluster"}); err != nil {
+			return err
+		}
+		if err := c.waitForState(ctx, client, "cluster_finished"); err != nil {
+			return err
+		}
+	} else {
+		c.log.Debugf("[cluster] Cluster already finished")
+	}
+
+	membership, err := c.membership(ctx, client)
+	if err != nil {
+		return err
+	}
+	rows := membershipRows(membership.AllNodes, membership.ClusterNodes)
+	if err := c.fmt.Output(output.TableReader([]string{"NODE", "CONNECTED", "MEMBER", "STATUS"}, rows, output.JSONReader(membership))); err != nil {
+		return err
+	}
+	if len(membership.ClusterNodes) != nodeCount {
+		return errors.Codef(errors.ErrUnavailable, "expected %d cluster members, found %d", nodeCount, len(membership.ClusterNodes))
+	}
+	for _, row := range rows {
+		if status := row[len(row)-1]; status != "ok" {
+			return errors.Codef(errors.ErrUnavailable, "node %s is %s", row[0], status)
+		}
+	}
+	return nil
+}
+
+// remoteNodes parses the nodes, excluding the coordinating node at host. If
+// host has no port, the coordinating node is matched by host name alone.
+func (c *clusterInit) remoteNodes(host string) ([]clusterNode, error) {
+	coordinator, err := parseClusterNode(host, 0)
+	if err != nil {
+		return nil, errors.Codef(errors.ErrUsage, "invalid host %q", host)
+	}
+	nodes := make([]clusterNode, 0, len(c.nodes))
+	var found bool
+	for _, addr := range c.nodes {
+		node, err := parseClusterNode(addr, c.port)
+		if err != nil {
+			return nil, err
+		}
+		if !found && node.host == coordinator.host && (coordinator.port == 0 || node.port == coordinator.port) {
+			found = true
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	if !found {
+		return nil, errors.Codef(errors.ErrUsage, "coordinating node %s not listed in --nodes", host)
+	}
+	return nodes, nil
+}
+
+// parseClusterNode parses addr as host or host:port, using defaultPort if it
+// has no port.
+func parseClusterNode(addr string, defaultPort int) (clusterNode, error) {
+	node := clusterNode{host: addr, port: defaultPort}
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return node, errors.Codef(errors.ErrUsage, "invalid node %q: %s", addr, err)
+		}
+		node = clusterNode{host: h, port: port}
+	}
+	if node.host == "" {
+		return node, errors.Codef(errors.ErrUsage, "invalid node %q", addr)
+	}
+	return node, nil
+}
+
+func (c *clusterInit) setup(ctx context.Context, client *kivik.Client, action map[string]interface{}) error {
+	return c.retry(func() error {
+		return client.ClusterSetup(ctx, action)
+	})
+}
+
+func (c *clusterInit) status(ctx context.Context, client *kivik.Client) (string, error) {
+	var state string
+	err := c.retry(func() error {
+		var err error
+		state, err = client.ClusterStatus(ctx)
+		return err
+	})
+	return state, err
+}
+
+func (c *clusterInit) membership(ctx context.Context, client *kivik.Client) (*kivik.ClusterMembership, error) {
+	var membership *kivik.ClusterMembership
+	err := c.retry(func() error {
+		var err error
+		membership, err = client.Membership(ctx)
+		return err
+	})
+	return membership, err
+}
+
+// waitForState polls the cluster status until it reaches state.
+func (c *clusterInit) waitForState(ctx context.Context, client *kivik.Client, state string) error {
+	return c.poll(ctx, "cluster state "+state, func() (bool, error) {
+		current, err := c.status(ctx, client)
+		c.log.Debugf("[cluster] Cluster state: %s", current)
+		return current == state, err
+	})
+}
+
+// waitForMembers polls the cluster membership until it has at least count
+// members.
+func (c *clusterInit) waitForMembers(ctx context.Context, client *kivik.Client, count int) error {
+	return c.poll(ctx, strconv.Itoa(count)+" cluster members", func() (bool, error) {
+		membership, err := c.membership(ctx, client)
+		if err != nil {
+			return false, err
+		}
+		c.log.Debugf("[cluster] Cluster members: %s", strings.Join(membership.ClusterNodes, ", "))
+		return len(membership.ClusterNodes) >= count, nil
+	})
+}
+
+// poll calls fn until it returns true, or the wait timeout expires.
+func (c *clusterInit) poll(ctx context.Context, desc string, fn func() (bool, error)) error {
+	timeout := time.NewTimer(c.parsedWait)
+	defer timeout.Stop()
+	for {
+		done, err := fn()
+		if err != nil || done {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return errors.Codef(errors.ErrUnavailable, "timed out waiting for %s", desc)
+		case <-time.After(c.parsedPollInterval):
+		}
+	}
+}
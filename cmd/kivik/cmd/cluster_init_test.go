@@ -0,0 +1,223 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// checkClusterAdmin checks that a request to the cluster setup API is
+// authenticated as admin, with basic auth or the session cookie.
+func checkClusterAdmin(t *testing.T, r *http.Request) {
+	t.Helper()
+	if user, password, _ := r.BasicAuth(); r.URL.Path == "/_session" || (user == "admin" && password == "abc123") {
+		return
+	}
+	if cookie, err := r.Cookie("AuthSession"); err != nil || cookie.Value != "admin" {
+		t.Errorf("Unauthenticated request: %s %s", r.Method, r.URL.Path)
+	}
+}
+
+// readBody returns the gzipped request body, without surrounding whitespace.
+func readBody(t *testing.T, r *http.Request) string {
+	t.Helper()
+	body, err := io.ReadAll(gunzipBody(t, r.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func Test_cluster_init_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing nodes", cmdTest{
+		args:   []string{"cluster", "init", "http://example.com", "--admin", "admin:abc123"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid admin", cmdTest{
+		args:   []string{"cluster", "init", "http://example.com", "--nodes", "a,b,c", "--admin", "admin"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid port", cmdTest{
+		args:   []string{"cluster", "init", "http://example.com", "--nodes", "a,b:x", "--admin", "admin:abc123"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("coordinator not listed", cmdTest{
+		args:   []string{"cluster", "init", "http://node1:5984", "--nodes", "node1:6984,node2", "--admin", "admin:abc123"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("three nodes", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		state := "cluster_disabled"
+		members := `"couchdb@coordinator"`
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			checkClusterAdmin(t, r)
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "POST /_session":
+				w.Header().Set("Set-Cookie", "AuthSession=admin; Path=/")
+				_, _ = io.WriteString(w, `{"ok":true,"name":"admin","roles":["_admin"]}`)
+			case "GET /_cluster_setup":
+				_, _ = fmt.Fprintf(w, `{"state":%q}`, state)
+			case "POST /_cluster_setup":
+				switch body := readBody(t, r); body {
+				case `{"action":"enable_cluster","bind_address":"0.0.0.0","node_count":3,"password":"abc123","username":"admin"}`:
+					state = "cluster_enabled"
+				case `{"action":"enable_cluster","bind_address":"0.0.0.0","node_count":3,"password":"abc123","port":5984,"remote_current_password":"abc123","remote_current_user":"admin","remote_node":"node2","username":"admin"}`,
+					`{"action":"enable_cluster","bind_address":"0.0.0.0","node_count":3,"password":"abc123","port":6984,"remote_current_password":"abc123","remote_current_user":"admin","remote_node":"node3","username":"admin"}`:
+				case `{"action":"add_node","host":"node2","password":"abc123","port":5984,"username":"admin"}`:
+					members += `,"couchdb@node2"`
+				case `{"action":"add_node","host":"node3","password":"abc123","port":6984,"username":"admin"}`:
+					members += `,"couchdb@node3"`
+				case `{"action":"finish_cluster"}`:
+					state = "cluster_finished"
+				default:
+					t.Errorf("Unexpected cluster setup action: %s", body)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "GET /_membership":
+				_, _ = fmt.Fprintf(w, `{"all_nodes":[%[1]s],"cluster_nodes":[%[1]s]}`, members)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		host := strings.TrimPrefix(s.URL, "http://")
+
+		return cmdTest{
+			args: []string{"cluster", "init", s.URL, "--nodes", host + ",node2,node3:6984", "--admin", "admin:abc123", "--poll-interval", "0"},
+		}
+	})
+	tests.Add("coordinator by dsn", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		state := "cluster_enabled"
+		members := `"couchdb@coordinator"`
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			checkClusterAdmin(t, r)
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "POST /_session":
+				w.Header().Set("Set-Cookie", "AuthSession=admin; Path=/")
+				_, _ = io.WriteString(w, `{"ok":true,"name":"admin","roles":["_admin"]}`)
+			case "GET /_cluster_setup":
+				_, _ = fmt.Fprintf(w, `{"state":%q}`, state)
+			case "POST /_cluster_setup":
+				switch body := readBody(t, r); body {
+				case `{"action":"enable_cluster","bind_address":"0.0.0.0","node_count":2,"password":"abc123","port":5984,"remote_current_password":"abc123","remote_current_user":"admin","remote_node":"node2","username":"admin"}`:
+				case `{"action":"add_node","host":"node2","password":"abc123","port":5984,"username":"admin"}`:
+					members += `,"couchdb@node2"`
+				case `{"action":"finish_cluster"}`:
+					state = "cluster_finished"
+				default:
+					t.Errorf("Unexpected cluster setup action: %s", body)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "GET /_membership":
+				_, _ = fmt.Fprintf(w, `{"all_nodes":[%[1]s],"cluster_nodes":[%[1]s]}`, members)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		host := strings.TrimPrefix(s.URL, "http://")
+
+		return cmdTest{
+			args: []string{"cluster", "init", "http://admin:abc123@" + host, "--nodes", "node2," + host, "--admin", "admin:abc123", "--poll-interval", "0", "-f", "json"},
+		}
+	})
+	tests.Add("already finished", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			checkClusterAdmin(t, r)
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "POST /_session":
+				w.Header().Set("Set-Cookie", "AuthSession=admin; Path=/")
+				_, _ = io.WriteString(w, `{"ok":true,"name":"admin","roles":["_admin"]}`)
+			case "GET /_cluster_setup":
+				_, _ = io.WriteString(w, `{"state":"cluster_finished"}`)
+			case "GET /_membership":
+				_, _ = io.WriteString(w, `{"all_nodes":["couchdb@coordinator"],"cluster_nodes":["couchdb@coordinator"]}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		host := strings.TrimPrefix(s.URL, "http://")
+
+		return cmdTest{
+			args:   []string{"cluster", "init", s.URL, "--nodes", host + ",node2", "--admin", "admin:abc123"},
+			status: errors.ErrUnavailable,
+		}
+	})
+	tests.Add("node never joins", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		state := "cluster_disabled"
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			checkClusterAdmin(t, r)
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "POST /_session":
+				w.Header().Set("Set-Cookie", "AuthSession=admin; Path=/")
+				_, _ = io.WriteString(w, `{"ok":true,"name":"admin","roles":["_admin"]}`)
+			case "GET /_cluster_setup":
+				_, _ = fmt.Fprintf(w, `{"state":%q}`, state)
+			case "POST /_cluster_setup":
+				switch body := readBody(t, r); body {
+				case `{"action":"enable_cluster","bind_address":"0.0.0.0","node_count":2,"password":"abc123","username":"admin"}`:
+					state = "cluster_enabled"
+				case `{"action":"enable_cluster","bind_address":"0.0.0.0","node_count":2,"password":"abc123","port":5984,"remote_current_password":"abc123","remote_current_user":"admin","remote_node":"node2","username":"admin"}`,
+					`{"action":"add_node","host":"node2","password":"abc123","port":5984,"username":"admin"}`:
+				default:
+					t.Errorf("Unexpected cluster setup action: %s", body)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "GET /_membership":
+				// node2 never joins.
+				_, _ = io.WriteString(w, `{"all_nodes":["couchdb@coordinator"],"cluster_nodes":["couchdb@coordinator"]}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		host := strings.TrimPrefix(s.URL, "http://")
+
+		return cmdTest{
+			args:   []string{"cluster", "init", s.URL, "--nodes", host + ",node2", "--admin", "admin:abc123", "--poll-interval", "10ms", "--wait", "50ms"},
+			status: errors.ErrUnavailable,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,57 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/config"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func configCmd(r *root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config [command]",
+		Short: "Manage contexts in the kivik config file",
+		Long: `View and edit the contexts in the kivik config file, ~/.kivik/config by default, or the file named by --config.
+
+Changes are written atomically, and comments and formatting in the file are preserved.`,
+		// Arguments are context names, not DSNs.
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			return r.init(cmd, nil)
+		},
+	}
+
+	cmd.AddCommand(configGetContextsCmd(r))
+	cmd.AddCommand(configUseContextCmd(r))
+	cmd.AddCommand(configSetContextCmd(r))
+	cmd.AddCommand(configDeleteContextCmd(r))
+	cmd.AddCommand(configRenameContextCmd(r))
+	cmd.AddCommand(configViewCmd(r))
+	cmd.AddCommand(configMigrateCmd(r))
+
+	return cmd
+}
+
+// configFile opens the config file for editing.
+func (r *root) configFile() (*config.File, error) {
+	return config.OpenFile(r.resolveHome(r.confFile))
+}
+
+// contextName returns the single context name in args.
+func contextName(args []string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", errors.Code(errors.ErrUsage, "context name required")
+	}
+	return args[0], nil
+}
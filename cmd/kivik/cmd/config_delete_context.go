@@ -0,0 +1,55 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type configDeleteContext struct {
+	*root
+}
+
+func configDeleteContextCmd(r *root) *cobra.Command {
+	c := &configDeleteContext{
+		root: r,
+	}
+	return &cobra.Command{
+		Use:   "delete-context <name>",
+		Short: "Delete a context",
+		Long:  `Delete a context from the config file. If it is the current context, the current-context is unset.`,
+		RunE:  c.RunE,
+	}
+}
+
+func (c *configDeleteContext) RunE(_ *cobra.Command, args []string) error {
+	name, err := contextName(args)
+	if err != nil {
+		return err
+	}
+	f, err := c.configFile()
+	if err != nil {
+		return err
+	}
+	if err := f.DeleteContext(name); err != nil {
+		return err
+	}
+	c.log.Debugf("[config] Will delete context: %s", name)
+	if err := f.Save(); err != nil {
+		return err
+	}
+	result := map[string]string{"context": name}
+	return c.fmt.Output(output.TemplateReader(`Deleted context "{{ .context }}".`, result, output.JSONReader(result)))
+}
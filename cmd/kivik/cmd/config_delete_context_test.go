@@ -0,0 +1,50 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func Test_config_delete_context_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing name", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args:   []string{"config", "delete-context"},
+			status: errors.ErrUsage,
+		},
+	})
+	tests.Add("not found", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args:   []string{"config", "delete-context", "foo"},
+			status: errors.ErrUsage,
+		},
+	})
+	tests.Add("current context", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "delete-context", "local"},
+		},
+	})
+
+	tests.Run(t, func(t *testing.T, tt configTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,74 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/config"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type configGetContexts struct {
+	*root
+}
+
+func configGetContextsCmd(r *root) *cobra.Command {
+	c := &configGetContexts{
+		root: r,
+	}
+	return &cobra.Command{
+		Use:     "get-contexts",
+		Aliases: []string{"contexts"},
+		Short:   "List the contexts in the config file",
+		Long:    `List the contexts in the config file, marking the current context. Passwords are redacted.`,
+		RunE:    c.RunE,
+	}
+}
+
+type contextInfo struct {
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+	DSN     string `json:"dsn"`
+}
+
+func (c *configGetContexts) RunE(_ *cobra.Command, _ []string) error {
+	f, err := c.configFile()
+	if err != nil {
+		return err
+	}
+	conf, err := f.Config()
+	if err != nil {
+		return err
+	}
+	current := f.CurrentContext()
+	names := f.ContextNames()
+	contexts := make([]contextInfo, 0, len(names))
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		info := contextInfo{
+			Name:    name,
+			Current: name == current,
+		}
+		if cx := conf.Contexts[name]; cx != nil {
+			info.DSN = config.RedactDSN(cx.DSN())
+		}
+		mark := ""
+		if info.Current {
+			mark = "*"
+		}
+		contexts = append(contexts, info)
+		rows = append(rows, []string{mark, info.Name, info.DSN})
+	}
+	return c.fmt.Output(output.TableReader([]string{"CURRENT", "NAME", "DSN"}, rows, output.JSONReader(contexts)))
+}
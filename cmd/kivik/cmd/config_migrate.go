@@ -0,0 +1,62 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/config"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type configMigrate struct {
+	*root
+}
+
+func configMigrateCmd(r *root) *cobra.Command {
+	c := &configMigrate{
+		root: r,
+	}
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the config file to the current schema",
+		Long: `Rewrite a config file written in an older format to the current schema, ` + config.APIVersion + `.
+
+Contexts given as a mapping of names, or as a list with the "default" key, are converted to a list of named contexts. Comments are preserved where possible.`,
+		RunE: c.RunE,
+	}
+}
+
+func (c *configMigrate) RunE(_ *cobra.Command, _ []string) error {
+	f, err := c.configFile()
+	if err != nil {
+		return err
+	}
+	migrated, err := f.Migrate()
+	if err != nil {
+		return err
+	}
+	result := map[string]interface{}{
+		"apiVersion": config.APIVersion,
+		"migrated":   migrated,
+	}
+	if !migrated {
+		c.log.Debug("[config] Config file already uses the current schema")
+		return c.fmt.Output(output.TemplateReader(`Config file already uses {{ .apiVersion }}.`, result, output.JSONReader(result)))
+	}
+	c.log.Debugf("[config] Will migrate config file to %s", config.APIVersion)
+	if err := f.Save(); err != nil {
+		return err
+	}
+	return c.fmt.Output(output.TemplateReader(`Config file migrated to {{ .apiVersion }}.`, result, output.JSONReader(result)))
+}
@@ -0,0 +1,56 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type configRenameContext struct {
+	*root
+}
+
+func configRenameContextCmd(r *root) *cobra.Command {
+	c := &configRenameContext{
+		root: r,
+	}
+	return &cobra.Command{
+		Use:   "rename-context <old-name> <new-name>",
+		Short: "Rename a context",
+		Long:  `Rename a context in the config file. If it is the current context, the current-context is updated.`,
+		RunE:  c.RunE,
+	}
+}
+
+func (c *configRenameContext) RunE(_ *cobra.Command, args []string) error {
+	if len(args) != 2 { // nolint:gomnd
+		return errors.Code(errors.ErrUsage, "old and new context names required")
+	}
+	oldName, newName := args[0], args[1]
+	f, err := c.configFile()
+	if err != nil {
+		return err
+	}
+	if err := f.RenameContext(oldName, newName); err != nil {
+		return err
+	}
+	c.log.Debugf("[config] Will rename context %s to %s", oldName, newName)
+	if err := f.Save(); err != nil {
+		return err
+	}
+	result := map[string]string{"context": oldName, "new_name": newName}
+	return c.fmt.Output(output.TemplateReader(`Context "{{ .context }}" renamed to "{{ .new_name }}".`, result, output.JSONReader(result)))
+}
@@ -0,0 +1,117 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func Test_config_set_context_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing name", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args:   []string{"config", "set-context", "--host", "localhost"},
+			status: errors.ErrUsage,
+		},
+	})
+	tests.Add("dsn with fields", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args:   []string{"config", "set-context", "local", "--dsn", "http://localhost/", "--user", "bob"},
+			status: errors.ErrUsage,
+		},
+	})
+	tests.Add("dsn with password source", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "prod", "--dsn", "https://admin@couch.example.com/", "--password-env", "COUCHDB_PASSWORD"},
+		},
+	})
+	tests.Add("password source replaces password", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "prod", "--password-file", "~/.kivik/prod.password"},
+		},
+	})
+	tests.Add("create in new file", configTest{
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "local", "--host", "localhost:5984", "--user", "admin", "--password", "abc123"},
+		},
+	})
+	tests.Add("modify", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "local", "--database", "", "--host", "127.0.0.1:5984"},
+		},
+	})
+	tests.Add("expand dsn", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "prod", "--database", "orders", "-f", "json"},
+		},
+	})
+	tests.Add("replace with dsn", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "local", "--dsn", "http://localhost:5984/dev"},
+		},
+	})
+	tests.Add("tls", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "prod", "--ca-file", "/etc/couchdb/ca.pem", "--server-name", "couchdb.internal", "--insecure-skip-verify"},
+		},
+	})
+	tests.Add("http", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "prod", "--proxy", "http://proxy.example.com:3128/", "--request-header", "X-Api-Key: abc123", "--request-header", "X-Gateway: couch"},
+		},
+	})
+	tests.Add("dial", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "prod", "--resolve", "couch.example.com:443:10.0.0.5", "--resolve", "couch.example.com:443:10.0.0.6"},
+		},
+	})
+	tests.Add("unix socket", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args: []string{"config", "set-context", "local", "--unix-socket", "/var/run/couchdb.sock"},
+		},
+	})
+	tests.Add("invalid request header", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args:   []string{"config", "set-context", "prod", "--request-header", "X-Api-Key"},
+			status: errors.ErrUsage,
+		},
+	})
+	tests.Add("invalid tls-handshake-timeout", configTest{
+		config: testContextsConfig,
+		cmdTest: cmdTest{
+			args:   []string{"config", "set-context", "prod", "--tls-handshake-timeout", "10"},
+			status: errors.ErrUsage,
+		},
+	})
+
+	tests.Run(t, func(t *testing.T, tt configTest) {
+		tt.Test(t)
+	})
+}
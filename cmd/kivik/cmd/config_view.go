@@ -0,0 +1,61 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"bytes"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type configView struct {
+	*root
+	raw bool
+}
+
+func configViewCmd(r *root) *cobra.Command {
+	c := &configView{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:   "view",
+		Short: "Display the config file",
+		Long:  `Display the config file, including comments. Passwords are redacted, unless --raw is given.`,
+		RunE:  c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.BoolVar(&c.raw, "raw", false, "Display passwords")
+
+	return cmd
+}
+
+func (c *configView) RunE(_ *cobra.Command, _ []string) error {
+	f, err := c.configFile()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := f.Encode(&buf, !c.raw); err != nil {
+		return errors.Code(errors.ErrData, err)
+	}
+	var data interface{}
+	if err := yaml.Unmarshal(buf.Bytes(), &data); err != nil {
+		return errors.Code(errors.ErrData, err)
+	}
+	return c.fmt.Output(output.TemplateReader(`{{ . }}`, buf.String(), output.JSONReader(data)))
+}
@@ -68,6 +68,7 @@ func (c *copy) RunE(cmd *cobra.Command, args []string) error {
 	if c.targetRev == "" {
 		c.targetRev = targetOpts["rev"]
 	}
+	c.contextFlags(target)
 
 	c.log.Debugf("[copy] Will copy: %s/%s/%s to %s", client.DSN(), sourceDB, sourceDoc, target.DSN())
 
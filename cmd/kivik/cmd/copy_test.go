@@ -62,6 +62,18 @@ func Test_copy_RunE(t *testing.T) {
 			args: []string{"--debug", "copy", s.URL + "/jjj/src", "target"},
 		}
 	})
+	tests.Add("password redacted from debug output", func(t *testing.T) interface{} {
+		s := testy.ServeResponse(&http.Response{
+			Header: http.Header{
+				"ETag": {`"2-62e778c9ec09214dd685a981dcc24074"`},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"id": "target","ok": true,"rev": "2-62e778c9ec09214dd685a981dcc24074"}`)),
+		})
+
+		return cmdTest{
+			args: []string{"--debug", "copy", strings.Replace(s.URL, "://", "://admin:abc123@", 1) + "/jjj/src", "target"},
+		}
+	})
 	tests.Add("emulated COPY", func(t *testing.T) interface{} {
 		ss := testy.ServeResponseValidator(t, &http.Response{
 			Header: http.Header{
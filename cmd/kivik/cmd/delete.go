@@ -17,7 +17,7 @@ import (
 )
 
 type delete struct {
-	doc, db, att, cf *cobra.Command
+	doc, db, att, cf, idx, rep *cobra.Command
 	*root
 }
 
@@ -28,6 +28,8 @@ func deleteCmd(r *root) *cobra.Command {
 		db:   deleteDBCmd(r),
 		att:  deleteAttachmentCmd(r),
 		cf:   deleteConfigCmd(r),
+		idx:  deleteIndexCmd(r),
+		rep:  deleteReplicationCmd(r),
 	}
 	cmd := &cobra.Command{
 		Use:     "delete [command]",
@@ -41,6 +43,8 @@ func deleteCmd(r *root) *cobra.Command {
 	cmd.AddCommand(c.doc)
 	cmd.AddCommand(c.db)
 	cmd.AddCommand(c.cf)
+	cmd.AddCommand(c.idx)
+	cmd.AddCommand(c.rep)
 
 	return cmd
 }
@@ -53,6 +57,9 @@ func (c *delete) RunE(cmd *cobra.Command, args []string) error {
 	if _, _, ok := configFromDSN(dsn); ok {
 		return c.cf.RunE(cmd, args)
 	}
+	if _, _, _, ok := indexFromDSN(dsn); ok {
+		return c.idx.RunE(cmd, args)
+	}
 	if c.conf.HasAttachment() {
 		return c.att.RunE(cmd, args)
 	}
@@ -0,0 +1,74 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+type deleteIndex struct {
+	*root
+	ddoc, name string
+}
+
+func deleteIndexCmd(r *root) *cobra.Command {
+	c := &deleteIndex{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "index [dsn]/[database]",
+		Aliases: []string{"idx"},
+		Short:   "Delete a Mango index",
+		Long:    `Delete a Mango index, identified by --ddoc and --name, or by a DSN of the form [dsn]/[database]/_index/[ddoc]/json/[name]`,
+		RunE:    c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.ddoc, "ddoc", "", "Design document name")
+	pf.StringVar(&c.name, "name", "", "Index name")
+
+	return cmd
+}
+
+func (c *deleteIndex) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, ddoc, name, err := c.indexDB()
+	if err != nil {
+		return err
+	}
+	if c.ddoc == "" {
+		c.ddoc = ddoc
+	}
+	if c.name == "" {
+		c.name = name
+	}
+	c.ddoc = strings.TrimPrefix(c.ddoc, "_design/")
+	if c.ddoc == "" || c.name == "" {
+		return errors.Code(errors.ErrUsage, "design doc and index name required")
+	}
+
+	c.log.Debugf("[delete] Will delete index: %s/%s/_index/%s/json/%s", client.DSN(), db, c.ddoc, c.name)
+	return c.retry(func() error {
+		if err := client.DB(db).DeleteIndex(cmd.Context(), c.ddoc, c.name, c.opts()); err != nil {
+			return err
+		}
+		return c.fmt.OK()
+	})
+}
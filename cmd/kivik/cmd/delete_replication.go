@@ -0,0 +1,69 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+type deleteReplication struct {
+	*root
+	replicatorDB string
+}
+
+func deleteReplicationCmd(r *root) *cobra.Command {
+	c := &deleteReplication{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "replication [dsn]/[replicator-db]/[name]",
+		Aliases: []string{"rep"},
+		Short:   "Delete a persistent replication",
+		Long:    `Delete the named replication document from a replicator database, which cancels the replication.`,
+		RunE:    c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.replicatorDB, "replicator-db", defaultReplicatorDB, "Replicator database, if not included in the DSN")
+
+	return cmd
+}
+
+func (c *deleteReplication) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, name, err := c.replicatorDoc(c.replicatorDB)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errors.Code(errors.ErrUsage, "replication name required")
+	}
+
+	c.log.Debugf("[delete] Will delete replication: %s/%s/%s", client.DSN(), db, name)
+	return c.retry(func() error {
+		rev, err := client.DB(db).GetRev(cmd.Context(), name)
+		if err != nil {
+			return err
+		}
+		newRev, err := client.DB(db).Delete(cmd.Context(), name, rev)
+		if err != nil {
+			return err
+		}
+		return c.fmt.UpdateResult(name, newRev)
+	})
+}
@@ -0,0 +1,64 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func Test_delete_replication_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing name", cmdTest{
+		args:   []string{"delete", "replication", "http://example.com/_replicator"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("not found", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusNotFound, `{"error":"not_found","reason":"missing"}`), expectRequest("HEAD /_replicator/orders"))
+
+		return cmdTest{
+			args:   []string{"delete", "replication", s.URL + "/orders"},
+			status: errors.ErrNotFound,
+		}
+	})
+	tests.Add("success", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "HEAD /_replicator/orders":
+				w.Header().Set("ETag", `"1-abc"`)
+			case "DELETE /_replicator/orders?rev=1-abc":
+				w.Header().Set("ETag", `"2-def"`)
+				_, _ = io.WriteString(w, `{"ok":true,"id":"orders","rev":"2-def"}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"delete", "replication", s.URL + "/orders"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
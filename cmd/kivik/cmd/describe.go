@@ -13,11 +13,13 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/spf13/cobra"
 )
 
 type describe struct {
-	att, doc, db, ver *cobra.Command
+	att, doc, db, dbs, ver, part *cobra.Command
 	*root
 }
 
@@ -27,7 +29,9 @@ func descrCmd(r *root) *cobra.Command {
 		att:  descrAttachmentCmd(r),
 		doc:  descrDocCmd(r),
 		db:   descrDBCmd(r),
+		dbs:  descrDBsCmd(r),
 		ver:  descrVerCmd(r),
+		part: descrPartitionCmd(r),
 	}
 	cmd := &cobra.Command{
 		Use:     "describe [command]",
@@ -40,12 +44,24 @@ func descrCmd(r *root) *cobra.Command {
 	cmd.AddCommand(g.att)
 	cmd.AddCommand(g.doc)
 	cmd.AddCommand(g.db)
+	cmd.AddCommand(g.dbs)
 	cmd.AddCommand(g.ver)
+	cmd.AddCommand(g.part)
 
 	return cmd
 }
 
 func (g *describe) RunE(cmd *cobra.Command, args []string) error {
+	dsn, err := g.conf.URL()
+	if err != nil {
+		return err
+	}
+	if _, _, _, ok := partitionFromDSN(dsn); ok {
+		return g.part.RunE(cmd, args)
+	}
+	if strings.Trim(dsn.Path, "/") == "_dbs_info" {
+		return g.dbs.RunE(cmd, args)
+	}
 	if g.conf.HasAttachment() {
 		return g.att.RunE(cmd, args)
 	}
@@ -0,0 +1,291 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+// defaultDBsInfoBatch is CouchDB's default limit on the number of databases
+// per /_dbs_info request.
+const defaultDBsInfoBatch = 100
+
+type descrDBs struct {
+	*root
+	batchSize       int
+	sort            string
+	needsCompaction float64
+}
+
+func descrDBsCmd(r *root) *cobra.Command {
+	c := &descrDBs{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "dbs [dsn]/[database] [database...]",
+		Aliases: []string{"databases", "dbs-info"},
+		Short:   "Describe multiple databases",
+		Long: `Fetch information about multiple databases, with the /_dbs_info endpoint.
+
+Databases may be named in the DSN and as additional arguments. Names may contain shell-style wildcards, such as 'logs-*', which are matched against /_all_dbs. With no database named, all databases are described.
+
+The fragmentation ratio is the proportion of the database file not used by live data, (file - active) / file, and indicates how much space compaction would reclaim.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.IntVar(&c.batchSize, "batch-size", defaultDBsInfoBatch, "Number of databases to request at once. CouchDB limits this to 100 by default.")
+	pf.StringVar(&c.sort, "sort", "name", "Column to sort by. One of: name|docs|deleted|file|active|external|fragmentation. Append :desc for descending order.")
+	pf.Float64Var(&c.needsCompaction, "needs-compaction", 0, "Show only databases with a fragmentation ratio of at least this value, between 0 and 1.")
+
+	return cmd
+}
+
+// dbInfo is the subset of a database's information used to compare
+// databases.
+type dbInfo struct {
+	Name           string  `json:"db_name"`
+	DocCount       int64   `json:"doc_count"`
+	DeletedCount   int64   `json:"doc_del_count"`
+	CompactRunning bool    `json:"compact_running"`
+	Sizes          dbSizes `json:"sizes"`
+	Fragmentation  float64 `json:"fragmentation"`
+}
+
+type dbSizes struct {
+	File     int64 `json:"file"`
+	Active   int64 `json:"active"`
+	External int64 `json:"external"`
+}
+
+// fragmentation returns the proportion of the database file which is not
+// used by live data.
+func (s dbSizes) fragmentation() float64 {
+	if s.File <= 0 || s.Active > s.File {
+		return 0
+	}
+	return float64(s.File-s.Active) / float64(s.File)
+}
+
+// dbInfoSort maps sort columns to the ordering they represent.
+var dbInfoSort = map[string]func(a, b dbInfo) bool{
+	"name":          func(a, b dbInfo) bool { return a.Name < b.Name },
+	"docs":          func(a, b dbInfo) bool { return a.DocCount < b.DocCount },
+	"deleted":       func(a, b dbInfo) bool { return a.DeletedCount < b.DeletedCount },
+	"file":          func(a, b dbInfo) bool { return a.Sizes.File < b.Sizes.File },
+	"active":        func(a, b dbInfo) bool { return a.Sizes.Active < b.Sizes.Active },
+	"external":      func(a, b dbInfo) bool { return a.Sizes.External < b.Sizes.External },
+	"fragmentation": func(a, b dbInfo) bool { return a.Fragmentation < b.Fragmentation },
+}
+
+func (c *descrDBs) RunE(cmd *cobra.Command, args []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	patterns, err := c.dbPatterns(args)
+	if err != nil {
+		return err
+	}
+	if c.batchSize <= 0 {
+		return errors.Code(errors.ErrUsage, "batch size must be positive")
+	}
+	if c.needsCompaction < 0 || c.needsCompaction >= 1 {
+		return errors.Code(errors.ErrUsage, "--needs-compaction must be between 0 and 1")
+	}
+	less, err := parseDBInfoSort(c.sort)
+	if err != nil {
+		return err
+	}
+
+	return c.retry(func() error {
+		dbs, err := c.selectDBs(cmd.Context(), client, patterns)
+		if err != nil {
+			return err
+		}
+		c.log.Debugf("[describe] Will fetch %d databases: %s", len(dbs), client.DSN())
+		infos, err := c.dbsInfo(cmd.Context(), client, dbs, c.batchSize)
+		if err != nil {
+			return err
+		}
+		if c.needsCompaction > 0 {
+			filtered := infos[:0]
+			for _, info := range infos {
+				if info.Fragmentation >= c.needsCompaction {
+					filtered = append(filtered, info)
+				}
+			}
+			infos = filtered
+		}
+		sort.SliceStable(infos, func(i, j int) bool {
+			return less(infos[i], infos[j])
+		})
+
+		rows := make([][]string, 0, len(infos))
+		for _, info := range infos {
+			rows = append(rows, []string{
+				info.Name,
+				fmt.Sprint(info.DocCount),
+				fmt.Sprint(info.DeletedCount),
+				formatBytes(float64(info.Sizes.File)),
+				formatBytes(float64(info.Sizes.Active)),
+				formatBytes(float64(info.Sizes.External)),
+				fmt.Sprintf("%.2f", info.Fragmentation),
+			})
+		}
+		header := []string{"DATABASE", "DOCS", "DELETED", "FILE", "ACTIVE", "EXTERNAL", "FRAGMENTATION"}
+		return c.fmt.Output(output.TableReader(header, rows, output.JSONReader(infos)))
+	})
+}
+
+// dbPatterns returns the database names or patterns given in the DSN and
+// additional arguments. An empty result means all databases.
+func (r *root) dbPatterns(args []string) ([]string, error) {
+	dsn, err := r.conf.URL()
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	if r.conf.HasDB() && strings.Trim(dsn.Path, "/") != "_dbs_info" {
+		db, err := r.conf.DB()
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, db)
+	}
+	r.conf.Finalize()
+	if len(args) > 1 {
+		patterns = append(patterns, args[1:]...)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Codef(errors.ErrUsage, "invalid database pattern %q: %s", pattern, err)
+		}
+	}
+	return patterns, nil
+}
+
+func parseDBInfoSort(value string) (func(a, b dbInfo) bool, error) {
+	column, dir, _ := strings.Cut(value, ":")
+	less, ok := dbInfoSort[column]
+	if !ok {
+		return nil, errors.Codef(errors.ErrUsage, "unknown sort column: %s", column)
+	}
+	switch dir {
+	case "", "asc":
+		return less, nil
+	case "desc":
+		return func(a, b dbInfo) bool { return less(b, a) }, nil
+	}
+	return nil, errors.Codef(errors.ErrUsage, "invalid sort direction for %s: %s", column, dir)
+}
+
+// selectDBs expands patterns to a list of database names. Patterns without
+// wildcards are used as-is, and an empty list selects all databases.
+func (r *root) selectDBs(ctx context.Context, client *kivik.Client, patterns []string) ([]string, error) {
+	var allDBs []string
+	all := func() ([]string, error) {
+		if allDBs != nil {
+			return allDBs, nil
+		}
+		var err error
+		allDBs, err = client.AllDBs(ctx)
+		if allDBs == nil {
+			allDBs = []string{}
+		}
+		return allDBs, err
+	}
+	if len(patterns) == 0 {
+		return all()
+	}
+	seen := make(map[string]bool)
+	var dbs []string
+	add := func(db string) {
+		if !seen[db] {
+			seen[db] = true
+			dbs = append(dbs, db)
+		}
+	}
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			// DBsStats cannot report a missing database within a batch, so
+			// check named databases up front.
+			exists, err := client.DBExists(ctx, pattern)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				return nil, errors.Codef(errors.ErrNotFound, "%s: not found", pattern)
+			}
+			add(pattern)
+			continue
+		}
+		names, err := all()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				add(name)
+			}
+		}
+	}
+	return dbs, nil
+}
+
+// dbsInfo fetches information about each database, in batches of batchSize.
+func (r *root) dbsInfo(ctx context.Context, client *kivik.Client, dbs []string, batchSize int) ([]dbInfo, error) {
+	infos := make([]dbInfo, 0, len(dbs))
+	for start := 0; start < len(dbs); start += batchSize {
+		end := start + batchSize
+		if end > len(dbs) {
+			end = len(dbs)
+		}
+		batch := dbs[start:end]
+		r.log.Debugf("[describe] Fetching %d databases from /_dbs_info", len(batch))
+		stats, err := client.DBsStats(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		for i, stat := range stats {
+			if stat == nil {
+				return nil, errors.Codef(errors.ErrNotFound, "%s: not found", batch[i])
+			}
+			info := dbInfo{
+				Name:           stat.Name,
+				DocCount:       stat.DocCount,
+				DeletedCount:   stat.DeletedCount,
+				CompactRunning: stat.CompactRunning,
+				Sizes: dbSizes{
+					File:     stat.DiskSize,
+					Active:   stat.ActiveSize,
+					External: stat.ExternalSize,
+				},
+			}
+			info.Fragmentation = info.Sizes.fragmentation()
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
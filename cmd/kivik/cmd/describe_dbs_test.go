@@ -0,0 +1,259 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// testAllDBs is the /_all_dbs response for the databases in testDBInfo.
+const testAllDBs = `["_users","logs-2021","logs-2022","orders"]`
+
+// testDBInfo is the information returned for each test database.
+var testDBInfo = map[string]string{
+	"_users":    `{"db_name":"_users","doc_count":6,"doc_del_count":3,"sizes":{"active":60000,"external":30000,"file":65536}}`,
+	"logs-2021": `{"db_name":"logs-2021","doc_count":9,"doc_del_count":1,"sizes":{"active":2097152,"external":1048576,"file":10485760}}`,
+	"logs-2022": `{"db_name":"logs-2022","doc_count":9,"doc_del_count":5,"sizes":{"active":3145728,"external":1572864,"file":4194304}}`,
+	"orders":    `{"db_name":"orders","doc_count":6,"doc_del_count":2,"sizes":{"active":524288,"external":262144,"file":1048576}}`,
+}
+
+// dbsInfoResponse returns a /_dbs_info response for the named databases.
+func dbsInfoResponse(dbs ...string) string {
+	results := make([]string, 0, len(dbs))
+	for _, db := range dbs {
+		results = append(results, `{"key":"`+db+`","info":`+testDBInfo[db]+`}`)
+	}
+	return "[" + strings.Join(results, ",") + "]"
+}
+
+func Test_describe_dbs_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("invalid sort", cmdTest{
+		args:   []string{"describe", "dbs", "http://example.com/", "--sort", "size"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid ratio", cmdTest{
+		args:   []string{"describe", "dbs", "http://example.com/", "--needs-compaction", "1.5"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid pattern", cmdTest{
+		args:   []string{"describe", "dbs", "http://example.com/", "logs-[2021"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("all databases", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, testAllDBs)
+			case "POST /_dbs_info":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["_users","logs-2021","logs-2022","orders"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, dbsInfoResponse("_users", "logs-2021", "logs-2022", "orders"))
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"describe", "dbs", s.URL},
+		}
+	})
+	tests.Add("json", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "HEAD /orders":
+			case "POST /_dbs_info":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["orders"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, dbsInfoResponse("orders"))
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"describe", "dbs", s.URL + "/orders", "-f", "json"},
+		}
+	})
+	tests.Add("glob", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, testAllDBs)
+			case "HEAD /orders":
+			case "POST /_dbs_info":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["logs-2021","logs-2022","orders"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, dbsInfoResponse("logs-2021", "logs-2022", "orders"))
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"describe", "dbs", s.URL + "/logs-*", "orders"},
+		}
+	})
+	tests.Add("batches", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, testAllDBs)
+			case "POST /_dbs_info":
+				switch body := readBody(t, r); body {
+				case `{"keys":["_users","logs-2021"]}`:
+					_, _ = io.WriteString(w, dbsInfoResponse("_users", "logs-2021"))
+				case `{"keys":["logs-2022","orders"]}`:
+					_, _ = io.WriteString(w, dbsInfoResponse("logs-2022", "orders"))
+				default:
+					t.Errorf("Unexpected batch: %s", body)
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"describe", "dbs", s.URL, "--batch-size", "2"},
+		}
+	})
+	tests.Add("sort descending", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, testAllDBs)
+			case "POST /_dbs_info":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["_users","logs-2021","logs-2022","orders"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, dbsInfoResponse("_users", "logs-2021", "logs-2022", "orders"))
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"describe", "dbs", s.URL, "--sort", "file:desc"},
+		}
+	})
+	tests.Add("needs compaction", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, testAllDBs)
+			case "POST /_dbs_info":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["_users","logs-2021","logs-2022","orders"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, dbsInfoResponse("_users", "logs-2021", "logs-2022", "orders"))
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"describe", "dbs", s.URL, "--needs-compaction", "0.4", "--sort", "fragmentation:desc"},
+		}
+	})
+	tests.Add("not found", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "HEAD /orders":
+			case "HEAD /invoices":
+				w.WriteHeader(http.StatusNotFound)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args:   []string{"describe", "dbs", s.URL + "/orders", "invoices"},
+			status: errors.ErrNotFound,
+		}
+	})
+	tests.Add("legacy server", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, testAllDBs)
+			case "POST /_dbs_info":
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, `{"error":"not_found","reason":"Database does not exist."}`)
+			case "GET /logs-2021":
+				_, _ = io.WriteString(w, testDBInfo["logs-2021"])
+			case "GET /logs-2022":
+				_, _ = io.WriteString(w, testDBInfo["logs-2022"])
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"describe", "dbs", s.URL, "logs-*"},
+		}
+	})
+	tests.Add("auto describe", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /_all_dbs":
+				_, _ = io.WriteString(w, testAllDBs)
+			case "POST /_dbs_info":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["_users","logs-2021","logs-2022","orders"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, dbsInfoResponse("_users", "logs-2021", "logs-2022", "orders"))
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"describe", s.URL + "/_dbs_info"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,105 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+	"github.com/go-kivik/kivik/v4/couchdb"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+type descrPartition struct {
+	*root
+	partition string
+}
+
+func descrPartitionCmd(r *root) *cobra.Command {
+	c := &descrPartition{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "partition [dsn]/[database]/_partition/[partition]",
+		Aliases: []string{"part"},
+		Short:   "Describe a database partition",
+		Long:    `Fetch information about a partition of a partitioned database`,
+		RunE:    c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVarP(&c.partition, "partition", "p", "", "The partition name, if not provided in the DSN")
+
+	return cmd
+}
+
+// partitionFromDSN parses a DSN in the form /{db}/_partition/{partition}, with
+// an optional trailing path, such as _all_docs.
+func partitionFromDSN(dsn *url.URL) (db, partition, rest string, ok bool) {
+	parts := strings.SplitN(strings.TrimPrefix(dsn.Path, "/"), "/", 4) // nolint:gomnd
+	if len(parts) < 3 || parts[1] != "_partition" || parts[2] == "" {  // nolint:gomnd
+		return "", "", "", false
+	}
+	if len(parts) == 4 { // nolint:gomnd
+		rest = strings.TrimSuffix(parts[3], "/")
+	}
+	return parts[0], parts[2], rest, true
+}
+
+// partitionOpts returns the options needed to limit a query to partition.
+func partitionOpts(partition string) []kivik.Option {
+	if partition == "" {
+		return nil
+	}
+	return []kivik.Option{couchdb.OptionPartition(partition)}
+}
+
+func (c *descrPartition) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	dsn, err := c.conf.URL()
+	if err != nil {
+		return err
+	}
+	db, partition, rest, ok := partitionFromDSN(dsn)
+	switch {
+	case ok && rest == "":
+		c.conf.Finalize()
+	case ok:
+		return errors.Codef(errors.ErrUsage, "unexpected path after partition: %s", rest)
+	default:
+		if db, err = c.conf.DB(); err != nil {
+			return err
+		}
+		partition = c.partition
+	}
+	if partition == "" {
+		return errors.Code(errors.ErrUsage, "partition required")
+	}
+
+	c.log.Debugf("[get] Will fetch partition: %s/%s/_partition/%s", client.DSN(), db, partition)
+	return c.retry(func() error {
+		stats, err := client.DB(db).PartitionStats(cmd.Context(), partition)
+		if err != nil {
+			return err
+		}
+		return c.fmt.Output(bytes.NewReader(stats.RawResponse))
+	})
+}
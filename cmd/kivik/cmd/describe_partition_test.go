@@ -0,0 +1,84 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func Test_describe_partition_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	partition := func(t *testing.T) *http.Response {
+		t.Helper()
+		return &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"db_name":"db","sizes":{"active":244,"external":79},"partition":"sensor","doc_count":2,"doc_del_count":0}`)),
+		}
+	}
+	validate := func(t *testing.T, req *http.Request) {
+		if req.URL.Path != "/db/_partition/sensor" {
+			t.Errorf("Unexpected path: %s", req.URL.Path)
+		}
+	}
+
+	tests.Add("missing partition", cmdTest{
+		args:   []string{"describe", "partition", "http://example.com/db"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("unexpected path", cmdTest{
+		args:   []string{"describe", "partition", "http://example.com/db/_partition/sensor/_all_docs"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("from dsn", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, partition(t), validate)
+
+		return cmdTest{
+			args: []string{"describe", "partition", s.URL + "/db/_partition/sensor"},
+		}
+	})
+	tests.Add("flag", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, partition(t), validate)
+
+		return cmdTest{
+			args: []string{"describe", "partition", s.URL + "/db", "--partition", "sensor"},
+		}
+	})
+	tests.Add("auto describe", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, partition(t), validate)
+
+		return cmdTest{
+			args: []string{"describe", s.URL + "/db/_partition/sensor"},
+		}
+	})
+	tests.Add("auto get", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, partition(t), validate)
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/db/_partition/sensor"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,56 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import "strings"
+
+// fieldValue returns the value of the dot-separated field in doc.
+func fieldValue(doc map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, part := range strings.Split(field, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = obj[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// compareValues compares two numbers or two strings, returning false if the
+// values are not comparable.
+func compareValues(a, b interface{}) (int, bool) {
+	switch at := a.(type) {
+	case float64:
+		bt, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case at < bt:
+			return -1, true
+		case at > bt:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		bt, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(at, bt), true
+	}
+	return 0, false
+}
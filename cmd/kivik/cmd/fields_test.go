@@ -0,0 +1,58 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import "testing"
+
+func Test_fieldValue(t *testing.T) {
+	doc := map[string]interface{}{
+		"name": "bob",
+		"meta": map[string]interface{}{"updated": 3.0},
+	}
+	tests := []struct {
+		field string
+		want  interface{}
+		ok    bool
+	}{
+		{"name", "bob", true},
+		{"meta.updated", 3.0, true},
+		{"meta.created", nil, false},
+		{"name.first", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := fieldValue(doc, tt.field)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: want %v, %t, got %v, %t", tt.field, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func Test_compareValues(t *testing.T) {
+	tests := []struct {
+		a, b interface{}
+		want int
+		ok   bool
+	}{
+		{1.0, 2.0, -1, true},
+		{2.0, 2.0, 0, true},
+		{"b", "a", 1, true},
+		{"1", 1.0, 0, false},
+		{true, false, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := compareValues(tt.a, tt.b)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%v, %v: want %d, %t, got %d, %t", tt.a, tt.b, tt.want, tt.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/input"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+// findPageSize is the number of documents requested per page, when following
+// bookmarks.
+const findPageSize = 25
+
+type find struct {
+	*root
+	*input.Input
+	selector  string
+	fields    []string
+	sort      []string
+	limit     int
+	useIndex  string
+	explain   bool
+	partition string
+}
+
+func findCmd(r *root) *cobra.Command {
+	c := &find{
+		root:  r,
+		Input: input.New(),
+	}
+	cmd := &cobra.Command{
+		Use:   "find [dsn]/[database]",
+		Short: "Query documents with a Mango selector",
+		Long: `Query a database with a Mango selector, following bookmarks until all matching documents are read.
+
+The selector may be provided with --selector, or as JSON or YAML via --data or --data-file. Use --explain to show the query plan instead of executing the query.`,
+		RunE: c.RunE,
+	}
+
+	c.Input.ConfigFlags(cmd.PersistentFlags())
+
+	pf := cmd.PersistentFlags()
+	pf.StringVarP(&c.selector, "selector", "s", "", "The Mango selector, as a JSON object")
+	pf.StringSliceVar(&c.fields, "fields", nil, "Fields to return. May be repeated, or comma-separated.")
+	pf.StringSliceVar(&c.sort, "sort", nil, "Fields to sort by. Append :desc to a field name for descending order.")
+	pf.IntVar(&c.limit, "limit", 0, "Maximum number of documents to return. 0 returns all matching documents.")
+	pf.StringVar(&c.useIndex, "use-index", "", "Index to use, as [design-doc] or [design-doc]/[index-name]")
+	pf.BoolVar(&c.explain, "explain", false, "Show the query plan, rather than executing the query")
+	pf.StringVarP(&c.partition, "partition", "p", "", "Limit the query to the named partition of a partitioned database")
+
+	return cmd
+}
+
+// query builds the Mango query object from the command line flags and input.
+func (c *find) query() (map[string]interface{}, error) {
+	var selector interface{}
+	switch {
+	case c.selector != "" && c.HasInput():
+		return nil, errors.Code(errors.ErrUsage, "--selector and --data/--data-file are mutually exclusive")
+	case c.selector != "":
+		if err := json.Unmarshal([]byte(c.selector), &selector); err != nil {
+			return nil, errors.Code(errors.ErrUsage, fmt.Errorf("invalid selector: %w", err))
+		}
+	case c.HasInput():
+		if err := c.As(&selector); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Code(errors.ErrUsage, "selector required")
+	}
+	query := map[string]interface{}{
+		"selector": selector,
+	}
+	if len(c.fields) > 0 {
+		query["fields"] = c.fields
+	}
+	if len(c.sort) > 0 {
+		sort, err := parseSort(c.sort)
+		if err != nil {
+			return nil, err
+		}
+		query["sort"] = sort
+	}
+	if c.useIndex != "" {
+		useIndex := strings.TrimPrefix(c.useIndex, "_design/")
+		if parts := strings.SplitN(useIndex, "/", 2); len(parts) == 2 { // nolint:gomnd
+			query["use_index"] = parts
+		} else {
+			query["use_index"] = useIndex
+		}
+	}
+	return query, nil
+}
+
+// parseSort converts a list of field[:asc|:desc] values into a Mango sort
+// array.
+func parseSort(fields []string) ([]map[string]string, error) {
+	sort := make([]map[string]string, 0, len(fields))
+	for _, field := range fields {
+		dir := "asc"
+		if i := strings.LastIndex(field, ":"); i >= 0 {
+			field, dir = field[:i], strings.ToLower(field[i+1:])
+		}
+		if dir != "asc" && dir != "desc" {
+			return nil, errors.Codef(errors.ErrUsage, "invalid sort direction for %s: %s", field, dir)
+		}
+		sort = append(sort, map[string]string{field: dir})
+	}
+	return sort, nil
+}
+
+func (c *find) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	dsn, err := c.conf.URL()
+	if err != nil {
+		return err
+	}
+	db := ""
+	command, dsnDB := dbCommandFromDSN(dsn)
+	if pdb, partition, rest, ok := partitionFromDSN(dsn); ok {
+		command, dsnDB = rest, pdb
+		c.partition = partition
+	}
+	if command == "_find" || command == "_explain" {
+		db = dsnDB
+		c.explain = c.explain || command == "_explain"
+	}
+	if db == "" {
+		db, err = c.conf.DB()
+		if err != nil {
+			return err
+		}
+	}
+	query, err := c.query()
+	if err != nil {
+		return err
+	}
+	opts := append([]kivik.Option{c.opts()}, partitionOpts(c.partition)...)
+
+	if c.explain {
+		c.log.Debugf("[find] Will explain query: %s/%s", client.DSN(), db)
+		return c.retry(func() error {
+			plan, err := client.DB(db).Explain(cmd.Context(), query, opts...)
+			if err != nil {
+				return err
+			}
+			return c.fmt.Output(explainResult(plan))
+		})
+	}
+
+	c.log.Debugf("[find] Will query: %s/%s", client.DSN(), db)
+	docs := []json.RawMessage{}
+	var bookmark string
+	for {
+		pageSize := findPageSize
+		if c.limit > 0 && c.limit-len(docs) < pageSize {
+			pageSize = c.limit - len(docs)
+		}
+		query["limit"] = pageSize
+		if bookmark != "" {
+			query["bookmark"] = bookmark
+		}
+		var page []json.RawMessage
+		var meta *kivik.ResultMetadata
+		err := c.retry(func() error {
+			page = page[:0]
+			rs := client.DB(db).Find(cmd.Context(), query, opts...)
+			for rs.Next() {
+				var doc json.RawMessage
+				if err := rs.ScanDoc(&doc); err != nil {
+					return err
+				}
+				page = append(page, doc)
+			}
+			if err := rs.Err(); err != nil {
+				return err
+			}
+			var err error
+			meta, err = rs.Metadata()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if meta.Warning != "" {
+			c.log.Errorf("Warning: %s", meta.Warning)
+		}
+		docs = append(docs, page...)
+		if len(page) < pageSize || meta.Bookmark == "" || meta.Bookmark == bookmark {
+			break
+		}
+		if c.limit > 0 && len(docs) >= c.limit {
+			break
+		}
+		c.log.Debugf("[find] Following bookmark: %s", meta.Bookmark)
+		bookmark = meta.Bookmark
+	}
+
+	return c.fmt.Output(output.JSONReader(docs))
+}
+
+func explainResult(plan *kivik.QueryPlan) output.FriendlyOutput {
+	index := plan.Index
+	ddoc, _ := index["ddoc"].(string)
+	name, _ := index["name"].(string)
+	typ, _ := index["type"].(string)
+	data := struct {
+		DBName   string
+		Index    string
+		Type     string
+		Fields   string
+		FullScan bool
+		Limit    int64
+		Skip     int64
+		Selector string
+	}{
+		DBName:   plan.DBName,
+		Index:    strings.TrimPrefix(strings.Trim(ddoc+"/"+name, "/"), "_design/"),
+		Type:     typ,
+		Fields:   strings.Join(indexFields(index["def"]), ", "),
+		FullScan: typ == "special",
+		Limit:    plan.Limit,
+		Skip:     plan.Skip,
+	}
+	if selector, err := json.Marshal(plan.Selector); err == nil {
+		data.Selector = string(selector)
+	}
+
+	format := `Database: {{ .DBName }}
+   Index: {{ .Index }} ({{ .Type }})
+  Fields: {{ .Fields }}
+Selector: {{ .Selector }}
+   Limit: {{ .Limit }}
+    Skip: {{ .Skip }}
+{{- if .FullScan }}
+No matching index found; the query will scan all documents.
+{{- end }}`
+	return output.TemplateReader(format, data, output.JSONReader(plan))
+}
@@ -0,0 +1,171 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func Test_find_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing selector", cmdTest{
+		args:   []string{"find", "http://example.com/foo"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid selector", cmdTest{
+		args:   []string{"find", "http://example.com/foo", "--selector", "{"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid sort", cmdTest{
+		args:   []string{"find", "http://example.com/foo", "--selector", "{}", "--sort", "name:sideways"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("query options", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"docs":[{"_id":"foo","name":"Bob"}],"bookmark":"nil"}`)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_find" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+			if d := testy.DiffAsJSON(testy.Snapshot(t), req.Body); d != nil {
+				t.Error(d)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{
+				"find", s.URL + "/db", "--data", "name: Bob", "--yaml",
+				"--fields", "_id,name", "--sort", "name,age:desc", "--use-index", "_design/foo/bar",
+			},
+		}
+	})
+	tests.Add("partition", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"docs":[{"_id":"sensor:1","name":"Bob"}],"bookmark":"nil"}`)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_partition/sensor/_find" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"find", s.URL + "/db", "--selector", `{"name":"Bob"}`, "--partition", "sensor"},
+		}
+	})
+	tests.Add("partition from dsn", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"docs":[{"_id":"sensor:1","name":"Bob"}],"bookmark":"nil"}`)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_partition/sensor/_find" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"find", s.URL + "/db/_partition/sensor/_find", "--selector", `{"name":"Bob"}`},
+		}
+	})
+	tests.Add("follow bookmarks", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var query struct {
+				Bookmark string `json:"bookmark"`
+				Limit    int    `json:"limit"`
+			}
+			if err := json.NewDecoder(gunzipBody(t, r.Body)).Decode(&query); err != nil {
+				t.Fatal(err)
+			}
+			count, bookmark := query.Limit, "page2"
+			if query.Bookmark == "page2" {
+				count, bookmark = 2, "page3"
+			}
+			docs := make([]string, count)
+			for i := range docs {
+				docs[i] = fmt.Sprintf(`{"_id":"%s-%d"}`, query.Bookmark, i)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"docs":[%s],"bookmark":%q}`, strings.Join(docs, ","), bookmark)
+		}))
+
+		return cmdTest{
+			args: []string{"--debug", "find", s.URL + "/db", "--selector", `{"_id":{"$gt":null}}`, "-f", "raw"},
+		}
+	})
+	tests.Add("limit", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"docs":[{"_id":"foo"},{"_id":"bar"}],"bookmark":"xyz","warning":"No matching index found, create an index to optimize query time."}`)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if d := testy.DiffAsJSON(testy.Snapshot(t), req.Body); d != nil {
+				t.Error(d)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"find", s.URL + "/db", "--selector", `{}`, "--limit", "2"},
+		}
+	})
+	tests.Add("explain", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"dbname":"db","index":{"ddoc":"_design/foo","name":"by-name","type":"json","def":{"fields":[{"name":"asc"}]}},"selector":{"name":{"$eq":"Bob"}},"opts":{},"limit":25,"skip":0,"fields":"all_fields"}`)),
+		}, func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_explain" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"find", s.URL + "/db", "--selector", `{"name":"Bob"}`, "--explain"},
+		}
+	})
+	tests.Add("explain full scan", func(t *testing.T) interface{} {
+		s := testy.ServeResponse(&http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"dbname":"db","index":{"ddoc":null,"name":"_all_docs","type":"special","def":{"fields":[{"_id":"asc"}]}},"selector":{"name":{"$eq":"Bob"}},"opts":{},"limit":25,"skip":0,"fields":"all_fields"}`)),
+		})
+
+		return cmdTest{
+			args: []string{"find", s.URL + "/db/_explain", "--selector", `{"name":"Bob"}`},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
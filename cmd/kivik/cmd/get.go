@@ -17,7 +17,9 @@ import (
 )
 
 type get struct {
-	alldbs, att, doc, db, ver, cf, sec, cluster *cobra.Command
+	alldbs, att, doc, db, ver, cf, sec, cluster, idx, query *cobra.Command
+	changes, updates, revs, membership, stats, system       *cobra.Command
+	allDocs, part, tasks, scheduler, reps                   *cobra.Command
 	*root
 }
 
@@ -32,6 +34,20 @@ func getCmd(r *root) *cobra.Command {
 		cf:      getConfigCmd(r),
 		sec:     getSecurityCmd(r),
 		cluster: getClusterSetupCmd(r),
+		idx:     getIndexesCmd(r),
+		query:   queryCmd(r),
+		changes: getChangesCmd(r),
+		updates: getDBUpdatesCmd(r),
+		revs:    getRevsCmd(r),
+
+		membership: getMembershipCmd(r),
+		stats:      getNodeStatsCmd(r),
+		system:     getSystemCmd(r),
+		allDocs:    getAllDocsCmd(r),
+		part:       descrPartitionCmd(r),
+		tasks:      getActiveTasksCmd(r),
+		scheduler:  getSchedulerCmd(r),
+		reps:       getReplicationsCmd(r),
 	}
 	cmd := &cobra.Command{
 		Use:   "get [command]",
@@ -48,6 +64,19 @@ func getCmd(r *root) *cobra.Command {
 	cmd.AddCommand(g.cf)
 	cmd.AddCommand(g.sec)
 	cmd.AddCommand(g.cluster)
+	cmd.AddCommand(g.idx)
+	cmd.AddCommand(g.query)
+	cmd.AddCommand(g.changes)
+	cmd.AddCommand(g.updates)
+	cmd.AddCommand(g.revs)
+	cmd.AddCommand(g.membership)
+	cmd.AddCommand(g.stats)
+	cmd.AddCommand(g.system)
+	cmd.AddCommand(g.allDocs)
+	cmd.AddCommand(g.part)
+	cmd.AddCommand(g.tasks)
+	cmd.AddCommand(g.scheduler)
+	cmd.AddCommand(g.reps)
 
 	return cmd
 }
@@ -63,6 +92,30 @@ func (g *get) RunE(cmd *cobra.Command, args []string) error {
 	if _, ok := securityFromDSN(dsn); ok {
 		return g.sec.RunE(cmd, args)
 	}
+	if _, _, _, ok := indexFromDSN(dsn); ok {
+		return g.idx.RunE(cmd, args)
+	}
+	if _, _, _, _, ok := viewFromDSN(dsn); ok {
+		return g.query.RunE(cmd, args)
+	}
+	if _, _, ok := allDocsFromDSN(dsn); ok {
+		return g.allDocs.RunE(cmd, args)
+	}
+	if _, _, rest, ok := partitionFromDSN(dsn); ok && rest == "" {
+		return g.part.RunE(cmd, args)
+	}
+	if _, ok := changesFromDSN(dsn); ok {
+		return g.changes.RunE(cmd, args)
+	}
+	if _, ok := nodeFromDSN(dsn, "_stats"); ok {
+		return g.stats.RunE(cmd, args)
+	}
+	if _, ok := nodeFromDSN(dsn, "_system"); ok {
+		return g.system.RunE(cmd, args)
+	}
+	if _, _, ok := schedulerFromDSN(dsn); ok {
+		return g.scheduler.RunE(cmd, args)
+	}
 	if g.conf.HasAttachment() {
 		return g.att.RunE(cmd, args)
 	}
@@ -79,6 +132,12 @@ func (g *get) RunE(cmd *cobra.Command, args []string) error {
 			return g.alldbs.RunE(cmd, args)
 		case "_cluster_setup":
 			return g.cluster.RunE(cmd, args)
+		case "_db_updates":
+			return g.updates.RunE(cmd, args)
+		case "_membership":
+			return g.membership.RunE(cmd, args)
+		case "_active_tasks":
+			return g.tasks.RunE(cmd, args)
 		}
 		return g.db.RunE(cmd, args)
 	}
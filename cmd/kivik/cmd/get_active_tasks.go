@@ -0,0 +1,241 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type getActiveTasks struct {
+	*root
+	watcher
+}
+
+func getActiveTasksCmd(r *root) *cobra.Command {
+	c := &getActiveTasks{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "active-tasks [dsn]",
+		Aliases: []string{"tasks"},
+		Short:   "List running tasks",
+		Long: `Fetch the list of running tasks, such as compactions, indexers and replications, from /_active_tasks.
+
+In friendly mode, the progress and elapsed time of each task are summarized. Shards of clustered databases are shown by database name and shard range.`,
+		RunE: c.RunE,
+	}
+
+	c.watcher.flags(cmd.PersistentFlags())
+
+	return cmd
+}
+
+// activeTask is an entry from /_active_tasks.
+type activeTask struct {
+	Node           string `json:"node"`
+	PID            string `json:"pid"`
+	Type           string `json:"type"`
+	Database       string `json:"database"`
+	DesignDocument string `json:"design_document"`
+	Source         string `json:"source"`
+	Target         string `json:"target"`
+	Progress       *int   `json:"progress"`
+	StartedOn      int64  `json:"started_on"`
+	UpdatedOn      int64  `json:"updated_on"`
+}
+
+// taskFilter selects active tasks by type, database and design document.
+// Empty fields match any task.
+type taskFilter struct {
+	typ, db, ddoc string
+}
+
+func (f taskFilter) match(t activeTask) bool {
+	return (f.typ == "" || t.Type == f.typ) &&
+		(f.db == "" || shardDB(t.Database) == f.db) &&
+		(f.ddoc == "" || t.DesignDocument == "_design/"+strings.TrimPrefix(f.ddoc, "_design/"))
+}
+
+func (f taskFilter) String() string {
+	desc := "tasks"
+	if f.typ != "" {
+		desc = f.typ + " " + desc
+	}
+	if f.db != "" {
+		desc += " on " + f.db
+		if f.ddoc != "" {
+			desc += "/_design/" + strings.TrimPrefix(f.ddoc, "_design/")
+		}
+	}
+	return desc
+}
+
+// shardDB returns the name of the database of a shard, such as
+// shards/00000000-1fffffff/db.1600000000. Other names are returned as-is.
+func shardDB(name string) string {
+	parts := strings.SplitN(name, "/", 3) // nolint:gomnd
+	if len(parts) != 3 || parts[0] != "shards" {
+		return name
+	}
+	name = parts[2]
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// shardRange returns the range of a shard name, or "-" for other names.
+func shardRange(name string) string {
+	parts := strings.SplitN(name, "/", 3) // nolint:gomnd
+	if len(parts) != 3 || parts[0] != "shards" {
+		return "-"
+	}
+	return parts[1]
+}
+
+func (c *getActiveTasks) RunE(cmd *cobra.Command, _ []string) error {
+	if _, err := c.client(); err != nil {
+		return err
+	}
+	c.conf.Finalize()
+
+	return c.watchOutput(cmd.Context(), &c.watcher, func() (io.Reader, error) {
+		raw, err := c.rawActiveTasks(cmd.Context())
+		if err != nil {
+			return nil, err
+		}
+		var tasks []activeTask
+		if err := json.Unmarshal(raw, &tasks); err != nil {
+			return nil, errors.Code(errors.ErrProtocol, err)
+		}
+		rows := make([][]string, 0, len(tasks))
+		for _, task := range tasks {
+			detail := "-"
+			switch {
+			case task.DesignDocument != "":
+				detail = task.DesignDocument
+			case task.Source != "" || task.Target != "":
+				detail = task.Source + " → " + task.Target
+			}
+			progress := "-"
+			if task.Progress != nil {
+				progress = fmt.Sprintf("%d%%", *task.Progress)
+			}
+			database := "-"
+			if task.Database != "" {
+				database = shardDB(task.Database)
+			}
+			rows = append(rows, []string{
+				task.Type,
+				task.Node,
+				database,
+				shardRange(task.Database),
+				detail,
+				progress,
+				c.elapsed(time.Unix(task.StartedOn, 0)),
+			})
+		}
+		header := []string{"TYPE", "NODE", "DATABASE", "SHARD", "DETAIL", "PROGRESS", "ELAPSED"}
+		return output.TableReader(header, rows, output.JSONReader(raw)), nil
+	})
+}
+
+// elapsed formats the time elapsed since start.
+func (r *root) elapsed(start time.Time) string {
+	if start.IsZero() || start.Unix() == 0 {
+		return "-"
+	}
+	return r.now().Sub(start).Round(time.Second).String()
+}
+
+func (r *root) rawActiveTasks(ctx context.Context) (json.RawMessage, error) {
+	couch, err := r.couch()
+	if err != nil {
+		return nil, err
+	}
+	r.log.Debugf("[get] Will fetch active tasks: %s", couch.DSN())
+	var raw json.RawMessage
+	err = couch.DoJSON(ctx, http.MethodGet, "/_active_tasks", nil, &raw)
+	return raw, err
+}
+
+// activeTasks fetches the list of running tasks from /_active_tasks.
+func (r *root) activeTasks(ctx context.Context) ([]activeTask, error) {
+	raw, err := r.rawActiveTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []activeTask
+	if err := json.Unmarshal(raw, &tasks); err != nil {
+		return nil, errors.Code(errors.ErrProtocol, err)
+	}
+	return tasks, nil
+}
+
+// waitTasks polls /_active_tasks every interval, until no task matches
+// filter.
+func (r *root) waitTasks(ctx context.Context, filter taskFilter, interval time.Duration) error {
+	return r.pollTasks(ctx, filter, interval, func(tasks []activeTask) (bool, error) {
+		for _, task := range tasks {
+			if task.Progress != nil {
+				r.log.Debugf("[wait] %s on %s: %d%% complete", task.Type, task.Node, *task.Progress)
+			}
+		}
+		if len(tasks) == 0 {
+			return true, nil
+		}
+		r.log.Debugf("[wait] Waiting for %d %s", len(tasks), filter)
+		return false, nil
+	})
+}
+
+// pollTasks polls /_active_tasks every interval, passing the tasks that match
+// filter to check, until check reports that it is done, or returns an error.
+func (r *root) pollTasks(ctx context.Context, filter taskFilter, interval time.Duration, check func([]activeTask) (bool, error)) error {
+	for {
+		var tasks []activeTask
+		err := r.retry(func() error {
+			var err error
+			tasks, err = r.activeTasks(ctx)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		matched := make([]activeTask, 0, len(tasks))
+		for _, task := range tasks {
+			if filter.match(task) {
+				matched = append(matched, task)
+			}
+		}
+		if done, err := check(matched); done || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+const testActiveTasks = `[
+	{"node":"node1@127.0.0.1","pid":"<0.1.0>","type":"indexer","database":"shards/00000000-7fffffff/orders.1609459200","design_document":"_design/app","progress":42,"changes_done":420,"total_changes":1000,"started_on":1609502280,"updated_on":1609502390},
+	{"node":"node2@127.0.0.1","pid":"<0.2.0>","type":"database_compaction","database":"shards/80000000-ffffffff/logs.1609459200","progress":7,"started_on":1609502395,"updated_on":1609502399},
+	{"node":"node1@127.0.0.1","pid":"<0.3.0>","type":"replication","database":"shards/00000000-7fffffff/_replicator.1609459200","doc_id":"backup","source":"http://localhost:5984/orders/","target":"http://backup:5984/orders/","changes_pending":12,"started_on":1609495200,"updated_on":1609502399}
+]`
+
+func Test_get_active_tasks_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tasks := func(t *testing.T) *http.Response {
+		t.Helper()
+		return &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(testActiveTasks)),
+		}
+	}
+	validate := func(t *testing.T, req *http.Request) {
+		if req.URL.Path != "/_active_tasks" {
+			t.Errorf("Unexpected path: %s", req.URL.Path)
+		}
+	}
+
+	tests.Add("tasks", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, tasks(t), validate)
+
+		return cmdTest{
+			args: []string{"get", "active-tasks", s.URL},
+		}
+	})
+	tests.Add("json", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, tasks(t), validate)
+
+		return cmdTest{
+			args: []string{"get", "tasks", s.URL, "-f", "json"},
+		}
+	})
+	tests.Add("from dsn", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, tasks(t), validate)
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/_active_tasks"},
+		}
+	})
+	tests.Add("invalid interval", cmdTest{
+		args:   []string{"get", "active-tasks", "http://example.com/", "--watch", "--interval", "0"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("watch", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		var count int
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			count++
+			w.Header().Set("Content-Type", "application/json")
+			if count == 1 {
+				_, _ = io.WriteString(w, testActiveTasks)
+				return
+			}
+			_, _ = io.WriteString(w, "[]")
+		}))
+
+		return cmdTest{
+			args: []string{"get", "active-tasks", s.URL, "--watch", "--interval", "1ms", "--count", "2"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,115 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func Test_get_all_docs_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	allDocs := func(t *testing.T) *http.Response {
+		t.Helper()
+		return &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"total_rows":2,"offset":0,"rows":[{"id":"sensor:1","key":"sensor:1","value":{"rev":"1-abc"}},{"id":"sensor:2","key":"sensor:2","value":{"rev":"2-def"}}]}`)),
+		}
+	}
+
+	tests.Add("missing database", cmdTest{
+		args:   []string{"get", "all-docs"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("all docs", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, allDocs(t), func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_all_docs" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+			if want, got := "limit=1001", req.URL.RawQuery; want != got {
+				t.Errorf("Unexpected query: %s", got)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"get", "all-docs", s.URL + "/db"},
+		}
+	})
+	tests.Add("partition", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, allDocs(t), func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_partition/sensor/_all_docs" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"get", "all-docs", s.URL + "/db", "-p", "sensor", "-f", "json"},
+		}
+	})
+	tests.Add("auto get", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, allDocs(t), func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_all_docs" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/db/_all_docs"},
+		}
+	})
+	tests.Add("auto get partition", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, allDocs(t), func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_partition/sensor/_all_docs" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/db/_partition/sensor/_all_docs"},
+		}
+	})
+	tests.Add("paging", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/_all_docs?limit=3":
+				_, _ = io.WriteString(w, `{"total_rows":5,"offset":0,"rows":[{"id":"doc0","key":0,"value":"v0"},{"id":"doc1","key":1,"value":"v1"},{"id":"doc2","key":2,"value":"v2"}]}`)
+			case "GET /db/_all_docs?limit=3&skip=1&startkey=1&startkey_docid=doc1":
+				_, _ = io.WriteString(w, `{"total_rows":5,"offset":2,"rows":[{"id":"doc2","key":2,"value":"v2"},{"id":"doc3","key":3,"value":"v3"},{"id":"doc4","key":4,"value":"v4"}]}`)
+			case "GET /db/_all_docs?limit=3&skip=1&startkey=3&startkey_docid=doc3":
+				_, _ = io.WriteString(w, `{"total_rows":5,"offset":4,"rows":[{"id":"doc4","key":4,"value":"v4"}]}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"get", "all-docs", s.URL + "/db", "--page-size", "2", "-f", "raw"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
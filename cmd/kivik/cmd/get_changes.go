@@ -0,0 +1,360 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+	"github.com/go-kivik/kivik/v4/couchdb/chttp"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type getChanges struct {
+	*root
+	since, filter, selector, style string
+	docIDs                         []string
+	includeDocs, follow            bool
+	timeout, heartbeat             string
+}
+
+func getChangesCmd(r *root) *cobra.Command {
+	c := &getChanges{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:   "changes [dsn]/[database]",
+		Short: "Get a database's changes feed",
+		Long: `Fetch a database's changes feed.
+
+With --follow, changes are streamed as newline-delimited JSON, until interrupted, or until --timeout expires without any changes. If the connection is lost, and --retry is set, the feed is resumed from the last sequence received.
+
+--selector is sent to the server, as the body of a request with filter=_selector.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.since, "since", "", "Start the results from the change immediately after the given update sequence. Use 'now' to return only future changes.")
+	pf.StringVar(&c.filter, "filter", "", "Filter function, as [ddoc]/[filter]")
+	pf.StringVar(&c.selector, "selector", "", "Return only changes to documents matching this Mango selector, as a JSON object")
+	pf.StringSliceVar(&c.docIDs, "doc-ids", nil, "Return only changes to the specified document IDs. May be repeated, or comma-separated.")
+	pf.BoolVar(&c.includeDocs, "include-docs", false, "Include the associated document with each result")
+	pf.StringVar(&c.style, "style", "", "Number of revisions to return for each change. One of: main_only|all_docs")
+	pf.BoolVar(&c.follow, "follow", false, "Follow the changes feed, streaming changes as they occur")
+	pf.StringVar(&c.timeout, "timeout", "", "Maximum period to wait for a change before the feed is closed")
+	pf.StringVar(&c.heartbeat, "heartbeat", "", "Period after which an empty line is sent, to keep the connection open")
+
+	return cmd
+}
+
+// changesFromDSN parses a DSN in the form /{db}/_changes.
+func changesFromDSN(dsn *url.URL) (db string, ok bool) {
+	parts := strings.Split(dsn.Path, "/")
+	if len(parts) != 3 || parts[2] != "_changes" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// changesOpts builds the query options from the command line flags, and any
+// options passed in the DSN.
+func (c *getChanges) changesOpts() (map[string]interface{}, error) {
+	opts := make(map[string]interface{}, len(c.options))
+	for k, v := range c.options {
+		switch k {
+		case "selector":
+			if c.selector == "" {
+				c.selector = fmt.Sprint(v)
+			}
+		case "doc_ids":
+			if len(c.docIDs) == 0 {
+				c.docIDs = strings.Split(fmt.Sprint(v), ",")
+				if ids, ok := jsonOrString(fmt.Sprint(v)).(json.RawMessage); ok {
+					if err := json.Unmarshal(ids, &c.docIDs); err != nil {
+						return nil, errors.Code(errors.ErrUsage, "doc_ids must be a JSON array")
+					}
+				}
+			}
+		case "filter":
+			if c.filter == "" {
+				c.filter = fmt.Sprint(v)
+			}
+		case "include_docs":
+			c.includeDocs = c.includeDocs || fmt.Sprint(v) == "true"
+		case "feed":
+			if v == "continuous" {
+				c.follow = true
+			} else {
+				opts[k] = v
+			}
+		default:
+			opts[k] = v
+		}
+	}
+	if c.since != "" {
+		opts["since"] = c.since
+	}
+	if c.style != "" {
+		opts["style"] = c.style
+	}
+	for name, val := range map[string]string{"timeout": c.timeout, "heartbeat": c.heartbeat} {
+		d, err := parseDuration(val)
+		if err != nil {
+			return nil, err
+		}
+		if d > 0 {
+			opts[name] = int(d / time.Millisecond)
+		}
+	}
+	if c.selector != "" {
+		switch {
+		case c.filter != "" && c.filter != "_selector":
+			return nil, errors.Code(errors.ErrUsage, "--selector and --filter are mutually exclusive")
+		case len(c.docIDs) > 0:
+			return nil, errors.Code(errors.ErrUsage, "--selector and --doc-ids are mutually exclusive")
+		}
+		var sel map[string]interface{}
+		if err := json.Unmarshal([]byte(c.selector), &sel); err != nil {
+			return nil, errors.Code(errors.ErrUsage, fmt.Errorf("invalid selector: %w", err))
+		}
+		c.filter = "_selector"
+	}
+	if len(c.docIDs) > 0 {
+		if c.filter != "" && c.filter != "_doc_ids" {
+			return nil, errors.Code(errors.ErrUsage, "--doc-ids and --filter are mutually exclusive")
+		}
+		c.filter = "_doc_ids"
+		opts["doc_ids"] = c.docIDs
+	}
+	if c.filter != "" {
+		opts["filter"] = c.filter
+	}
+	if c.includeDocs {
+		opts["include_docs"] = true
+	}
+	return opts, nil
+}
+
+func (c *getChanges) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	dsn, err := c.conf.URL()
+	if err != nil {
+		return err
+	}
+	db, ok := changesFromDSN(dsn)
+	if ok {
+		c.conf.Finalize()
+	} else {
+		db, err = c.conf.DB()
+		if err != nil {
+			return err
+		}
+	}
+	opts, err := c.changesOpts()
+	if err != nil {
+		return err
+	}
+
+	if c.follow {
+		c.log.Debugf("[get] Will follow changes feed: %s/%s", client.DSN(), db)
+		r, w := io.Pipe()
+		go func() {
+			_ = w.CloseWithError(c.followChanges(cmd.Context(), client.DB(db), opts, w))
+		}()
+		return c.fmt.Stream(r)
+	}
+
+	c.log.Debugf("[get] Will fetch changes: %s/%s", client.DSN(), db)
+	return c.retry(func() error {
+		result, err := c.fetchChanges(cmd.Context(), client.DB(db), opts)
+		if err != nil {
+			return err
+		}
+
+		rows := make([][]string, 0, len(result.Results))
+		for _, row := range result.Results {
+			revs := make([]string, 0, len(row.Changes))
+			for _, rev := range row.Changes {
+				revs = append(revs, rev.Rev)
+			}
+			var deleted string
+			if row.Deleted {
+				deleted = "yes"
+			}
+			rows = append(rows, []string{shortSeq(string(row.Seq)), row.ID, strings.Join(revs, ", "), deleted})
+		}
+		return c.fmt.Output(output.TableReader([]string{"SEQ", "ID", "REVS", "DELETED"}, rows, output.JSONReader(result)))
+	})
+}
+
+// followChanges writes the changes feed to w, as NDJSON, until interrupted, or
+// until timeout expires without any changes. The feed is followed with
+// successive longpoll requests, as the driver cannot read the end of a
+// continuous feed. When a retry is necessary, the feed is resumed from the
+// last sequence received.
+func (c *getChanges) followChanges(ctx context.Context, db *kivik.DB, opts map[string]interface{}, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	opts["feed"] = "longpoll"
+	for {
+		var count int
+		err := c.retry(func() error {
+			result, err := c.fetchChanges(ctx, db, opts)
+			if err != nil {
+				return err
+			}
+			count = len(result.Results)
+			for _, row := range result.Results {
+				if err := enc.Encode(row); err != nil {
+					return err
+				}
+			}
+			opts["since"] = string(result.LastSeq)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if _, ok := opts["timeout"]; ok && count == 0 {
+			c.log.Debugf("[get] No changes received before timeout")
+			return nil
+		}
+	}
+}
+
+// fetchChanges reads a single response from the changes feed. With a
+// selector, which the driver cannot send, the request is made directly.
+func (c *getChanges) fetchChanges(ctx context.Context, db *kivik.DB, opts map[string]interface{}) (*changesResult, error) {
+	if c.selector != "" {
+		return c.selectorChanges(ctx, db.Name(), opts)
+	}
+	changes := db.Changes(ctx, kivik.Params(opts))
+	defer changes.Close() // nolint:errcheck
+	result := &changesResult{Results: []*changeRow{}}
+	for changes.Next() {
+		row, err := c.changeRow(changes)
+		if err != nil {
+			return nil, err
+		}
+		result.Results = append(result.Results, row)
+	}
+	if err := changes.Err(); err != nil {
+		return nil, err
+	}
+	meta, err := changes.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	result.LastSeq, result.Pending = changeSeq(meta.LastSeq), meta.Pending
+	return result, nil
+}
+
+// selectorChanges reads the changes feed of db, filtered by the selector,
+// which is sent in the request body.
+func (c *getChanges) selectorChanges(ctx context.Context, db string, opts map[string]interface{}) (*changesResult, error) {
+	couch, err := c.couch()
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	for k, v := range opts {
+		query.Set(k, fmt.Sprint(v))
+	}
+	result := &changesResult{Results: []*changeRow{}}
+	err = couch.DoJSON(ctx, http.MethodPost, "/"+url.PathEscape(db)+"/_changes", &chttp.Options{
+		Query:   query,
+		GetBody: chttp.BodyEncoder(map[string]interface{}{"selector": json.RawMessage(c.selector)}),
+	}, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// changeRow converts the current change to a changeRow.
+func (c *getChanges) changeRow(changes *kivik.Changes) (*changeRow, error) {
+	row := &changeRow{
+		Seq:     changeSeq(changes.Seq()),
+		ID:      changes.ID(),
+		Changes: make([]changeRev, 0, len(changes.Changes())),
+		Deleted: changes.Deleted(),
+	}
+	for _, rev := range changes.Changes() {
+		row.Changes = append(row.Changes, changeRev{Rev: rev})
+	}
+	if !c.includeDocs {
+		return row, nil
+	}
+	if err := changes.ScanDoc(&row.Doc); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+type changesResult struct {
+	Results []*changeRow `json:"results"`
+	LastSeq changeSeq    `json:"last_seq"`
+	Pending int64        `json:"pending"`
+}
+
+type changeRow struct {
+	Seq     changeSeq       `json:"seq"`
+	ID      string          `json:"id"`
+	Changes []changeRev     `json:"changes"`
+	Deleted bool            `json:"deleted,omitempty"`
+	Doc     json.RawMessage `json:"doc,omitempty"`
+}
+
+type changeRev struct {
+	Rev string `json:"rev"`
+}
+
+// changeSeq is an update sequence, which CouchDB 1.x sends as a number, and
+// later versions as a string.
+type changeSeq string
+
+func (s *changeSeq) UnmarshalJSON(p []byte) error {
+	var str string
+	if err := json.Unmarshal(p, &str); err == nil {
+		*s = changeSeq(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(p, &num); err != nil {
+		return err
+	}
+	*s = changeSeq(num)
+	return nil
+}
+
+// shortSeq returns the numeric prefix of a CouchDB 2.x+ sequence ID, which is
+// sufficient to identify a change in human-readable output.
+func shortSeq(seq string) string {
+	if i := strings.Index(seq, "-"); i > 0 {
+		return seq[:i]
+	}
+	return seq
+}
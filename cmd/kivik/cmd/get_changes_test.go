@@ -0,0 +1,180 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+const changesResponse = `{"results":[
+	{"seq":"1-g1AAAAFTeJzLYWBg4MhgTmHgz8tPSTV0MDQy1zMAQsMckEQiQ1L9____szKYE1lzgQLsZsYGyRZGydg04DEkjwVIMjQAqf9QM9jBZlikJKUmmxgZpWLTlgUAbbIiNw","id":"foo","changes":[{"rev":"1-abc"}],"doc":{"_id":"foo","_rev":"1-abc","name":"Bob"}},
+	{"seq":"2-g1AAAAFTeJzLYWBg4MhgTmHgz8tPSTV0MDQy1zMAQsMckEQiQ1L9____szKYE1lzgQLsZsYGyRZGydg04DEkjwVIMjQAqf9QM9jBZlikJKUmmxgZpWLTlgUAbbMiOA","id":"bar","changes":[{"rev":"2-def"}],"deleted":true,"doc":{"_id":"bar","_rev":"2-def","_deleted":true}},
+	{"seq":"3-g1AAAAFTeJzLYWBg4MhgTmHgz8tPSTV0MDQy1zMAQsMckEQiQ1L9____szKYE1lzgQLsZsYGyRZGydg04DEkjwVIMjQAqf9QM9jBZlikJKUmmxgZpWLTlgUAbbQiOQ","id":"baz","changes":[{"rev":"1-ghi"},{"rev":"1-jkl"}],"doc":{"_id":"baz","_rev":"1-ghi","name":"Alice"}}
+],"last_seq":"3-g1AAAAFTeJzLYWBg4MhgTmHgz8tPSTV0MDQy1zMAQsMckEQiQ1L9____szKYE1lzgQLsZsYGyRZGydg04DEkjwVIMjQAqf9QM9jBZlikJKUmmxgZpWLTlgUAbbQiOQ","pending":0}`
+
+func Test_get_changes_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing database", cmdTest{
+		args:   []string{"get", "changes"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid selector", cmdTest{
+		args:   []string{"get", "changes", "http://example.com/foo", "--selector", "{"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("selector and doc ids", cmdTest{
+		args:   []string{"get", "changes", "http://example.com/foo", "--selector", `{}`, "--doc-ids", "foo"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("selector and filter", cmdTest{
+		args:   []string{"get", "changes", "http://example.com/foo", "--selector", `{}`, "--filter", "foo/bar"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("success", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(changesResponse)),
+		}, func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_changes" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+			if want, got := "since=0&style=all_docs", req.URL.RawQuery; want != got {
+				t.Errorf("Unexpected query: %s", got)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"get", "changes", s.URL + "/db", "--since", "0", "--style", "all_docs"},
+		}
+	})
+	tests.Add("auto changes", func(t *testing.T) interface{} {
+		s := testy.ServeResponse(&http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(changesResponse)),
+		})
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/db/_changes", "-f", "json"},
+		}
+	})
+	tests.Add("doc ids", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"results":[],"last_seq":"0","pending":0}`)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if want, got := "filter=_doc_ids", req.URL.RawQuery; want != got {
+				t.Errorf("Unexpected query: %s", got)
+			}
+			if d := testy.DiffAsJSON(testy.Snapshot(t), req.Body); d != nil {
+				t.Error(d)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"get", "changes", s.URL + "/db", "--doc-ids", "foo,bar", "-f", "json"},
+		}
+	})
+	tests.Add("selector", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(changesResponse)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if req.Method != http.MethodPost {
+				t.Errorf("Unexpected method: %s", req.Method)
+			}
+			if want, got := "filter=_selector", req.URL.RawQuery; want != got {
+				t.Errorf("Unexpected query: %s", got)
+			}
+			if d := testy.DiffAsJSON(map[string]interface{}{"selector": map[string]interface{}{"name": map[string]interface{}{"$exists": true}}}, req.Body); d != nil {
+				t.Error(d)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"get", "changes", s.URL + "/db", "--selector", `{"name":{"$exists":true}}`, "-f", "json"},
+		}
+	})
+	tests.Add("follow with selector", func(t *testing.T) interface{} {
+		var count int
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.Header().Set("Content-Type", "application/json")
+			if want, got := "_selector", r.URL.Query().Get("filter"); want != got {
+				t.Errorf("Unexpected filter: %s", got)
+			}
+			switch count {
+			case 1:
+				_, _ = io.WriteString(w, `{"results":[{"seq":1,"id":"foo","changes":[{"rev":"1-abc"}],"doc":{"_id":"foo","name":"Bob"}}],"last_seq":1,"pending":0}`)
+			default:
+				if want, got := "1", r.URL.Query().Get("since"); want != got {
+					t.Errorf("Unexpected since: %s", got)
+				}
+				_, _ = io.WriteString(w, `{"results":[],"last_seq":1,"pending":0}`)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"get", "changes", s.URL + "/db", "--follow", "--selector", `{"name":"Bob"}`, "--include-docs", "--timeout", "1m"},
+		}
+	})
+	tests.Add("follow", func(t *testing.T) interface{} {
+		var count int
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.Header().Set("Content-Type", "application/json")
+			switch count {
+			case 1:
+				if want, got := "feed=longpoll&heartbeat=10000&since=now&timeout=60000", r.URL.RawQuery; want != got {
+					t.Errorf("Unexpected query: %s", got)
+				}
+				_, _ = io.WriteString(w, `{"results":[{"seq":"1-g1AAAA","id":"foo","changes":[{"rev":"1-abc"}]}],"last_seq":"1-g1AAAA","pending":1}`)
+			case 2:
+				if want, got := "1-g1AAAA", r.URL.Query().Get("since"); want != got {
+					t.Errorf("Unexpected since: %s", got)
+				}
+				_, _ = io.WriteString(w, `{"results":[{"seq":"2-g1AAAA","id":"bar","changes":[{"rev":"2-def"}],"deleted":true}],"last_seq":"2-g1AAAA","pending":0}`)
+			default:
+				_, _ = io.WriteString(w, `{"results":[],"last_seq":"2-g1AAAA","pending":0}`)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"get", "changes", s.URL + "/db", "--follow", "--since", "now", "--heartbeat", "10s", "--timeout", "1m"},
+		}
+	})
+	tests.Add("follow with json format", cmdTest{
+		args:   []string{"get", "changes", "http://example.com/db", "--follow", "-f", "json"},
+		status: errors.ErrUsage,
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,138 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4/couchdb/chttp"
+)
+
+type getDBUpdates struct {
+	*root
+	since, timeout, heartbeat string
+}
+
+func getDBUpdatesCmd(r *root) *cobra.Command {
+	c := &getDBUpdates{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "db-updates [dsn]",
+		Aliases: []string{"updates"},
+		Short:   "Follow the server's database updates feed",
+		Long: `Follow the server's /_db_updates feed, streaming database creation, update and deletion events as newline-delimited JSON, until interrupted, or until --timeout expires without any events.
+
+The feed is followed with successive longpoll requests. If the connection is lost, and --retry is set, the feed is resumed from the last sequence received, so no events are missed.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.since, "since", "", "Start with the event immediately after the given update sequence. Defaults to 'now', to return only future events.")
+	pf.StringVar(&c.timeout, "timeout", "", "Maximum period to wait for an event before the feed is closed")
+	pf.StringVar(&c.heartbeat, "heartbeat", "", "Period after which an empty line is sent, to keep the connection open")
+
+	return cmd
+}
+
+type dbUpdate struct {
+	DBName string    `json:"db_name"`
+	Type   string    `json:"type"`
+	Seq    changeSeq `json:"seq,omitempty"`
+}
+
+type dbUpdatesResult struct {
+	Results []dbUpdate `json:"results"`
+	LastSeq changeSeq  `json:"last_seq"`
+}
+
+// dbUpdatesQuery builds the query from the command line flags, and any
+// options passed in the DSN.
+func (c *getDBUpdates) dbUpdatesQuery() (url.Values, error) {
+	query := url.Values{}
+	for k, v := range c.options {
+		query.Set(k, fmt.Sprint(v))
+	}
+	switch {
+	case c.since != "":
+		query.Set("since", c.since)
+	case query.Get("since") == "":
+		query.Set("since", "now")
+	}
+	for name, val := range map[string]string{"timeout": c.timeout, "heartbeat": c.heartbeat} {
+		d, err := parseDuration(val)
+		if err != nil {
+			return nil, err
+		}
+		if d > 0 {
+			query.Set(name, fmt.Sprint(int(d/time.Millisecond)))
+		}
+	}
+	query.Set("feed", "longpoll")
+	return query, nil
+}
+
+func (c *getDBUpdates) RunE(cmd *cobra.Command, _ []string) error {
+	couch, err := c.couch()
+	if err != nil {
+		return err
+	}
+	c.conf.Finalize()
+	query, err := c.dbUpdatesQuery()
+	if err != nil {
+		return err
+	}
+
+	c.log.Debugf("[get] Will follow database updates: %s", couch.DSN())
+	r, w := io.Pipe()
+	go func() {
+		_ = w.CloseWithError(c.followUpdates(cmd.Context(), couch, query, w))
+	}()
+	return c.fmt.Stream(r)
+}
+
+// followUpdates writes the database updates feed to w, as NDJSON. When a retry
+// is necessary, the feed is resumed from the last sequence received.
+func (c *getDBUpdates) followUpdates(ctx context.Context, couch *chttp.Client, query url.Values, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for {
+		var result dbUpdatesResult
+		err := c.retry(func() error {
+			result = dbUpdatesResult{}
+			return couch.DoJSON(ctx, http.MethodGet, "/_db_updates", &chttp.Options{Query: query}, &result)
+		})
+		if err != nil {
+			return err
+		}
+		for _, update := range result.Results {
+			if err := enc.Encode(update); err != nil {
+				return err
+			}
+		}
+		if result.LastSeq != "" {
+			query.Set("since", string(result.LastSeq))
+		}
+		if query.Get("timeout") != "" && len(result.Results) == 0 {
+			c.log.Debugf("[get] No database updates received before timeout")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func Test_get_db_updates_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("success", func(t *testing.T) interface{} {
+		var count int
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			if r.URL.Path != "/_db_updates" {
+				t.Errorf("Unexpected path: %s", r.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			switch count {
+			case 1:
+				if want, got := "feed=longpoll&since=now&timeout=60000", r.URL.RawQuery; want != got {
+					t.Errorf("Unexpected query: %s", got)
+				}
+				_, _ = io.WriteString(w, `{"results":[{"db_name":"foo","type":"created","seq":"1-g1AAAA"},{"db_name":"foo","type":"updated","seq":"2-g1AAAA"}],"last_seq":"2-g1AAAA"}`)
+			case 2:
+				if want, got := "2-g1AAAA", r.URL.Query().Get("since"); want != got {
+					t.Errorf("Unexpected since: %s", got)
+				}
+				_, _ = io.WriteString(w, `{"results":[{"db_name":"bar","type":"deleted","seq":"3-g1AAAA"}],"last_seq":"3-g1AAAA"}`)
+			default:
+				_, _ = io.WriteString(w, `{"results":[],"last_seq":"3-g1AAAA"}`)
+			}
+		}))
+		t.Cleanup(s.Close)
+
+		return cmdTest{
+			args: []string{"get", "db-updates", s.URL, "--timeout", "1m"},
+		}
+	})
+	tests.Add("resume after error", func(t *testing.T) interface{} {
+		var count int
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count++
+			w.Header().Set("Content-Type", "application/json")
+			switch count {
+			case 1:
+				_, _ = io.WriteString(w, `{"results":[{"db_name":"foo","type":"created","seq":"1-g1AAAA"}],"last_seq":"1-g1AAAA"}`)
+			case 2:
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = io.WriteString(w, `{"error":"unavailable","reason":"try again"}`)
+			case 3:
+				if want, got := "1-g1AAAA", r.URL.Query().Get("since"); want != got {
+					t.Errorf("Unexpected since after retry: %s", got)
+				}
+				_, _ = io.WriteString(w, `{"results":[{"db_name":"foo","type":"updated","seq":"2-g1AAAA"}],"last_seq":"2-g1AAAA"}`)
+			default:
+				_, _ = io.WriteString(w, `{"results":[],"last_seq":"2-g1AAAA"}`)
+			}
+		}))
+		t.Cleanup(s.Close)
+
+		return cmdTest{
+			args: []string{"get", "db-updates", s.URL, "--timeout", "1m", "--retry", "1", "--retry-delay", "1ms"},
+		}
+	})
+	tests.Add("auto db updates", func(t *testing.T) interface{} {
+		s := testy.ServeResponse(&http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"results":[],"last_seq":"1-g1AAAA"}`)),
+		})
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/_db_updates?timeout=1000", "-f", "raw"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,126 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type getIndexes struct {
+	*root
+}
+
+func getIndexesCmd(r *root) *cobra.Command {
+	c := &getIndexes{
+		root: r,
+	}
+	return &cobra.Command{
+		Use:     "indexes [dsn]/[database]",
+		Aliases: []string{"index", "idx"},
+		Short:   "List a database's Mango indexes",
+		RunE:    c.RunE,
+	}
+}
+
+// indexFromDSN parses a DSN in the form /{db}/_index or
+// /{db}/_index/{ddoc}/json/{name}. ddoc is returned without the _design/
+// prefix.
+func indexFromDSN(dsn *url.URL) (db, ddoc, name string, ok bool) {
+	parts := strings.Split(dsn.Path, "/")
+	if len(parts) < 3 || parts[2] != "_index" {
+		return "", "", "", false
+	}
+	db = parts[1]
+	parts = parts[3:]
+	if len(parts) > 0 && parts[0] == "_design" {
+		parts = parts[1:]
+	}
+	switch len(parts) {
+	case 0:
+		return db, "", "", true
+	case 3: // nolint:gomnd
+		if parts[1] == "json" {
+			return db, parts[0], parts[2], true
+		}
+	}
+	return "", "", "", false
+}
+
+// indexDB returns the database name for one of the index commands, either
+// from an _index DSN, or from the current context.
+func (r *root) indexDB() (db, ddoc, name string, err error) {
+	dsn, err := r.conf.URL()
+	if err != nil {
+		return "", "", "", err
+	}
+	if db, ddoc, name, ok := indexFromDSN(dsn); ok {
+		r.conf.Finalize()
+		return db, ddoc, name, nil
+	}
+	db, err = r.conf.DB()
+	return db, "", "", err
+}
+
+// indexFields returns a human-readable list of the fields in an index
+// definition.
+func indexFields(def interface{}) []string {
+	obj, _ := def.(map[string]interface{})
+	list, _ := obj["fields"].([]interface{})
+	fields := make([]string, 0, len(list))
+	for _, field := range list {
+		switch t := field.(type) {
+		case map[string]interface{}:
+			for k, v := range t {
+				fields = append(fields, fmt.Sprintf("%s (%v)", k, v))
+			}
+		default:
+			fields = append(fields, fmt.Sprint(t))
+		}
+	}
+	return fields
+}
+
+func (c *getIndexes) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, _, _, err := c.indexDB()
+	if err != nil {
+		return err
+	}
+
+	c.log.Debugf("[get] Will fetch indexes: %s/%s", client.DSN(), db)
+	return c.retry(func() error {
+		indexes, err := client.DB(db).GetIndexes(cmd.Context(), c.opts())
+		if err != nil {
+			return err
+		}
+		rows := make([][]string, 0, len(indexes))
+		for _, idx := range indexes {
+			ddoc := idx.DesignDoc
+			if ddoc == "" {
+				ddoc = "-"
+			}
+			rows = append(rows, []string{ddoc, idx.Name, idx.Type, strings.Join(indexFields(idx.Definition), ", ")})
+		}
+		result := output.TableReader([]string{"DDOC", "NAME", "TYPE", "FIELDS"}, rows, output.JSONReader(indexes))
+		return c.fmt.Output(result)
+	})
+}
@@ -0,0 +1,71 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+const indexesResponse = `{"total_rows":3,"indexes":[
+	{"ddoc":null,"name":"_all_docs","type":"special","def":{"fields":[{"_id":"asc"}]}},
+	{"ddoc":"_design/foo","name":"by-name","type":"json","def":{"fields":[{"name":"asc"}],"partial_filter_selector":{}}},
+	{"ddoc":"_design/foo","name":"by-age","type":"json","def":{"fields":[{"age":"desc"},{"name":"asc"}]}}
+]}`
+
+func Test_get_indexes_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing database", cmdTest{
+		args:   []string{"get", "indexes"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("success", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(indexesResponse)),
+		}, func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_index" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"get", "indexes", s.URL + "/db"},
+		}
+	})
+	tests.Add("auto indexes", func(t *testing.T) interface{} {
+		s := testy.ServeResponse(&http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(indexesResponse)),
+		})
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/db/_index", "-f", "json"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,98 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type getMembership struct {
+	*root
+}
+
+func getMembershipCmd(r *root) *cobra.Command {
+	c := &getMembership{
+		root: r,
+	}
+	return &cobra.Command{
+		Use:     "membership [dsn]",
+		Aliases: []string{"nodes"},
+		Short:   "Get cluster membership",
+		Long: `Fetch the nodes known to the cluster.
+
+In friendly mode, nodes which are connected but not configured as cluster members, and cluster members which are not connected, are highlighted.`,
+		RunE: c.RunE,
+	}
+}
+
+func (c *getMembership) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	c.log.Debugf("[get] Will fetch cluster membership: %s", client.DSN())
+	return c.retry(func() error {
+		membership, err := client.Membership(cmd.Context())
+		if err != nil {
+			return err
+		}
+		return c.fmt.Output(output.TableReader([]string{"NODE", "CONNECTED", "MEMBER", "STATUS"},
+			membershipRows(membership.AllNodes, membership.ClusterNodes),
+			output.JSONReader(membership)))
+	})
+}
+
+// membershipRows returns one row per node, noting any node found in only one
+// of allNodes and clusterNodes.
+func membershipRows(allNodes, clusterNodes []string) [][]string {
+	type state struct{ connected, member bool }
+	nodes := map[string]*state{}
+	node := func(name string) *state {
+		if s, ok := nodes[name]; ok {
+			return s
+		}
+		s := &state{}
+		nodes[name] = s
+		return s
+	}
+	for _, name := range allNodes {
+		node(name).connected = true
+	}
+	for _, name := range clusterNodes {
+		node(name).member = true
+	}
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	yesNo := map[bool]string{true: "yes", false: "no"}
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		s := nodes[name]
+		status := "ok"
+		switch {
+		case !s.connected:
+			status = "not connected"
+		case !s.member:
+			status = "not a cluster member"
+		}
+		rows = append(rows, []string{name, yesNo[s.connected], yesNo[s.member], status})
+	}
+	return rows
+}
@@ -0,0 +1,68 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func Test_get_membership_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	membership := func(t *testing.T) *http.Response {
+		t.Helper()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"all_nodes":["node1@127.0.0.1","node2@127.0.0.1","node4@127.0.0.1"],"cluster_nodes":["node1@127.0.0.1","node2@127.0.0.1","node3@127.0.0.1"]}`)),
+		}
+	}
+	validate := func(t *testing.T, req *http.Request) {
+		if req.URL.Path != "/_membership" {
+			t.Errorf("unexpected path: %s", req.URL.Path)
+		}
+	}
+
+	tests.Add("membership", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, membership(t), validate)
+
+		return cmdTest{
+			args: []string{"get", "membership", s.URL},
+		}
+	})
+	tests.Add("json", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, membership(t), validate)
+
+		return cmdTest{
+			args: []string{"get", "membership", s.URL, "-f", "json"},
+		}
+	})
+	tests.Add("from dsn", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, membership(t), validate)
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/_membership"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,146 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type getNodeStats struct {
+	*root
+	node string
+}
+
+func getNodeStatsCmd(r *root) *cobra.Command {
+	c := &getNodeStats{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "node-stats [dsn]",
+		Aliases: []string{"stats"},
+		Short:   "Get node statistics",
+		Long: `Fetch the statistics of a node, from /_node/{node}/_stats.
+
+In friendly mode, the request count and request latencies of the node are summarized.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVarP(&c.node, "node", "n", "_local", "Specify the node name to query")
+
+	return cmd
+}
+
+// nodeFromDSN returns the node name, if the DSN's path is
+// /_node/{node}/{endpoint}.
+func nodeFromDSN(dsn *url.URL, endpoint string) (string, bool) {
+	parts := strings.Split(strings.TrimSuffix(dsn.Path, "/"), "/")
+	if len(parts) != 4 || parts[1] != "_node" || parts[3] != endpoint { // nolint:gomnd
+		return "", false
+	}
+	return parts[2], true
+}
+
+// nodeStats is the subset of /_node/{node}/_stats summarized in friendly mode.
+type nodeStats struct {
+	CouchDB struct {
+		RequestTime struct {
+			Value struct {
+				Mean       float64     `json:"arithmetic_mean"`
+				Median     float64     `json:"median"`
+				Percentile [][]float64 `json:"percentile"`
+			} `json:"value"`
+		} `json:"request_time"`
+		HTTPd struct {
+			Requests struct {
+				Value float64 `json:"value"`
+			} `json:"requests"`
+		} `json:"httpd"`
+	} `json:"couchdb"`
+}
+
+// percentile returns the request time at percentile p, or false if it is not
+// reported.
+func (s *nodeStats) percentile(p float64) (float64, bool) {
+	for _, pair := range s.CouchDB.RequestTime.Value.Percentile {
+		if len(pair) == 2 && pair[0] == p { // nolint:gomnd
+			return pair[1], true
+		}
+	}
+	return 0, false
+}
+
+func (c *getNodeStats) RunE(cmd *cobra.Command, _ []string) error {
+	dsn, err := c.conf.URL()
+	if err != nil {
+		return err
+	}
+	c.conf.Finalize()
+	if node, ok := nodeFromDSN(dsn, "_stats"); ok {
+		c.node = node
+	}
+
+	return c.retry(func() error {
+		result, err := c.nodeEndpoint(cmd.Context(), c.node, "_stats")
+		if err != nil {
+			return err
+		}
+		var stats nodeStats
+		if err := json.Unmarshal(result, &stats); err != nil {
+			return errors.Code(errors.ErrProtocol, err)
+		}
+		latency := stats.CouchDB.RequestTime.Value
+		row := []string{
+			c.node,
+			fmt.Sprintf("%.0f", stats.CouchDB.HTTPd.Requests.Value),
+			formatMillis(latency.Mean),
+			formatMillis(latency.Median),
+		}
+		for _, p := range []float64{90, 99} {
+			value, ok := stats.percentile(p)
+			if !ok {
+				row = append(row, "-")
+				continue
+			}
+			row = append(row, formatMillis(value))
+		}
+		header := []string{"NODE", "REQUESTS", "MEAN", "MEDIAN", "P90", "P99"}
+		return c.fmt.Output(output.TableReader(header, [][]string{row}, output.JSONReader(result)))
+	})
+}
+
+// nodeEndpoint fetches /_node/{node}/{endpoint}.
+func (r *root) nodeEndpoint(ctx context.Context, node, endpoint string) (json.RawMessage, error) {
+	couch, err := r.couch()
+	if err != nil {
+		return nil, err
+	}
+	r.log.Debugf("[get] Will fetch %s: %s/_node/%s", endpoint, couch.DSN(), node)
+	var result json.RawMessage
+	err = couch.DoJSON(ctx, http.MethodGet, "/_node/"+url.PathEscape(node)+"/"+endpoint, nil, &result)
+	return result, err
+}
+
+func formatMillis(ms float64) string {
+	return fmt.Sprintf("%.1fms", ms)
+}
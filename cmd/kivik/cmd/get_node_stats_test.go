@@ -0,0 +1,81 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func nodeStatsResponse(node string) string {
+	n := len(node)
+	return fmt.Sprintf(`{"couchdb":{"httpd":{"requests":{"value":%d,"type":"counter","desc":"number of HTTP requests"}},"request_time":{"value":{"min":0.5,"max":120.25,"arithmetic_mean":%d.25,"median":%d.5,"percentile":[[50,4.5],[75,8],[90,%d],[95,30],[99,%d.75],[999,110]],"n":1000},"type":"histogram","desc":"length of a request inside CouchDB without MochiWeb"}}}`, n*100, n, n, n*4, n*10)
+}
+
+func Test_get_node_stats_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("local", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, nodeStatsResponse("_local")), expectRequest("GET /_node/_local/_stats"))
+
+		return cmdTest{
+			args: []string{"get", "node-stats", s.URL},
+		}
+	})
+	tests.Add("node", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, nodeStatsResponse("couchdb@node1")), expectRequest("GET /_node/couchdb@node1/_stats"))
+
+		return cmdTest{
+			args: []string{"get", "node-stats", s.URL, "--node", "couchdb@node1"},
+		}
+	})
+	tests.Add("json", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, nodeStatsResponse("foo")), expectRequest("GET /_node/foo/_stats"))
+
+		return cmdTest{
+			args: []string{"get", "node-stats", s.URL, "-n", "foo", "-f", "json"},
+		}
+	})
+	tests.Add("from dsn", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, nodeStatsResponse("couchdb@node1")), expectRequest("GET /_node/couchdb@node1/_stats"))
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/_node/couchdb@node1/_stats"},
+		}
+	})
+	tests.Add("not found", func(t *testing.T) interface{} {
+		s := testy.ServeResponse(&http.Response{
+			StatusCode: http.StatusNotFound,
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"error":"not_found","reason":"missing"}`)),
+		})
+
+		return cmdTest{
+			args:   []string{"get", "node-stats", s.URL, "-n", "bogus"},
+			status: errors.ErrNotFound,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,203 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+const defaultReplicatorDB = "_replicator"
+
+type getReplications struct {
+	*root
+	replicatorDB string
+}
+
+func getReplicationsCmd(r *root) *cobra.Command {
+	c := &getReplications{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "replications [dsn]/[replicator-db]/[name]",
+		Aliases: []string{"replication", "reps"},
+		Short:   "List persistent replications",
+		Long: `List the replication documents stored in a replicator database, along with the state of each replication, as reported by /_scheduler/docs.
+
+Credentials are omitted from the source and target of each replication, in all output formats. To fetch a single replication document in full, use 'get document'.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.replicatorDB, "replicator-db", defaultReplicatorDB, "Replicator database, if not included in the DSN")
+
+	return cmd
+}
+
+// replication summarizes a replication document and its scheduler state.
+type replication struct {
+	ID          string         `json:"id"`
+	Source      string         `json:"source"`
+	Target      string         `json:"target"`
+	Continuous  bool           `json:"continuous"`
+	State       string         `json:"state"`
+	ErrorCount  int            `json:"error_count"`
+	LastUpdated string         `json:"last_updated,omitempty"`
+	Info        *schedulerInfo `json:"info,omitempty"`
+}
+
+// replicationDoc is a document in a replicator database.
+type replicationDoc struct {
+	ID               string      `json:"_id"`
+	Source           interface{} `json:"source"`
+	Target           interface{} `json:"target"`
+	Continuous       bool        `json:"continuous"`
+	ReplicationState string      `json:"_replication_state"`
+}
+
+func (c *getReplications) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, name, err := c.replicatorDoc(c.replicatorDB)
+	if err != nil {
+		return err
+	}
+
+	c.log.Debugf("[get] Will list replications: %s/%s", client.DSN(), db)
+	return c.retry(func() error {
+		var docs []replicationDoc
+		rows := client.DB(db).AllDocs(cmd.Context(), kivik.Param("include_docs", true))
+		defer rows.Close() // nolint:errcheck
+		for rows.Next() {
+			id, err := rows.ID()
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(id, "_design/") || (name != "" && id != name) {
+				continue
+			}
+			var doc replicationDoc
+			if err := rows.ScanDoc(&doc); err != nil {
+				return err
+			}
+			docs = append(docs, doc)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		var result struct {
+			Docs []schedulerDoc `json:"docs"`
+		}
+		if _, err := c.schedulerGet(cmd.Context(), "/_scheduler/docs/"+url.PathEscape(db), &result); err != nil {
+			return err
+		}
+		states := make(map[string]int, len(result.Docs))
+		for i, doc := range result.Docs {
+			states[doc.DocID] = i
+		}
+
+		reps := make([]replication, 0, len(docs))
+		for _, doc := range docs {
+			rep := replication{
+				ID:         doc.ID,
+				Source:     redactEndpoint(doc.Source),
+				Target:     redactEndpoint(doc.Target),
+				Continuous: doc.Continuous,
+				State:      doc.ReplicationState,
+			}
+			if i, ok := states[doc.ID]; ok {
+				status := result.Docs[i]
+				rep.State = status.State
+				rep.ErrorCount = status.ErrorCount
+				rep.LastUpdated = status.LastUpdated
+				rep.Info = status.Info
+			}
+			if rep.State == "" {
+				rep.State = "-"
+			}
+			reps = append(reps, rep)
+		}
+		sort.Slice(reps, func(i, j int) bool { return reps[i].ID < reps[j].ID })
+
+		table := make([][]string, 0, len(reps))
+		for _, rep := range reps {
+			typ := "one-shot"
+			if rep.Continuous {
+				typ = "continuous"
+			}
+			pending, reason := "-", ""
+			if rep.Info != nil {
+				if rep.Info.ChangesPending != nil {
+					pending = strconv.FormatInt(*rep.Info.ChangesPending, 10)
+				}
+				reason = rep.Info.Error
+			}
+			table = append(table, []string{rep.ID, rep.Source, rep.Target, typ, rep.State, pending, reason})
+		}
+		header := []string{"NAME", "SOURCE", "TARGET", "TYPE", "STATE", "PENDING", "ERROR"}
+		return c.fmt.Output(output.TableReader(header, table, output.JSONReader(reps)))
+	})
+}
+
+// replicatorDoc returns the replicator database and replication name from
+// the DSN. The database is taken from the DSN only if it is a replicator
+// database, that is, named _replicator or ending in /_replicator. Otherwise
+// def is used, and the last path element is taken as the name.
+func (r *root) replicatorDoc(def string) (db, name string, err error) {
+	db, name, err = r.conf.DBDoc()
+	if err != nil {
+		return "", "", err
+	}
+	switch {
+	case name == defaultReplicatorDB:
+		return db + "/" + name, "", nil
+	case isReplicatorDB(db):
+		return db, name, nil
+	case name == "":
+		return def, db, nil
+	}
+	return def, name, nil
+}
+
+func isReplicatorDB(db string) bool {
+	return db == defaultReplicatorDB || strings.HasSuffix(db, "/"+defaultReplicatorDB)
+}
+
+// redactEndpoint returns the URL of a replication source or target, which
+// may be a URL or an object with a url field, with any password masked.
+func redactEndpoint(endpoint interface{}) string {
+	if obj, ok := endpoint.(map[string]interface{}); ok {
+		endpoint = obj["url"]
+	}
+	addr, _ := endpoint.(string)
+	u, err := url.Parse(addr)
+	if err != nil || u.User == nil {
+		return addr
+	}
+	if _, ok := u.User.Password(); !ok {
+		return u.String()
+	}
+	u.User = url.User(u.User.Username())
+	return strings.Replace(u.String(), "@", ":*****@", 1)
+}
@@ -0,0 +1,304 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type getRevs struct {
+	*root
+}
+
+func getRevsCmd(r *root) *cobra.Command {
+	c := &getRevs{
+		root: r,
+	}
+	return &cobra.Command{
+		Use:     "revs [dsn]/[database]/[document]",
+		Aliases: []string{"revisions", "rev-tree"},
+		Short:   "Get a document's revision tree",
+		Long: `Fetch a document's revision tree, including all leaf revisions, conflicts, deleted leaves, and the availability of each revision's body.
+
+In friendly mode, the tree is rendered as a graph, with the winning revision and any conflicting or deleted leaves annotated.`,
+		RunE: c.RunE,
+	}
+}
+
+// revsInfoDoc is the document metadata returned with revs_info=true and
+// conflicts=true.
+type revsInfoDoc struct {
+	Rev              string    `json:"_rev"`
+	RevsInfo         []revInfo `json:"_revs_info"`
+	Conflicts        []string  `json:"_conflicts"`
+	DeletedConflicts []string  `json:"_deleted_conflicts"`
+}
+
+type revInfo struct {
+	Rev    string `json:"rev"`
+	Status string `json:"status"`
+}
+
+// revLeaf is a leaf revision, as returned with open_revs=all and revs=true.
+type revLeaf struct {
+	Rev       string `json:"_rev"`
+	Deleted   bool   `json:"_deleted"`
+	Revisions struct {
+		Start int      `json:"start"`
+		IDs   []string `json:"ids"`
+	} `json:"_revisions"`
+}
+
+type revTree struct {
+	ID               string     `json:"id"`
+	Winner           string     `json:"winner"`
+	Conflicts        []string   `json:"conflicts,omitempty"`
+	DeletedConflicts []string   `json:"deleted_conflicts,omitempty"`
+	Tree             []*revNode `json:"tree"`
+}
+
+type revNode struct {
+	Rev      string     `json:"rev"`
+	Status   string     `json:"status,omitempty"`
+	Leaf     bool       `json:"leaf,omitempty"`
+	Winner   bool       `json:"winner,omitempty"`
+	Deleted  bool       `json:"deleted,omitempty"`
+	Children []*revNode `json:"children,omitempty"`
+}
+
+func (c *getRevs) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, docID, err := c.conf.DBDoc()
+	if err != nil {
+		return err
+	}
+
+	c.log.Debugf("[get] Will fetch revision tree: %s/%s/%s", client.DSN(), db, docID)
+	return c.retry(func() error {
+		tree, err := c.revTree(cmd.Context(), client.DB(db), docID)
+		if err != nil {
+			return err
+		}
+		var buf strings.Builder
+		writeRevTree(&buf, tree.Tree)
+		result := output.TemplateReader(`{{ . }}`, buf.String(), output.JSONReader(tree))
+		return c.fmt.Output(result)
+	})
+}
+
+func (c *getRevs) revTree(ctx context.Context, db *kivik.DB, docID string) (*revTree, error) {
+	docs, err := openRevs(ctx, db, docID, c.opts(), kivik.Param("revs", true))
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, errors.Codef(errors.ErrNotFound, "%s: not found", docID)
+	}
+	leaves := make([]revLeaf, len(docs))
+	for i, doc := range docs {
+		if err := json.Unmarshal(doc, &leaves[i]); err != nil {
+			return nil, errors.Code(errors.ErrProtocol, err)
+		}
+	}
+
+	winner, err := winningRev(ctx, db, docID)
+	if err != nil {
+		return nil, err
+	}
+	// The winner is requested by revision, as a plain GET fails when the
+	// winning leaf is deleted.
+	var info revsInfoDoc
+	err = db.Get(ctx, docID, c.opts(), kivik.Params(map[string]interface{}{
+		"rev":               winner,
+		"revs_info":         true,
+		"conflicts":         true,
+		"deleted_conflicts": true,
+	})).ScanDoc(&info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revTree{
+		ID:               docID,
+		Winner:           info.Rev,
+		Conflicts:        info.Conflicts,
+		DeletedConflicts: info.DeletedConflicts,
+		Tree:             buildRevTree(info, leaves),
+	}, nil
+}
+
+// winningRev returns the winning revision of a document, as reported by the
+// changes feed, which includes documents whose winning leaf is deleted.
+func winningRev(ctx context.Context, db *kivik.DB, docID string) (string, error) {
+	changes := db.Changes(ctx, kivik.Params(map[string]interface{}{
+		"filter":  "_doc_ids",
+		"doc_ids": []string{docID},
+	}))
+	defer changes.Close() // nolint:errcheck
+	for changes.Next() {
+		if changes.ID() == docID && len(changes.Changes()) > 0 {
+			return changes.Changes()[0], nil
+		}
+	}
+	if err := changes.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.Codef(errors.ErrNotFound, "%s: not found", docID)
+}
+
+// openRevs returns all leaf revisions of a document.
+func openRevs(ctx context.Context, db *kivik.DB, docID string, options ...kivik.Option) ([]json.RawMessage, error) {
+	rs := db.Get(ctx, docID, append(options, kivik.Param("open_revs", "all"))...)
+	defer rs.Close() // nolint:errcheck
+	var docs []json.RawMessage
+	for rs.Next() {
+		var doc json.RawMessage
+		if err := rs.ScanDoc(&doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rs.Err()
+}
+
+// buildRevTree assembles the revision tree from the history of each leaf.
+// As revision histories may be truncated by the database's revs_limit, the
+// tree may have more than one root.
+func buildRevTree(info revsInfoDoc, leaves []revLeaf) []*revNode {
+	status := make(map[string]string, len(info.RevsInfo))
+	for _, ri := range info.RevsInfo {
+		status[ri.Rev] = ri.Status
+	}
+	nodes := map[string]*revNode{}
+	node := func(rev string) *revNode {
+		if n, ok := nodes[rev]; ok {
+			return n
+		}
+		n := &revNode{Rev: rev, Status: status[rev]}
+		nodes[rev] = n
+		return n
+	}
+	var roots []*revNode
+	for _, leaf := range leaves {
+		start, ids := leaf.Revisions.Start, leaf.Revisions.IDs
+		if len(ids) == 0 {
+			var id string
+			start, id = parseRev(leaf.Rev)
+			ids = []string{id}
+		}
+		var parent *revNode
+		// ids are ordered from the leaf to the oldest known ancestor.
+		for i := len(ids) - 1; i >= 0; i-- {
+			rev := fmt.Sprintf("%d-%s", start-i, ids[i])
+			_, exists := nodes[rev]
+			n := node(rev)
+			switch {
+			case parent == nil && !exists:
+				roots = append(roots, n)
+			case parent != nil && !exists:
+				parent.Children = append(parent.Children, n)
+			}
+			parent = n
+		}
+		parent.Leaf = true
+		parent.Deleted = leaf.Deleted
+		parent.Winner = parent.Rev == info.Rev
+	}
+	sortRevNodes(roots)
+	return roots
+}
+
+func sortRevNodes(nodes []*revNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return revLess(nodes[i].Rev, nodes[j].Rev)
+	})
+	for _, n := range nodes {
+		sortRevNodes(n.Children)
+	}
+}
+
+// parseRev splits a revision into its generation and hash.
+func parseRev(rev string) (int, string) {
+	parts := strings.SplitN(rev, "-", 2) // nolint:gomnd
+	n, _ := strconv.Atoi(parts[0])
+	if len(parts) == 1 {
+		return n, ""
+	}
+	return n, parts[1]
+}
+
+// revLess orders revisions by generation, then by hash.
+func revLess(a, b string) bool {
+	an, ah := parseRev(a)
+	bn, bh := parseRev(b)
+	if an != bn {
+		return an < bn
+	}
+	return ah < bh
+}
+
+// writeRevTree renders the tree as an ASCII graph.
+func writeRevTree(w *strings.Builder, roots []*revNode) {
+	for _, n := range roots {
+		fmt.Fprintf(w, "%s%s\n", n.Rev, revLabels(n))
+		writeRevBranches(w, n.Children, "")
+	}
+}
+
+func writeRevBranches(w *strings.Builder, nodes []*revNode, prefix string) {
+	for i, n := range nodes {
+		branch, indent := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Fprintf(w, "%s%s%s%s\n", prefix, branch, n.Rev, revLabels(n))
+		writeRevBranches(w, n.Children, prefix+indent)
+	}
+}
+
+func revLabels(n *revNode) string {
+	var labels []string
+	switch {
+	case n.Winner:
+		labels = append(labels, "winner")
+	case n.Leaf && !n.Deleted:
+		labels = append(labels, "conflict")
+	}
+	if n.Leaf && n.Deleted {
+		labels = append(labels, "deleted")
+	}
+	switch n.Status {
+	case "", "available", "deleted":
+	default:
+		labels = append(labels, n.Status)
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(labels, ", ") + ")"
+}
@@ -0,0 +1,156 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// multipartLeaves returns the leaves as an open_revs=all multipart response
+// body, with the boundary abc123.
+func multipartLeaves(leaves ...string) string {
+	var body strings.Builder
+	for _, leaf := range leaves {
+		body.WriteString("--abc123\r\nContent-Type: application/json\r\n\r\n" + leaf + "\r\n")
+	}
+	body.WriteString("--abc123--")
+	return body.String()
+}
+
+func Test_get_revs_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	// Two conflicting leaves, and one deleted leaf.
+	conflicted := multipartLeaves(
+		`{"_id":"foo","_rev":"3-ccc","_revisions":{"start":3,"ids":["ccc","bbb","aaa"]}}`,
+		`{"_id":"foo","_rev":"3-ddd","_revisions":{"start":3,"ids":["ddd","bbb","aaa"]}}`,
+		`{"_id":"foo","_rev":"4-fff","_deleted":true,"_revisions":{"start":4,"ids":["fff","eee","bbb","aaa"]}}`,
+	)
+
+	tests.Add("missing document", cmdTest{
+		args:   []string{"get", "revs"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("tree", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery {
+			case "GET /db/foo?open_revs=all&revs=true":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, conflicted)
+			case "POST /db/_changes?filter=_doc_ids":
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"results":[{"seq":"5-g1AAAA","id":"foo","changes":[{"rev":"3-ddd"}]}],"last_seq":"5-g1AAAA"}`)
+			case "GET /db/foo?conflicts=true&deleted_conflicts=true&rev=3-ddd&revs_info=true":
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"_id":"foo","_rev":"3-ddd","_revs_info":[{"rev":"3-ddd","status":"available"},{"rev":"2-bbb","status":"available"},{"rev":"1-aaa","status":"missing"}],"_conflicts":["3-ccc"],"_deleted_conflicts":["4-fff"]}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"get", "revs", s.URL + "/db/foo"},
+		}
+	})
+	tests.Add("json", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery {
+			case "GET /db/foo?open_revs=all&revs=true":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, conflicted)
+			case "POST /db/_changes?filter=_doc_ids":
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"results":[{"seq":"5-g1AAAA","id":"foo","changes":[{"rev":"3-ddd"}]}],"last_seq":"5-g1AAAA"}`)
+			case "GET /db/foo?conflicts=true&deleted_conflicts=true&rev=3-ddd&revs_info=true":
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"_id":"foo","_rev":"3-ddd","_revs_info":[{"rev":"3-ddd","status":"available"},{"rev":"2-bbb","status":"available"},{"rev":"1-aaa","status":"missing"}],"_conflicts":["3-ccc"],"_deleted_conflicts":["4-fff"]}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"get", "revs", s.URL + "/db/foo", "-f", "json"},
+		}
+	})
+	tests.Add("deleted winner", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery {
+			case "GET /db/foo?open_revs=all&revs=true":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, multipartLeaves(
+					`{"_id":"foo","_rev":"2-bbb","_deleted":true,"_revisions":{"start":2,"ids":["bbb","aaa"]}}`,
+					`{"_id":"foo","_rev":"3-ddd","_deleted":true,"_revisions":{"start":3,"ids":["ddd","ccc","aaa"]}}`,
+				))
+			case "POST /db/_changes?filter=_doc_ids":
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"results":[{"seq":"4-g1AAAA","id":"foo","changes":[{"rev":"3-ddd"}],"deleted":true}],"last_seq":"4-g1AAAA"}`)
+			case "GET /db/foo?conflicts=true&deleted_conflicts=true&rev=3-ddd&revs_info=true":
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"_id":"foo","_rev":"3-ddd","_deleted":true,"_revs_info":[{"rev":"3-ddd","status":"deleted"},{"rev":"2-ccc","status":"missing"},{"rev":"1-aaa","status":"missing"}],"_deleted_conflicts":["2-bbb"]}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"get", "revs", s.URL + "/db/foo", "-f", "json"},
+		}
+	})
+	tests.Add("no leaves", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{`multipart/mixed; boundary="abc123"`},
+			},
+			Body: io.NopCloser(strings.NewReader(multipartLeaves())),
+		}, func(t *testing.T, req *http.Request) {
+			if want, got := "/db/foo?open_revs=all&revs=true", req.URL.String(); want != got {
+				t.Errorf("Unexpected request: %s", got)
+			}
+		})
+
+		return cmdTest{
+			args:   []string{"get", "revs", s.URL + "/db/foo"},
+			status: errors.ErrNotFound,
+		}
+	})
+	tests.Add("not found", func(t *testing.T) interface{} {
+		s := testy.ServeResponse(&http.Response{
+			StatusCode: http.StatusNotFound,
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"error":"not_found","reason":"missing"}`)),
+		})
+
+		return cmdTest{
+			args:   []string{"get", "revs", s.URL + "/db/foo"},
+			status: errors.ErrNotFound,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
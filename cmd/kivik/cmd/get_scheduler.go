@@ -0,0 +1,111 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+type getScheduler struct {
+	*root
+	jobs, docs *cobra.Command
+}
+
+func getSchedulerCmd(r *root) *cobra.Command {
+	c := &getScheduler{
+		root: r,
+		jobs: getSchedulerJobsCmd(r),
+		docs: getSchedulerDocsCmd(r),
+	}
+	cmd := &cobra.Command{
+		Use:   "scheduler [command]",
+		Short: "Get replication scheduler status",
+		Long:  `Fetch the status of replications from the replication scheduler`,
+		RunE:  c.RunE,
+	}
+
+	cmd.AddCommand(c.jobs)
+	cmd.AddCommand(c.docs)
+
+	return cmd
+}
+
+func (c *getScheduler) RunE(cmd *cobra.Command, args []string) error {
+	dsn, err := c.conf.URL()
+	if err != nil {
+		return err
+	}
+	if endpoint, _, ok := schedulerFromDSN(dsn); ok && endpoint == "jobs" {
+		return c.jobs.RunE(cmd, args)
+	}
+	return c.docs.RunE(cmd, args)
+}
+
+// schedulerFromDSN parses a DSN in the form /_scheduler/jobs or
+// /_scheduler/docs, optionally followed by a replicator database name.
+func schedulerFromDSN(dsn *url.URL) (endpoint, db string, ok bool) {
+	parts := strings.SplitN(strings.Trim(dsn.Path, "/"), "/", 3) // nolint:gomnd
+	if len(parts) < 2 || parts[0] != "_scheduler" {              // nolint:gomnd
+		return "", "", false
+	}
+	switch parts[1] {
+	case "jobs":
+		return parts[1], "", len(parts) == 2 // nolint:gomnd
+	case "docs":
+		if len(parts) == 3 { // nolint:gomnd
+			db = parts[2]
+		}
+		return parts[1], db, true
+	}
+	return "", "", false
+}
+
+// schedulerInfo is the replication status reported by the scheduler.
+type schedulerInfo struct {
+	ChangesPending   *int64 `json:"changes_pending"`
+	DocsWritten      int64  `json:"docs_written"`
+	DocWriteFailures int64  `json:"doc_write_failures"`
+	Error            string `json:"error,omitempty"`
+}
+
+func (r *root) schedulerGet(ctx context.Context, path string, result interface{}) (json.RawMessage, error) {
+	couch, err := r.couch()
+	if err != nil {
+		return nil, err
+	}
+	r.log.Debugf("[get] Will fetch %s: %s", path, couch.DSN())
+	var raw json.RawMessage
+	if err := couch.DoJSON(ctx, http.MethodGet, path, nil, &raw); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return nil, errors.Code(errors.ErrProtocol, err)
+	}
+	return raw, nil
+}
+
+// parseTime parses an RFC 3339 timestamp, returning the zero time for
+// invalid values.
+func parseTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
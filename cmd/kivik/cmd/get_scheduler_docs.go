@@ -0,0 +1,104 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type getSchedulerDocs struct {
+	*root
+	watcher
+}
+
+func getSchedulerDocsCmd(r *root) *cobra.Command {
+	c := &getSchedulerDocs{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:   "docs [dsn]/_scheduler/docs/[replicator-db]",
+		Short: "List replication documents",
+		Long: `Fetch the state of the replications defined by documents in replicator databases, from /_scheduler/docs.
+
+To limit the list to a single replicator database, append its name to the DSN, as in /_scheduler/docs/other_replicator.
+
+In friendly mode, the state, pending changes, and elapsed time of each replication are summarized.`,
+		RunE: c.RunE,
+	}
+
+	c.watcher.flags(cmd.PersistentFlags())
+
+	return cmd
+}
+
+type schedulerDoc struct {
+	Database    string         `json:"database"`
+	DocID       string         `json:"doc_id"`
+	Node        string         `json:"node"`
+	Source      string         `json:"source"`
+	Target      string         `json:"target"`
+	State       string         `json:"state"`
+	StartTime   string         `json:"start_time"`
+	LastUpdated string         `json:"last_updated"`
+	ErrorCount  int            `json:"error_count"`
+	Info        *schedulerInfo `json:"info"`
+}
+
+func (c *getSchedulerDocs) RunE(cmd *cobra.Command, _ []string) error {
+	if _, err := c.client(); err != nil {
+		return err
+	}
+	dsn, err := c.conf.URL()
+	if err != nil {
+		return err
+	}
+	c.conf.Finalize()
+	path := "/_scheduler/docs"
+	if _, db, ok := schedulerFromDSN(dsn); ok && db != "" {
+		path += "/" + url.PathEscape(db)
+	}
+
+	return c.watchOutput(cmd.Context(), &c.watcher, func() (io.Reader, error) {
+		var result struct {
+			Docs []schedulerDoc `json:"docs"`
+		}
+		raw, err := c.schedulerGet(cmd.Context(), path, &result)
+		if err != nil {
+			return nil, err
+		}
+		rows := make([][]string, 0, len(result.Docs))
+		for _, doc := range result.Docs {
+			pending := "-"
+			if doc.Info != nil && doc.Info.ChangesPending != nil {
+				pending = strconv.FormatInt(*doc.Info.ChangesPending, 10)
+			}
+			rows = append(rows, []string{
+				doc.Database,
+				doc.DocID,
+				doc.State,
+				doc.Source,
+				doc.Target,
+				pending,
+				c.elapsed(parseTime(doc.StartTime)),
+			})
+		}
+		header := []string{"DATABASE", "DOC ID", "STATE", "SOURCE", "TARGET", "PENDING", "ELAPSED"}
+		return output.TableReader(header, rows, output.JSONReader(raw)), nil
+	})
+}
@@ -0,0 +1,103 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type getSchedulerJobs struct {
+	*root
+	watcher
+}
+
+func getSchedulerJobsCmd(r *root) *cobra.Command {
+	c := &getSchedulerJobs{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:   "jobs [dsn]",
+		Short: "List running replication jobs",
+		Long: `Fetch the list of replication jobs managed by the scheduler, from /_scheduler/jobs.
+
+In friendly mode, the most recent event, pending changes, and elapsed time of each job are summarized.`,
+		RunE: c.RunE,
+	}
+
+	c.watcher.flags(cmd.PersistentFlags())
+
+	return cmd
+}
+
+type schedulerJob struct {
+	ID        string        `json:"id"`
+	Database  string        `json:"database"`
+	DocID     string        `json:"doc_id"`
+	Node      string        `json:"node"`
+	Source    string        `json:"source"`
+	Target    string        `json:"target"`
+	StartTime string        `json:"start_time"`
+	Info      schedulerInfo `json:"info"`
+	History   []struct {
+		Type string `json:"type"`
+	} `json:"history"`
+}
+
+func (c *getSchedulerJobs) RunE(cmd *cobra.Command, _ []string) error {
+	if _, err := c.client(); err != nil {
+		return err
+	}
+	c.conf.Finalize()
+
+	return c.watchOutput(cmd.Context(), &c.watcher, func() (io.Reader, error) {
+		var result struct {
+			Jobs []schedulerJob `json:"jobs"`
+		}
+		raw, err := c.schedulerGet(cmd.Context(), "/_scheduler/jobs", &result)
+		if err != nil {
+			return nil, err
+		}
+		rows := make([][]string, 0, len(result.Jobs))
+		for _, job := range result.Jobs {
+			id := job.DocID
+			if id == "" {
+				id = job.ID
+			}
+			state := "-"
+			// History is ordered from the most recent event.
+			if len(job.History) > 0 {
+				state = job.History[0].Type
+			}
+			pending := "-"
+			if job.Info.ChangesPending != nil {
+				pending = strconv.FormatInt(*job.Info.ChangesPending, 10)
+			}
+			rows = append(rows, []string{
+				id,
+				job.Source,
+				job.Target,
+				job.Node,
+				state,
+				pending,
+				c.elapsed(parseTime(job.StartTime)),
+			})
+		}
+		header := []string{"ID", "SOURCE", "TARGET", "NODE", "STATE", "PENDING", "ELAPSED"}
+		return output.TableReader(header, rows, output.JSONReader(raw)), nil
+	})
+}
@@ -0,0 +1,105 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type getSystem struct {
+	*root
+	node string
+}
+
+func getSystemCmd(r *root) *cobra.Command {
+	c := &getSystem{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:   "system [dsn]",
+		Short: "Get node system information",
+		Long: `Fetch the Erlang VM status of a node, from /_node/{node}/_system.
+
+In friendly mode, the memory use, process count, run queue and uptime of the node are summarized.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVarP(&c.node, "node", "n", "_local", "Specify the node name to query")
+
+	return cmd
+}
+
+// nodeSystem is the subset of /_node/{node}/_system summarized in friendly
+// mode.
+type nodeSystem struct {
+	Uptime float64 `json:"uptime"`
+	Memory struct {
+		Total float64 `json:"total"`
+	} `json:"memory"`
+	RunQueue     float64 `json:"run_queue"`
+	ProcessCount float64 `json:"process_count"`
+	ProcessLimit float64 `json:"process_limit"`
+}
+
+func (c *getSystem) RunE(cmd *cobra.Command, _ []string) error {
+	dsn, err := c.conf.URL()
+	if err != nil {
+		return err
+	}
+	c.conf.Finalize()
+	if node, ok := nodeFromDSN(dsn, "_system"); ok {
+		c.node = node
+	}
+
+	return c.retry(func() error {
+		result, err := c.nodeEndpoint(cmd.Context(), c.node, "_system")
+		if err != nil {
+			return err
+		}
+		var system nodeSystem
+		if err := json.Unmarshal(result, &system); err != nil {
+			return errors.Code(errors.ErrProtocol, err)
+		}
+		row := []string{
+			c.node,
+			formatBytes(system.Memory.Total),
+			fmt.Sprintf("%.0f/%.0f", system.ProcessCount, system.ProcessLimit),
+			fmt.Sprintf("%.0f", system.RunQueue),
+			(time.Duration(system.Uptime) * time.Second).String(),
+		}
+		header := []string{"NODE", "MEMORY", "PROCESSES", "RUN QUEUE", "UPTIME"}
+		return c.fmt.Output(output.TableReader(header, [][]string{row}, output.JSONReader(result)))
+	})
+}
+
+// formatBytes formats a size in bytes for display, using binary prefixes.
+func formatBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	exp := 0
+	for n >= unit*unit && exp < 4 { // nolint:gomnd
+		n /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", n/unit, "KMGTP"[exp])
+}
@@ -0,0 +1,63 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func nodeSystemResponse(node string) string {
+	n := len(node)
+	return fmt.Sprintf(`{"uptime":%d,"memory":{"other":22592349,"atom":512625,"atom_used":498877,"processes":14395120,"processes_used":14390688,"binary":269448,"code":11372453,"ets":2031608,"total":%d},"run_queue":%d,"ets_table_count":142,"context_switches":1183591,"reductions":1009620347,"garbage_collection_count":85186,"words_reclaimed":316040787,"io_input":1187380,"io_output":621262,"os_proc_count":0,"stale_proc_count":0,"process_count":%d,"process_limit":262144,"message_queues":{"couch_file":{"count":1,"min":0,"max":0,"50":0,"90":0,"99":0},"couch_db_updater":{"count":1,"min":0,"max":0,"50":0,"90":0,"99":0}},"internal_replication_jobs":0,"distribution":{}}`, n*3700, n*5000000, n%3, n*100)
+}
+
+func Test_get_system_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("local", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, nodeSystemResponse("_local")), expectRequest("GET /_node/_local/_system"))
+
+		return cmdTest{
+			args: []string{"get", "system", s.URL},
+		}
+	})
+	tests.Add("node", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, nodeSystemResponse("couchdb@node1")), expectRequest("GET /_node/couchdb@node1/_system"))
+
+		return cmdTest{
+			args: []string{"get", "system", s.URL, "--node", "couchdb@node1"},
+		}
+	})
+	tests.Add("json", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, nodeSystemResponse("_local")), expectRequest("GET /_node/_local/_system"))
+
+		return cmdTest{
+			args: []string{"get", "system", s.URL, "-f", "json"},
+		}
+	})
+	tests.Add("from dsn", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, nodeSystemResponse("_local")), expectRequest("GET /_node/_local/_system"))
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/_node/_local/_system"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,385 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+	_ "github.com/go-kivik/kivik/v4/x/fsdb" // Filesystem driver
+	"github.com/go-kivik/kivik/v4/x/fsdb/cdb"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type load struct {
+	*root
+	dir string
+}
+
+func loadCmd(r *root) *cobra.Command {
+	c := &load{
+		root: r,
+	}
+	return &cobra.Command{
+		Use:   "load <dir> [dsn]/[database]",
+		Short: "Load fixtures from a directory",
+		Long: `Load databases and documents from a directory tree, such as fixtures or seed data kept under version control.
+
+Each subdirectory of dir is a database, which is created if it does not exist. If the DSN names a database, dir itself is loaded into that database. The directory layout follows the conventions of the filesystem driver used by 'kivik replicate':
+
+    {db}/{docid}.json        A document, in JSON or YAML (.yaml or .yml)
+    {db}/{docid}/{filename}  An attachment to the document
+    {db}/_security.yaml      The database security object
+    {db}/_design/{name}.yaml The design document _design/{name}
+
+Document IDs containing a slash are escaped as %2F in filenames, so a design document may also be stored as {db}/_design%2F{name}.yaml. Files and directories beginning with a dot are ignored.
+
+Documents are upserted: each document which differs from the copy in the database is saved as a new revision of the current one, and any _rev in the file is ignored, so that fixtures may be edited freely. Documents which are not changed are not saved.
+
+The exit status is non-zero if any document could not be saved.`,
+		PersistentPreRunE: r.dirArgs(&c.dir),
+		RunE:              c.RunE,
+	}
+}
+
+// loadChunkSize is the number of documents sent per _bulk_docs request.
+const loadChunkSize = 100
+
+// loadResult is the result of loading a single document.
+type loadResult struct {
+	Database string `json:"database"`
+	ID       string `json:"id"`
+	Rev      string `json:"rev,omitempty"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+
+	status int
+}
+
+func (c *load) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, doc, err := c.conf.DBDoc()
+	if err != nil {
+		return err
+	}
+	if doc != "" {
+		return errors.Code(errors.ErrUsage, "DSN expected to contain only the database")
+	}
+	info, err := os.Stat(c.dir)
+	if err != nil {
+		return errors.Code(errors.ErrNoInput, err)
+	}
+	if !info.IsDir() {
+		return errors.Codef(errors.ErrUsage, "%s is not a directory", c.dir)
+	}
+	fixtures, err := kivik.New("fs", c.dir)
+	if err != nil {
+		return errors.Code(errors.ErrNoInput, err)
+	}
+
+	dbs := map[string]string{db: "."}
+	if db == "" {
+		names, err := fixtures.AllDBs(cmd.Context())
+		if err != nil {
+			return errors.Code(errors.ErrIO, err)
+		}
+		dbs = make(map[string]string, len(names))
+		for _, name := range names {
+			dbs[name] = cdb.EscapeID(name)
+		}
+	}
+	names := make([]string, 0, len(dbs))
+	for name := range dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := []loadResult{}
+	for _, name := range names {
+		c.log.Debugf("[load] Will load %s into %s/%s", filepath.Join(c.dir, dbs[name]), client.DSN(), name)
+		res, err := c.loadDB(cmd.Context(), client, name, filepath.Join(c.dir, dbs[name]))
+		if err != nil {
+			return err
+		}
+		results = append(results, res...)
+	}
+
+	var failed, status int
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		state := result.Status
+		if result.Reason != "" {
+			state += ": " + result.Reason
+			failed++
+			if status == 0 {
+				status = result.status
+			}
+		}
+		rows = append(rows, []string{result.Database, result.ID, result.Rev, state})
+	}
+	if err := c.fmt.Output(output.TableReader([]string{"DATABASE", "ID", "REV", "STATUS"}, rows, output.JSONReader(results))); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errors.HTTPStatusf(status, "%d of %d documents failed", failed, len(results))
+	}
+	return nil
+}
+
+// loadDB loads the fixtures in dir into the named database, creating it if
+// necessary.
+func (c *load) loadDB(ctx context.Context, client *kivik.Client, name, dir string) ([]loadResult, error) {
+	docs, err := readFixtureDocs(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	security, err := readFixtureSecurity(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.retry(func() error {
+		exists, err := client.DBExists(ctx, name)
+		if err != nil || exists {
+			return err
+		}
+		c.log.Debugf("[load] Will create database: %s/%s", client.DSN(), name)
+		return client.CreateDB(ctx, name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	db := client.DB(name)
+
+	results := []loadResult{}
+	if security != nil {
+		err := c.retry(func() error {
+			return db.SetSecurity(ctx, security)
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, loadResult{Database: name, ID: "_security", Status: "updated"})
+	}
+
+	for len(docs) > 0 {
+		n := loadChunkSize
+		if n > len(docs) {
+			n = len(docs)
+		}
+		res, err := c.upsert(ctx, db, name, docs[:n])
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res...)
+		docs = docs[n:]
+	}
+	return results, nil
+}
+
+// upsert saves each of docs which differs from the current revision in the
+// database.
+func (c *load) upsert(ctx context.Context, db *kivik.DB, name string, docs []map[string]interface{}) ([]loadResult, error) {
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i], _ = doc["_id"].(string)
+	}
+	current := make(map[string]map[string]interface{}, len(docs))
+	err := c.retry(func() error {
+		rs := db.AllDocs(ctx, kivik.Params(map[string]interface{}{
+			"keys":         ids,
+			"include_docs": true,
+		}))
+		defer rs.Close() // nolint:errcheck
+		for rs.Next() {
+			var doc map[string]interface{}
+			// Missing and deleted documents have no doc.
+			if err := rs.ScanDoc(&doc); err != nil || doc == nil {
+				continue
+			}
+			id, _ := doc["_id"].(string)
+			current[id] = doc
+		}
+		return rs.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]loadResult, 0, len(docs))
+	chunk := make([]json.RawMessage, 0, len(docs))
+	for i, doc := range docs {
+		remote, exists := current[ids[i]]
+		if exists {
+			rev, _ := remote["_rev"].(string)
+			if len(diffDesign(remote, doc)) == 0 {
+				results = append(results, loadResult{Database: name, ID: ids[i], Rev: rev, Status: "unchanged"})
+				continue
+			}
+			doc["_rev"] = rev
+		}
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, errors.Code(errors.ErrData, err)
+		}
+		chunk = append(chunk, raw)
+	}
+	if len(chunk) == 0 {
+		return results, nil
+	}
+
+	res, err := c.bulkDocs(ctx, db, chunk, []kivik.Option{c.opts()})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range res {
+		result := loadResult{Database: name, ID: r.ID, Rev: r.Rev, Status: "created"}
+		if _, ok := current[r.ID]; ok {
+			result.Status = "updated"
+		}
+		if !r.OK {
+			result.Rev = ""
+			result.Status, result.Reason, result.status = r.Error, r.Reason, r.status
+		}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].ID < results[j].ID
+	})
+	return results, nil
+}
+
+// readFixtureDocs reads the documents in dir, and those in its _design
+// subdirectory, with the attachments in their sibling directories, ordered by
+// ID.
+func readFixtureDocs(ctx context.Context, dir string) ([]map[string]interface{}, error) {
+	docs, err := readFixtureDir(ctx, dir, "")
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(filepath.Join(dir, "_design")); err == nil && info.IsDir() {
+		ddocs, err := readFixtureDir(ctx, filepath.Join(dir, "_design"), "_design/")
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, ddocs...)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i]["_id"].(string) < docs[j]["_id"].(string)
+	})
+	return docs, nil
+}
+
+// fixtureDB opens dir as a database with the filesystem driver.
+func fixtureDB(dir string) (*kivik.DB, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Code(errors.ErrIO, err)
+	}
+	client, err := kivik.New("fs", filepath.Dir(abs))
+	if err != nil {
+		return nil, errors.Code(errors.ErrIO, err)
+	}
+	db := client.DB(filepath.Base(abs))
+	return db, errors.Code(errors.ErrIO, db.Err())
+}
+
+// readFixtureDir reads the documents in dir with the filesystem driver,
+// prefixing each ID with prefix.
+func readFixtureDir(ctx context.Context, dir, prefix string) ([]map[string]interface{}, error) {
+	db, err := fixtureDB(dir)
+	if err != nil {
+		return nil, err
+	}
+	changes := db.Changes(ctx)
+	defer changes.Close() // nolint:errcheck
+	var docs []map[string]interface{}
+	for changes.Next() {
+		id := changes.ID()
+		if changes.Deleted() || strings.HasPrefix(id, "_local/") {
+			continue
+		}
+		var fixture map[string]interface{}
+		if err := db.Get(ctx, id, kivik.Param("attachments", true)).ScanDoc(&fixture); err != nil {
+			return nil, errors.Code(errors.ErrData, err)
+		}
+		doc := make(map[string]interface{}, len(fixture))
+		for k, v := range fixture {
+			if k != "_rev" {
+				doc[k] = v
+			}
+		}
+		doc["_id"] = prefix + id
+
+		atts, _ := doc["_attachments"].(map[string]interface{})
+		attDir := filepath.Join(dir, cdb.EscapeID(id))
+		if info, err := os.Stat(attDir); err == nil && info.IsDir() {
+			files, err := readAttachments(attDir)
+			if err != nil {
+				return nil, err
+			}
+			if atts == nil {
+				atts = files
+			}
+			for filename, att := range files {
+				if _, ok := atts[filename]; !ok {
+					atts[filename] = att
+				}
+			}
+		}
+		if len(atts) > 0 {
+			doc["_attachments"] = atts
+		}
+		docs = append(docs, doc)
+	}
+	if err := changes.Err(); err != nil {
+		return nil, errors.Code(errors.ErrIO, err)
+	}
+	return docs, nil
+}
+
+// readFixtureSecurity returns the security object in dir, or nil if there is
+// none.
+func readFixtureSecurity(ctx context.Context, dir string) (*kivik.Security, error) {
+	var found bool
+	for _, ext := range []string{"json", "yaml", "yml"} {
+		if _, err := os.Stat(filepath.Join(dir, "_security."+ext)); err == nil {
+			found = true
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	db, err := fixtureDB(dir)
+	if err != nil {
+		return nil, err
+	}
+	sec, err := db.Security(ctx)
+	if err != nil && kivik.HTTPStatus(err) != http.StatusNotFound {
+		return nil, errors.Code(errors.ErrData, err)
+	}
+	return sec, nil
+}
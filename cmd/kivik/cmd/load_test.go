@@ -0,0 +1,186 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"crypto/md5" // nolint:gosec
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+const (
+	fixturesSecurity = `{"admins":{"roles":["admin"]},"members":{"names":["alice","bob"]}}`
+	ordersBulkDocs   = `{"docs":[{"_id":"1001","customer":"alice","total":42.5}]}`
+	ordersMissing    = `{"total_rows":0,"offset":0,"rows":[{"key":"1001","error":"not_found"}]}`
+)
+
+// existingUsers returns the _all_docs response for the users fixtures as
+// stored in the database, with alice unchanged, and bob modified.
+func existingUsers() string {
+	sum := md5.Sum([]byte("Hello, Alice!\n")) // nolint:gosec
+	digest := "md5-" + base64.StdEncoding.EncodeToString(sum[:])
+	return `{"total_rows":2,"offset":0,"rows":[` +
+		`{"key":"_design/app","error":"not_found"},` +
+		`{"key":"_design/auth","error":"not_found"},` +
+		`{"id":"alice","key":"alice","value":{"rev":"2-aaa"},"doc":{"_id":"alice","_rev":"2-aaa","type":"user","name":"Alice","_attachments":{"greeting.txt":{"content_type":"text/plain; charset=utf-8","digest":"` + digest + `","length":14,"stub":true}}}},` +
+		`{"id":"bob","key":"bob","value":{"rev":"3-bbb"},"doc":{"_id":"bob","_rev":"3-bbb","type":"user","name":"Bob"}}]}`
+}
+
+func Test_load_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing directory", cmdTest{
+		args:   []string{"load"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("nonexistent directory", cmdTest{
+		args:   []string{"load", "testdata/nonexistent", "http://example.com/"},
+		status: errors.ErrNoInput,
+	})
+	tests.Add("not a directory", cmdTest{
+		args:   []string{"load", "testdata/fixtures/users/bob.json", "http://example.com/"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("document in dsn", cmdTest{
+		args:   []string{"load", "testdata/fixtures", "http://example.com/db/doc"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("load all", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "HEAD /orders":
+				w.WriteHeader(http.StatusNotFound)
+			case "PUT /orders":
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /orders/_all_docs?include_docs=true":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["1001"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, ordersMissing)
+			case "POST /orders/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(ordersBulkDocs), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"1001","rev":"1-new"}]`)
+			case "HEAD /users":
+				w.WriteHeader(http.StatusOK)
+			case "PUT /users/_security":
+				if d := testy.DiffAsJSON([]byte(fixturesSecurity), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /users/_all_docs?include_docs=true":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["_design/app","_design/auth","alice","bob"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, existingUsers())
+			case "POST /users/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(`{"docs":[
+					{"_id":"_design/app","language":"javascript","views":{"by_name":{"map":"function(doc) { emit(doc.name) }"}}},
+					{"_id":"_design/auth","validate_doc_update":"function() {}"},
+					{"_id":"bob","_rev":"3-bbb","name":"Robert","type":"user"}
+				]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"_design/app","rev":"1-new"},{"ok":true,"id":"_design/auth","rev":"1-new"},{"ok":true,"id":"bob","rev":"1-new"}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"load", "testdata/fixtures", s.URL},
+		}
+	})
+	tests.Add("load one", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "HEAD /customers":
+				w.WriteHeader(http.StatusOK)
+			case "PUT /customers/_security":
+				if d := testy.DiffAsJSON([]byte(fixturesSecurity), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, `{"ok":true}`)
+			case "POST /customers/_all_docs?include_docs=true":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["_design/app","_design/auth","alice","bob"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, `{"total_rows":0,"offset":0,"rows":[{"key":"_design/app","error":"not_found"},{"key":"_design/auth","error":"not_found"},{"key":"alice","error":"not_found"},{"key":"bob","error":"not_found"}]}`)
+			case "POST /customers/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(`{"docs":[
+					{"_id":"_design/app","language":"javascript","views":{"by_name":{"map":"function(doc) { emit(doc.name) }"}}},
+					{"_id":"_design/auth","validate_doc_update":"function() {}"},
+					{"_id":"alice","name":"Alice","type":"user","_attachments":{"greeting.txt":{"content_type":"text/plain; charset=utf-8","data":"SGVsbG8sIEFsaWNlIQo="}}},
+					{"_id":"bob","name":"Robert","type":"user"}
+				]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"_design/app","rev":"1-new"},{"ok":true,"id":"_design/auth","rev":"1-new"},{"ok":true,"id":"alice","rev":"1-new"},{"ok":true,"id":"bob","rev":"1-new"}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"load", "testdata/fixtures/users", s.URL + "/customers", "-f", "json"},
+		}
+	})
+	tests.Add("failure", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "HEAD /orders":
+				w.WriteHeader(http.StatusOK)
+			case "POST /orders/_all_docs?include_docs=true":
+				if d := testy.DiffAsJSON([]byte(`{"keys":["1001"]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, ordersMissing)
+			case "POST /orders/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(ordersBulkDocs), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"id":"1001","error":"forbidden","reason":"Read only."}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args:   []string{"load", "testdata/fixtures/orders", s.URL + "/orders"},
+			status: errors.ErrInternalServerError,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
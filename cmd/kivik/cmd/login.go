@@ -0,0 +1,149 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/config"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type login struct {
+	*root
+	user          string
+	passwordStdin bool
+}
+
+func loginCmd(r *root) *cobra.Command {
+	c := &login{
+		root: r,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Log in to the server, and save the session cookie",
+		Long: `Log in to the server of the current context, or the context named by --context, with cookie authentication, and save the session cookie alongside the config file.
+
+Later commands using the context send the saved cookie, until it expires, so the password need not be stored in the config file. The password is read from the context, or from stdin with --password-stdin.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.user, "user", "", "Username, if not the user of the context")
+	pf.BoolVar(&c.passwordStdin, "password-stdin", false, "Read the password from stdin")
+
+	return cmd
+}
+
+func (c *login) RunE(cmd *cobra.Command, _ []string) error {
+	cx, err := c.conf.CurrentCx()
+	if err != nil {
+		return err
+	}
+	if cx.SessionFile == "" {
+		return errors.Code(errors.ErrUsage, "login requires a context from the config file")
+	}
+	if cx.Auth != nil && cx.Auth.Type != config.AuthCookie {
+		return errors.Codef(errors.ErrUsage, "login requires cookie authentication, but the context uses %s", cx.Auth.Type)
+	}
+	user, password, err := cx.Credentials()
+	if err != nil {
+		return err
+	}
+	if c.user != "" {
+		user = c.user
+	}
+	if c.passwordStdin {
+		buf, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return errors.Code(errors.ErrIO, err)
+		}
+		password = strings.TrimRight(string(buf), "\r\n")
+	}
+	if user == "" {
+		return errors.Code(errors.ErrUsage, "user required")
+	}
+	addr, err := url.Parse(cx.ServerDSN())
+	if err != nil {
+		return errors.WithCode(err, errors.ErrUsage)
+	}
+	if addr.Scheme == "" {
+		addr.Scheme = "http"
+	}
+	addr.User = nil
+	addr.Path = strings.TrimSuffix(addr.Path, "/") + "/_session"
+	client, err := cx.HTTPClient(c.parsedConnectTimeout, c.parsedRequestTimeout)
+	if err != nil {
+		return err
+	}
+	c.conf.Finalize()
+	body, _ := json.Marshal(map[string]string{"name": user, "password": password})
+
+	c.log.Debugf("[login] Will log in as %s: %s", user, addr)
+	var cookie *http.Cookie
+	err = c.retry(func() error {
+		req, err := http.NewRequestWithContext(cmd.Context(), http.MethodPost, addr.String(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close() // nolint:errcheck
+		if res.StatusCode != http.StatusOK {
+			var reason struct {
+				Reason string `json:"reason"`
+			}
+			_ = json.NewDecoder(res.Body).Decode(&reason)
+			if reason.Reason == "" {
+				reason.Reason = http.StatusText(res.StatusCode)
+			}
+			return errors.HTTPStatusf(res.StatusCode, "login failed: %s", reason.Reason)
+		}
+		for _, c := range res.Cookies() {
+			if c.Name == kivik.SessionCookieName {
+				cookie = c
+				return nil
+			}
+		}
+		return errors.Code(errors.ErrProtocol, "server did not return a session cookie")
+	})
+	if err != nil {
+		return err
+	}
+	cx.User = user
+	if err := cx.SaveSession(cookie); err != nil {
+		return err
+	}
+	result := map[string]interface{}{
+		"user": user,
+	}
+	if !cookie.Expires.IsZero() {
+		result["expires"] = cookie.Expires
+	}
+	return c.fmt.Output(output.TemplateReader(`Logged in as {{ .user }}.`, result, output.JSONReader(result)))
+}
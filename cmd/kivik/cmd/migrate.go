@@ -0,0 +1,224 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/input"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+	"github.com/go-kivik/xkivik/v4/migrate"
+)
+
+type migrator struct {
+	*root
+	scripts    string
+	dryRun     bool
+	batchSize  int
+	to         int
+	progressID string
+}
+
+func migrateCmd(r *root) *cobra.Command {
+	c := &migrator{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:   "migrate [dsn]/[database]",
+		Short: "Apply schema migrations to the documents in a database",
+		Long: `Apply schema-versioned migrations to the documents in a database.
+
+Migrations are applied in order of version, each to the documents matching its selector. The schema version of the database, and the progress of an incomplete migration, are recorded in a _local document, so that migrations already applied are skipped, and an interrupted run resumes where it left off. Changed documents are saved with /{db}/_bulk_docs. Documents which cannot be saved are retried by the next run, and later migrations are not applied until they succeed.
+
+Migrations are read from the YAML or JSON files in the --scripts directory, and include any registered by a kivik binary built with Go migrations. Each script has the form:
+
+    version: 2
+    name: split names
+    selector:
+      type: user
+    template: |
+      {{ if .name }}{"full_name": {{ json .name }}, "name": null}{{ end }}
+
+The template is executed for each matching document, and its output, if not blank, is applied to the document as a JSON merge patch. See the documentation of the github.com/go-kivik/xkivik/v4/migrate package for details.
+
+With --dry-run, nothing is saved, and the IDs of the documents which would be changed are included in the JSON output.
+
+The exit status is non-zero if any document could not be saved.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.scripts, "scripts", "", "Directory of migration scripts")
+	pf.BoolVar(&c.dryRun, "dry-run", false, "Report the changes which would be made, without saving them")
+	pf.IntVar(&c.batchSize, "batch-size", 100, "Number of documents to read per request") // nolint:gomnd
+	pf.IntVar(&c.to, "to", 0, "Apply migrations up to and including this version. By default, all migrations are applied.")
+	pf.StringVar(&c.progressID, "progress-id", migrate.DefaultProgressID, "ID of the _local document which records migration progress")
+
+	return cmd
+}
+
+// migrationScript is a template-driven migration, read from a file.
+type migrationScript struct {
+	Version  int                    `json:"version"`
+	Name     string                 `json:"name"`
+	Selector map[string]interface{} `json:"selector"`
+	Template string                 `json:"template"`
+}
+
+func (c *migrator) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, err := c.conf.DB()
+	if err != nil {
+		return err
+	}
+	if db == "" {
+		return errors.Code(errors.ErrUsage, "database required")
+	}
+	if c.batchSize <= 0 {
+		return errors.Code(errors.ErrUsage, "batch size must be positive")
+	}
+	migrations, err := c.migrations()
+	if err != nil {
+		return err
+	}
+
+	opts := kivik.Params(map[string]interface{}{
+		"dry_run":        c.dryRun,
+		"batch_size":     c.batchSize,
+		"target_version": c.to,
+		"progress_id":    c.progressID,
+	})
+	c.log.Debugf("[migrate] Will apply %d migrations: %s/%s", len(migrations), client.DSN(), db)
+	var result *migrate.Result
+	err = c.retry(func() error {
+		var err error
+		result, err = migrate.Run(cmd.Context(), client.DB(db), migrations, opts)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var changed, failed, status int
+	rows := make([][]string, 0, len(result.Migrations))
+	for _, m := range result.Migrations {
+		changed += m.Changed
+		rows = append(rows, []string{
+			strconv.Itoa(m.Version),
+			m.Name,
+			m.Status,
+			strconv.Itoa(m.Matched),
+			strconv.Itoa(m.Changed),
+			strconv.Itoa(m.Updated),
+			strconv.Itoa(len(m.Failed)),
+		})
+		for _, f := range m.Failed {
+			c.log.Debugf("[migrate] Failed to save %s: %s", f.ID, f.Err)
+			failed++
+			if status == 0 {
+				status = kivik.HTTPStatus(f.Err)
+			}
+		}
+	}
+	header := []string{"VERSION", "NAME", "STATUS", "MATCHED", "CHANGED", "UPDATED", "FAILED"}
+	if err := c.fmt.Output(output.TableReader(header, rows, output.JSONReader(result))); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errors.HTTPStatusf(status, "%d of %d documents could not be saved", failed, changed)
+	}
+	return nil
+}
+
+// migrations returns the registered migrations, and those read from the
+// scripts directory.
+func (c *migrator) migrations() ([]migrate.Migration, error) {
+	migrations := migrate.Registered()
+	if c.scripts != "" {
+		scripts, err := readMigrationScripts(c.scripts)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, scripts...)
+	}
+	if len(migrations) == 0 {
+		return nil, errors.Code(errors.ErrUsage, "no migrations found")
+	}
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, errors.Codef(errors.ErrUsage, "duplicate migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// readMigrationScripts reads the migration scripts in dir.
+func readMigrationScripts(dir string) ([]migrate.Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Code(errors.ErrNoInput, err)
+	}
+	var migrations []migrate.Migration
+	for _, entry := range entries {
+		switch filepath.Ext(entry.Name()) {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		var script migrationScript
+		if err := input.FromFile(path).As(&script); err != nil {
+			return nil, errors.Code(errors.ErrData, fmt.Errorf("%s: %w", path, err))
+		}
+		if script.Version <= 0 {
+			return nil, errors.Codef(errors.ErrData, "%s: version must be positive", path)
+		}
+		if script.Template == "" {
+			return nil, errors.Codef(errors.ErrData, "%s: template required", path)
+		}
+		if script.Name == "" {
+			script.Name = entry.Name()
+		}
+		fn, err := migrate.Template(entry.Name(), script.Template)
+		if err != nil {
+			return nil, errors.Code(errors.ErrData, fmt.Errorf("%s: %w", path, err))
+		}
+		migrations = append(migrations, migrate.Migration{
+			Version:  script.Version,
+			Name:     script.Name,
+			Selector: script.Selector,
+			Func: func(ctx context.Context, doc *xkivik.Document) (bool, error) {
+				changed, err := fn(ctx, doc)
+				return changed, errors.Code(errors.ErrData, err)
+			},
+		})
+	}
+	return migrations, nil
+}
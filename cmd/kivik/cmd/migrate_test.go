@@ -0,0 +1,177 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+const (
+	migrateFindQuery = `{"limit":100,"selector":{"$and":[{"type":"user"},{"_id":{"$gt":""}}]},"sort":[{"_id":"asc"}]}`
+	testMigrateDocs  = `{"docs":[{"_id":"alice","_rev":"1-a","type":"user","name":"Alice"},{"_id":"bob","_rev":"1-b","type":"user","name":"Bob","active":true}]}`
+	migrateBulkDocs  = `{"docs":[{"_id":"alice","_rev":"1-a","active":true,"name":"Alice","type":"user"}]}`
+)
+
+func Test_migrate_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing database", cmdTest{
+		args:   []string{"migrate", "--scripts", "testdata/migrations"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("no migrations", cmdTest{
+		args:   []string{"migrate", "http://example.com/db"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("missing scripts", cmdTest{
+		args:   []string{"migrate", "http://example.com/db", "--scripts", "testdata/nonexistent"},
+		status: errors.ErrNoInput,
+	})
+	tests.Add("invalid batch size", cmdTest{
+		args:   []string{"migrate", "http://example.com/db", "--scripts", "testdata/migrations", "--batch-size", "0"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid template", cmdTest{
+		args:   []string{"migrate", "http://example.com/db", "--scripts", "testdata/migrations-invalid"},
+		status: errors.ErrData,
+	})
+	tests.Add("duplicate version", func(t *testing.T) interface{} {
+		dir := t.TempDir()
+		for _, name := range []string{"a.yaml", "b.yaml"} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("version: 1\ntemplate: '{}'\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return cmdTest{
+			args:   []string{"migrate", "http://example.com/db", "--scripts", dir},
+			status: errors.ErrUsage,
+		}
+	})
+	tests.Add("migrate", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /db/_local/kivik-migrate":
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, `{"error":"not_found","reason":"missing"}`)
+			case "POST /db/_find":
+				if d := testy.DiffAsJSON([]byte(migrateFindQuery), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, testMigrateDocs)
+			case "POST /db/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(migrateBulkDocs), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"alice","rev":"2-new"}]`)
+			case "PUT /db/_local/kivik-migrate":
+				switch body := readBody(t, r); body {
+				case `{"version":0,"current":{"version":1,"last_id":"bob"}}`, `{"_rev":"0-1","version":1,"applied":[{"version":1,"name":"activate users"}]}`:
+				default:
+					t.Errorf("Unexpected progress: %s", body)
+				}
+				w.Header().Set("ETag", `"0-1"`)
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true,"id":"_local/kivik-migrate","rev":"0-1"}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"migrate", s.URL + "/db", "--scripts", "testdata/migrations", "--to", "1"},
+		}
+	})
+	tests.Add("dry run", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /db/_local/kivik-migrate":
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, `{"error":"not_found","reason":"missing"}`)
+			case "POST /db/_find":
+				if d := testy.DiffAsJSON([]byte(migrateFindQuery), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, testMigrateDocs)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"migrate", s.URL + "/db", "--scripts", "testdata/migrations", "--dry-run", "-f", "json"},
+		}
+	})
+	tests.Add("already applied", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, `{"_id":"_local/kivik-migrate","_rev":"0-1","version":1}`), expectRequest("GET /db/_local/kivik-migrate"))
+
+		return cmdTest{
+			args: []string{"migrate", s.URL + "/db", "--scripts", "testdata/migrations", "--to", "1"},
+		}
+	})
+	tests.Add("failure", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /db/_local/kivik-migrate":
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, `{"error":"not_found","reason":"missing"}`)
+			case "POST /db/_find":
+				if d := testy.DiffAsJSON([]byte(migrateFindQuery), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = io.WriteString(w, testMigrateDocs)
+			case "POST /db/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(migrateBulkDocs), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"id":"alice","error":"forbidden","reason":"Read only."}]`)
+			case "PUT /db/_local/kivik-migrate":
+				switch body := readBody(t, r); body {
+				case `{"version":0,"current":{"version":1,"last_id":"bob","failed":["alice"]}}`:
+				default:
+					t.Errorf("Unexpected progress: %s", body)
+				}
+				w.Header().Set("ETag", `"0-1"`)
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true,"id":"_local/kivik-migrate","rev":"0-1"}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args:   []string{"migrate", s.URL + "/db", "--scripts", "testdata/migrations"},
+			status: errors.ErrInternalServerError,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
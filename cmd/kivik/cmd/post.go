@@ -25,7 +25,7 @@ import (
 type post struct {
 	*root
 	*input.Input
-	doc, vc, flush, compact, cv, purge, repl, cluster *cobra.Command
+	doc, vc, flush, compact, cv, purge, repl, cluster, bulk, revsDiff *cobra.Command
 }
 
 func postCmd(r *root) *cobra.Command {
@@ -41,6 +41,8 @@ func postCmd(r *root) *cobra.Command {
 	c.doc = postDocCmd(c)
 	c.purge = postPurgeCmd(c)
 	c.cluster = postClusterSetupCmd(c)
+	c.bulk = postBulkDocsCmd(c)
+	c.revsDiff = postRevsDiffCmd(c)
 
 	cmd := &cobra.Command{
 		Use:   "post",
@@ -59,6 +61,8 @@ func postCmd(r *root) *cobra.Command {
 	cmd.AddCommand(c.purge)
 	cmd.AddCommand(c.repl)
 	cmd.AddCommand(c.cluster)
+	cmd.AddCommand(c.bulk)
+	cmd.AddCommand(c.revsDiff)
 
 	return cmd
 }
@@ -88,6 +92,10 @@ func (c *post) RunE(cmd *cobra.Command, args []string) error {
 		return c.compact.RunE(cmd, args)
 	case "_purge":
 		return c.purge.RunE(cmd, args)
+	case "_bulk_docs":
+		return c.bulk.RunE(cmd, args)
+	case "_revs_diff":
+		return c.revsDiff.RunE(cmd, args)
 	}
 	switch dsn.Path {
 	case "/_replicate":
@@ -0,0 +1,217 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/input"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type postBulkDocs struct {
+	*root
+	*input.Input
+	chunkSize int
+	newEdits  bool
+}
+
+func postBulkDocsCmd(p *post) *cobra.Command {
+	c := &postBulkDocs{
+		root:  p.root,
+		Input: p.Input,
+	}
+	cmd := &cobra.Command{
+		Use:     "bulk-docs [dsn]/[database]",
+		Aliases: []string{"bulk"},
+		Short:   "Create or update multiple documents",
+		Long: `Create or update multiple documents, with the /{db}/_bulk_docs endpoint.
+
+The input may be a JSON array of documents, newline-delimited JSON, or a multi-document YAML stream. Documents are read incrementally, and sent in chunks of --chunk-size documents.
+
+The exit status is non-zero if any document could not be saved.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.IntVar(&c.chunkSize, "chunk-size", 500, "Number of documents to send per request") // nolint:gomnd
+	pf.BoolVar(&c.newEdits, "new-edits", true, "Assign new revision IDs. Disable to store documents with their existing revisions, as during replication.")
+
+	return cmd
+}
+
+// bulkDocResult is the result of a single document update.
+type bulkDocResult struct {
+	ID     string `json:"id"`
+	Rev    string `json:"rev,omitempty"`
+	OK     bool   `json:"ok,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	status int
+}
+
+func (c *postBulkDocs) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	dsn, err := c.conf.URL()
+	if err != nil {
+		return err
+	}
+	command, db := dbCommandFromDSN(dsn)
+	if command == "_bulk_docs" {
+		c.conf.Finalize()
+	} else {
+		db, err = c.conf.DB()
+		if err != nil {
+			return err
+		}
+	}
+	if c.chunkSize <= 0 {
+		return errors.Code(errors.ErrUsage, "chunk size must be positive")
+	}
+	opts := []kivik.Option{c.opts()}
+	if cmd.Flags().Changed("new-edits") {
+		opts = append(opts, kivik.Param("new_edits", c.newEdits))
+	}
+
+	c.log.Debugf("[post] Will bulk update documents: %s/%s", client.DSN(), db)
+	results := []bulkDocResult{}
+	chunk := make([]json.RawMessage, 0, c.chunkSize)
+	send := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		c.log.Debugf("[post] Sending %d documents", len(chunk))
+		res, err := c.bulkDocs(cmd.Context(), client.DB(db), chunk, opts)
+		if err != nil {
+			return err
+		}
+		results = append(results, res...)
+		chunk = chunk[:0]
+		return nil
+	}
+	err = c.Documents(func(doc json.RawMessage) error {
+		chunk = append(chunk, doc)
+		if len(chunk) < c.chunkSize {
+			return nil
+		}
+		return send()
+	})
+	if err != nil {
+		return err
+	}
+	if err := send(); err != nil {
+		return err
+	}
+
+	var failed, status int
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		state := "ok"
+		if !result.OK {
+			state = result.Error
+			if result.Reason != "" {
+				state += ": " + result.Reason
+			}
+			failed++
+			if status == 0 {
+				status = result.status
+			}
+		}
+		rows = append(rows, []string{result.ID, result.Rev, state})
+	}
+	if err := c.fmt.Output(output.TableReader([]string{"ID", "REV", "STATUS"}, rows, output.JSONReader(results))); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errors.HTTPStatusf(status, "%d of %d documents failed", failed, len(results))
+	}
+	return nil
+}
+
+// bulkDocs sends a single chunk of documents, returning one result per
+// document.
+func (r *root) bulkDocs(ctx context.Context, db *kivik.DB, chunk []json.RawMessage, opts []kivik.Option) ([]bulkDocResult, error) {
+	docs := make([]interface{}, len(chunk))
+	for i, doc := range chunk {
+		docs[i] = doc
+	}
+	var res []kivik.BulkResult
+	err := r.retry(func() error {
+		var err error
+		res, err = db.BulkDocs(ctx, docs, opts...)
+		return err
+	})
+	if err != nil && kivik.HTTPStatus(err) != http.StatusExpectationFailed {
+		return nil, err
+	}
+
+	if len(res) == len(chunk) {
+		results := make([]bulkDocResult, len(res))
+		for i, result := range res {
+			results[i] = newBulkDocResult(result.ID, result.Rev, result.Error)
+		}
+		return results, nil
+	}
+
+	// With new_edits=false, CouchDB reports only failures, and when all
+	// documents are rejected, the driver reports only the error. Results are
+	// reported in the order of the input, so they are matched to the input by
+	// position, skipping documents without a result, which keeps several
+	// revisions of the same document apart.
+	results := make([]bulkDocResult, len(chunk))
+	var j int
+	for i, raw := range chunk {
+		var doc struct {
+			ID  string `json:"_id"`
+			Rev string `json:"_rev"`
+		}
+		_ = json.Unmarshal(raw, &doc)
+		docErr := err
+		if j < len(res) && res[j].ID == doc.ID && (res[j].Rev == "" || res[j].Rev == doc.Rev) {
+			docErr = res[j].Error
+			j++
+		}
+		results[i] = newBulkDocResult(doc.ID, doc.Rev, docErr)
+	}
+	return results, nil
+}
+
+func newBulkDocResult(id, rev string, err error) bulkDocResult {
+	if err == nil {
+		return bulkDocResult{ID: id, Rev: rev, OK: true}
+	}
+	result := bulkDocResult{
+		ID:     id,
+		Error:  "error",
+		Reason: err.Error(),
+		status: kivik.HTTPStatus(err),
+	}
+	switch result.status {
+	case http.StatusConflict:
+		result.Error = "conflict"
+	case http.StatusExpectationFailed:
+		result.Error = "rejected"
+	}
+	return result
+}
@@ -0,0 +1,168 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// bulkDocsValidator checks that a request is a _bulk_docs request with the
+// body want.
+func bulkDocsValidator(want string) testy.RequestValidator {
+	return gunzip(func(t *testing.T, req *http.Request) {
+		if req.URL.Path != "/db/_bulk_docs" {
+			t.Errorf("Unexpected path: %s", req.URL.Path)
+		}
+		if d := testy.DiffAsJSON([]byte(want), req.Body); d != nil {
+			t.Error(d)
+		}
+	})
+}
+
+func Test_post_bulk_docs_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing database", cmdTest{
+		args:   []string{"post", "bulk-docs", "--data", `[{}]`},
+		status: errors.ErrUsage,
+	})
+	tests.Add("missing data", cmdTest{
+		args:   []string{"post", "bulk-docs", "http://example.com/db"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid chunk size", cmdTest{
+		args:   []string{"post", "bulk-docs", "http://example.com/db", "--data", `[{}]`, "--chunk-size", "0"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("json array", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			StatusCode: http.StatusCreated,
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`[{"ok":true,"id":"foo","rev":"1-abc"},{"ok":true,"id":"bar","rev":"1-def"}]`)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_bulk_docs" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+			if d := testy.DiffAsJSON(testy.Snapshot(t), req.Body); d != nil {
+				t.Error(d)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"post", "bulk-docs", s.URL + "/db", "--data", `[{"_id":"foo","name":"Bob"},{"_id":"bar","name":"Alice"}]`},
+		}
+	})
+	tests.Add("ndjson chunks", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(gunzipBody(t, r.Body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path + " " + strings.TrimSpace(string(body)) {
+			case `/db/_bulk_docs {"docs":[{"_id":"a"},{"_id":"b"}]}`:
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"a","rev":"1-10"},{"ok":true,"id":"b","rev":"1-11"}]`)
+			case `/db/_bulk_docs {"docs":[{"_id":"c"},{}]}`:
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"c","rev":"1-20"},{"ok":true,"id":"generated-2-1","rev":"1-21"}]`)
+			case `/db/_bulk_docs {"docs":[{"_id":"e"}]}`:
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"e","rev":"1-30"}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s %s", r.Method, r.URL, body)
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+
+		return cmdTest{
+			args:  []string{"--debug", "post", "bulk-docs", s.URL + "/db", "--data-file", "-", "--chunk-size", "2"},
+			stdin: "{\"_id\":\"a\"}\n{\"_id\":\"b\"}\n{\"_id\":\"c\"}\n{}\n{\"_id\":\"e\"}\n",
+		}
+	})
+	tests.Add("yaml", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			StatusCode: http.StatusCreated,
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`[{"ok":true,"id":"foo","rev":"1-10"},{"ok":true,"id":"bar","rev":"1-11"},{"ok":true,"id":"baz","rev":"1-12"}]`)),
+		}, bulkDocsValidator(`{"docs":[{"_id":"foo","name":"Bob"},{"_id":"bar","name":"Alice"},{"_id":"baz","name":"Carol"}]}`))
+
+		return cmdTest{
+			args: []string{"post", s.URL + "/db/_bulk_docs", "--data-file", "./testdata/bulk.yaml", "-f", "json"},
+		}
+	})
+	tests.Add("conflict", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			StatusCode: http.StatusCreated,
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`[{"ok":true,"id":"a","rev":"1-10"},{"id":"b","error":"conflict","reason":"Document update conflict."},{"ok":true,"id":"c","rev":"1-12"}]`)),
+		}, bulkDocsValidator(`{"docs":[{"_id":"a"},{"_id":"b"},{"_id":"c"}]}`))
+
+		return cmdTest{
+			args:   []string{"post", "bulk-docs", s.URL + "/db", "--data", `[{"_id":"a"},{"_id":"b"},{"_id":"c"}]`},
+			status: errors.ErrConflict,
+		}
+	})
+	tests.Add("new edits false", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			StatusCode: http.StatusCreated,
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`[{"id":"b","error":"conflict","reason":"Document update conflict."}]`)),
+		}, bulkDocsValidator(`{"docs":[{"_id":"a","_rev":"3-abc"},{"_id":"b","_rev":"2-def"}],"new_edits":false}`))
+
+		return cmdTest{
+			args: []string{
+				"post", "bulk-docs", s.URL + "/db", "--new-edits=false",
+				"--data", `[{"_id":"a","_rev":"3-abc"},{"_id":"b","_rev":"2-def"}]`,
+			},
+			status: errors.ErrConflict,
+		}
+	})
+	tests.Add("new edits false with revisions of one document", func(t *testing.T) interface{} {
+		s := testy.ServeResponse(&http.Response{
+			StatusCode: http.StatusCreated,
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`[{"id":"a","rev":"2-def","error":"conflict","reason":"Document update conflict."}]`)),
+		})
+
+		return cmdTest{
+			args: []string{
+				"post", "bulk-docs", s.URL + "/db", "--new-edits=false",
+				"--data", `[{"_id":"a","_rev":"3-abc"},{"_id":"a","_rev":"2-def"}]`,
+			},
+			status: errors.ErrConflict,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,126 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/input"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type postRevsDiff struct {
+	*root
+	*input.Input
+	revs []string
+}
+
+func postRevsDiffCmd(p *post) *cobra.Command {
+	c := &postRevsDiff{
+		root:  p.root,
+		Input: p.Input,
+	}
+	cmd := &cobra.Command{
+		Use:   "revs-diff [dsn]/[database]/[document]",
+		Short: "Find document revisions missing from a database",
+		Long:  `Report which of the given document revisions do not exist in the database. Provide the document ID in the DSN, with --revs, or pass a map of document IDs to revisions via --data or similar.`,
+		RunE:  c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringSliceVarP(&c.revs, "revs", "R", nil, "List of revisions to check")
+
+	return cmd
+}
+
+func (c *postRevsDiff) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	var revMap map[string][]string
+	var db string
+	if c.HasInput() {
+		if err := c.As(&revMap); err != nil {
+			return err
+		}
+		dsn, err := c.conf.URL()
+		if err != nil {
+			return err
+		}
+		if cmd, dsnDB := dbCommandFromDSN(dsn); cmd == "_revs_diff" {
+			db = dsnDB
+			c.conf.Finalize()
+		}
+		if db == "" {
+			db, err = c.conf.DB()
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		var doc string
+		db, doc, err = c.conf.DBDoc()
+		if err != nil {
+			return err
+		}
+		if len(c.revs) == 0 {
+			return errors.Code(errors.ErrUsage, "--revs required")
+		}
+		revMap = map[string][]string{
+			doc: c.revs,
+		}
+	}
+
+	c.log.Debugf("[post] Will diff revisions: %s/%s (%v)", client.DSN(), db, revMap)
+	return c.retry(func() error {
+		rs := client.DB(db).RevsDiff(cmd.Context(), revMap)
+		defer rs.Close() // nolint:errcheck
+		diffs := kivik.Diffs{}
+		for rs.Next() {
+			id, err := rs.ID()
+			if err != nil {
+				return err
+			}
+			var diff kivik.RevDiff
+			if err := rs.ScanValue(&diff); err != nil {
+				return err
+			}
+			diffs[id] = diff
+		}
+		if err := rs.Err(); err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(diffs))
+		for id := range diffs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		rows := make([][]string, 0, len(ids))
+		for _, id := range ids {
+			rows = append(rows, []string{
+				id,
+				strings.Join(diffs[id].Missing, ", "),
+				strings.Join(diffs[id].PossibleAncestors, ", "),
+			})
+		}
+		return c.fmt.Output(output.TableReader([]string{"ID", "MISSING", "POSSIBLE ANCESTORS"}, rows, output.JSONReader(diffs)))
+	})
+}
@@ -0,0 +1,76 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func Test_post_revs_diff_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing dsn", cmdTest{
+		args:   []string{"post", "revs-diff"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("missing revs", cmdTest{
+		args:   []string{"post", "revs-diff", "http://example.com/db/foo"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("revs", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"foo":{"missing":["3-xxx"],"possible_ancestors":["2-bbb"]}}`)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_revs_diff" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+			if d := testy.DiffAsJSON(testy.Snapshot(t), req.Body); d != nil {
+				t.Error(d)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"post", "revs-diff", s.URL + "/db/foo", "--revs", "2-bbb,3-xxx"},
+		}
+	})
+	tests.Add("from --data", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"foo":{"missing":["3-xxx"]},"bar":{"missing":["1-yyy","2-zzz"]}}`)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if d := testy.DiffAsJSON(testy.Snapshot(t), req.Body); d != nil {
+				t.Error(d)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"post", s.URL + "/db/_revs_diff", "--data", `{"foo":["3-xxx"],"bar":["1-yyy","2-zzz"]}`, "-f", "json"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
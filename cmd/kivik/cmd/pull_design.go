@@ -0,0 +1,217 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/go-kivik/kivik/v4"
+	"github.com/go-kivik/kivik/v4/couchdb"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type pullDesign struct {
+	*root
+	dir  string
+	yaml bool
+}
+
+func pullDesignCmd(r *root) *cobra.Command {
+	c := &pullDesign{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "design <dir> [dsn]/[database]/[_design/name]",
+		Aliases: []string{"ddoc"},
+		Short:   "Pull a design document to a local directory",
+		Long: `Download a design document, and write it to a local directory, in the layout read by 'push design'.
+
+Objects are written as subdirectories, functions as .js files, and other strings as plain files. Other values are written as JSON files, or as YAML with --yaml. Attachments are written to the _attachments directory. Existing files are overwritten, but files which are not part of the design document are left in place.
+
+The document ID is taken from the DSN, from an _id file in the directory, or from the name of the directory, in that order.`,
+		PersistentPreRunE: r.dirArgs(&c.dir),
+		RunE:              c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.BoolVar(&c.yaml, "yaml", false, "Write non-string values as YAML, rather than JSON")
+
+	return cmd
+}
+
+type designPull struct {
+	ID    string   `json:"id"`
+	Rev   string   `json:"rev"`
+	Files []string `json:"files"`
+}
+
+const designPullTmpl = `Pulled {{ .ID }} ({{ .Rev }})
+{{- range .Files }}
+  {{ . }}
+{{- end }}`
+
+func (c *pullDesign) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, docID, err := c.designDocFromDSN(c.dir)
+	if err != nil {
+		return err
+	}
+
+	c.log.Debugf("[pull] Will pull design document: %s/%s/%s to %s", client.DSN(), db, docID, c.dir)
+	return c.retry(func() error {
+		var doc map[string]interface{}
+		err := client.DB(db).Get(cmd.Context(), docID, kivik.Param("attachments", true), couchdb.OptionNoMultipartGet()).ScanDoc(&doc)
+		if err != nil {
+			return err
+		}
+		w := &designWriter{dir: c.dir, yaml: c.yaml}
+		fields := make(map[string]interface{}, len(doc))
+		for k, v := range doc {
+			if !strings.HasPrefix(k, "_") || k == "_id" || k == "_attachments" {
+				fields[k] = v
+			}
+		}
+		if err := w.writeFields(c.dir, fields, true); err != nil {
+			return err
+		}
+		result := &designPull{
+			ID:    docID,
+			Files: w.files,
+		}
+		result.Rev, _ = doc["_rev"].(string)
+		return c.fmt.Output(output.TemplateReader(designPullTmpl, result, output.JSONReader(result)))
+	})
+}
+
+// designWriter writes the fields of a design document to files.
+type designWriter struct {
+	dir   string
+	yaml  bool
+	files []string
+}
+
+func (w *designWriter) writeFields(dir string, fields map[string]interface{}, top bool) error {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "" || key == ".." || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, ".") {
+			return errors.Codef(errors.ErrData, "field %q cannot be written to a file", key)
+		}
+		path := filepath.Join(dir, key)
+		switch value := fields[key].(type) {
+		case map[string]interface{}:
+			if top && key == "_attachments" {
+				if err := w.writeAttachments(path, value); err != nil {
+					return err
+				}
+				continue
+			}
+			if len(value) > 0 {
+				if err := w.writeFields(path, value, false); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := w.writeValue(path, value); err != nil {
+				return err
+			}
+		case string:
+			switch {
+			case strings.HasPrefix(strings.TrimSpace(value), "function"):
+				path += ".js"
+			case strings.Contains(key, "."):
+				// Preserve the full key, as the extension is removed on push.
+				path += ".txt"
+			}
+			if err := w.write(path, []byte(value+"\n")); err != nil {
+				return err
+			}
+		default:
+			if err := w.writeValue(path, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeValue writes a non-string value as JSON or YAML.
+func (w *designWriter) writeValue(path string, value interface{}) error {
+	if w.yaml {
+		buf, err := yaml.Marshal(value)
+		if err != nil {
+			return errors.Code(errors.ErrData, err)
+		}
+		return w.write(path+".yaml", buf)
+	}
+	buf, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		return errors.Code(errors.ErrData, err)
+	}
+	return w.write(path+".json", append(buf, '\n'))
+}
+
+func (w *designWriter) writeAttachments(dir string, atts map[string]interface{}) error {
+	names := make([]string, 0, len(atts))
+	for name := range atts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.FromSlash(name)
+		if !filepath.IsLocal(path) {
+			return errors.Codef(errors.ErrData, "attachment %q cannot be written to a file", name)
+		}
+		att, _ := atts[name].(map[string]interface{})
+		data, _ := att["data"].(string)
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return errors.Code(errors.ErrProtocol, err)
+		}
+		if err := w.write(filepath.Join(dir, path), raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *designWriter) write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { // nolint:gomnd
+		return errors.Code(errors.ErrCantCreate, err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil { // nolint:gomnd
+		return errors.Code(errors.ErrCantCreate, err)
+	}
+	rel, err := filepath.Rel(w.dir, path)
+	if err != nil {
+		return errors.Code(errors.ErrCantCreate, err)
+	}
+	w.files = append(w.files, filepath.ToSlash(rel))
+	return nil
+}
@@ -0,0 +1,121 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+const testPulledDesignDoc = `{
+	"_id": "_design/app",
+	"_rev": "1-abc",
+	"language": "javascript",
+	"options": {"partitioned": false, "local_seq": true},
+	"filters": {},
+	"lib": {"version.txt": "1.0", "limits": [10, 100]},
+	"validate_doc_update": "function(newDoc, oldDoc, userCtx) {\n  if (!newDoc.name) {\n    throw({forbidden: \"name required\"});\n  }\n}",
+	"views": {
+		"by_name": {
+			"map": "function(doc) {\n  emit(doc.name, null);\n}",
+			"reduce": "_count"
+		}
+	},
+	"_attachments": {
+		"index.html": {"content_type": "text/html; charset=utf-8", "revpos": 1, "digest": "md5-hliBN8tPp4H88fX08pTSAA==", "data": "PGgxPkhlbGxvPC9oMT4K"},
+		"css/style.css": {"content_type": "text/css; charset=utf-8", "revpos": 1, "digest": "md5-loAQUEZH41F4A8OighJDzA==", "data": "aDEgeyBjb2xvcjogcmVkOyB9Cg=="}
+	}
+}`
+
+// dirSnapshot compares the contents of each file below dir to a snapshot,
+// once the test has run.
+func dirSnapshot(t *testing.T, dir string) {
+	t.Helper()
+	t.Cleanup(func() {
+		files := map[string]string{}
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			buf, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, path)
+			files[filepath.ToSlash(rel)] = string(buf)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := testy.DiffAsJSON(testy.Snapshot(t), files); d != nil {
+			t.Error(d)
+		}
+	})
+}
+
+func Test_pull_design_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing directory argument", cmdTest{
+		args:   []string{"pull", "design"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("not found", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusNotFound, `{"error":"not_found","reason":"missing"}`), expectRequest("GET /db/_design/app?attachments=true"))
+
+		return cmdTest{
+			args:   []string{"pull", "design", t.TempDir(), s.URL + "/db/_design/app"},
+			status: errors.ErrNotFound,
+		}
+	})
+	tests.Add("pull", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, testPulledDesignDoc), expectRequest("GET /db/_design/app?attachments=true"))
+		dir := filepath.Join(t.TempDir(), "app")
+		dirSnapshot(t, dir)
+
+		return cmdTest{
+			args: []string{"pull", "design", dir, s.URL + "/db"},
+		}
+	})
+	tests.Add("yaml", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, testPulledDesignDoc), expectRequest("GET /db/_design/app?attachments=true"))
+		dir := t.TempDir()
+		dirSnapshot(t, dir)
+
+		return cmdTest{
+			args: []string{"pull", "design", dir, s.URL + "/db/_design/app", "--yaml"},
+		}
+	})
+	tests.Add("invalid field", func(t *testing.T) interface{} {
+		doc := strings.Replace(testPulledDesignDoc, `"filters"`, `"../filters"`, 1)
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, doc), expectRequest("GET /db/_design/app?attachments=true"))
+
+		return cmdTest{
+			args:   []string{"pull", "design", t.TempDir(), s.URL + "/db/_design/app"},
+			status: errors.ErrData,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,43 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func pushCmd(r *root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "push [command]",
+		Short: "Push local files to the server",
+		Long:  `Assemble documents from local files, and upload them to the server`,
+	}
+
+	cmd.AddCommand(pushDesignCmd(r))
+
+	return cmd
+}
+
+// dirArgs returns a PersistentPreRunE function for commands which take a
+// local directory as their first argument, followed by the optional DSN.
+func (r *root) dirArgs(dir *string) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.Code(errors.ErrUsage, "directory required")
+		}
+		*dir = args[0]
+		return r.init(cmd, args[1:])
+	}
+}
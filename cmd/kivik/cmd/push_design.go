@@ -0,0 +1,323 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"crypto/md5" // nolint:gosec
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/input"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type pushDesign struct {
+	*root
+	dir    string
+	dryRun bool
+}
+
+func pushDesignCmd(r *root) *cobra.Command {
+	c := &pushDesign{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "design <dir> [dsn]/[database]/[_design/name]",
+		Aliases: []string{"ddoc"},
+		Short:   "Push a design document from a local directory",
+		Long: `Assemble a design document from the files in a local directory, in the layout used by couchapp and erica, and upload it if it differs from the copy on the server.
+
+Each file or subdirectory becomes a field of the design document, named after the file without its extension, so that views/by_name/map.js becomes the map function of the by_name view. Files with a .json, .yaml, or .yml extension are parsed, so static parts of the document may be kept as JSON or YAML. Other files are read as strings, with a single trailing newline removed. Files in the _attachments directory are uploaded as attachments. Hidden files are ignored.
+
+The document ID is taken from the DSN, from an _id file in the directory, or from the name of the directory, in that order.`,
+		PersistentPreRunE: r.dirArgs(&c.dir),
+		RunE:              c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.BoolVar(&c.dryRun, "dry-run", false, "Show the changes which would be made, without uploading")
+
+	return cmd
+}
+
+// designChange is a single difference between the local and server copies of
+// a design document.
+type designChange struct {
+	Field  string `json:"field"`
+	Change string `json:"change"`
+}
+
+type designPush struct {
+	ID      string         `json:"id"`
+	Rev     string         `json:"rev,omitempty"`
+	Updated bool           `json:"updated"`
+	Changes []designChange `json:"changes"`
+}
+
+const designPushTmpl = `{{ if not .Changes }}{{ .ID }} is up to date{{ else if .Updated }}Updated {{ .ID }} to {{ .Rev }}{{ else }}Would update {{ .ID }}{{ end }}
+{{- range .Changes }}
+  {{ printf "%-8s" .Change }} {{ .Field }}
+{{- end }}`
+
+func (c *pushDesign) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, docID, err := c.designDocFromDSN(c.dir)
+	if err != nil {
+		return err
+	}
+	local, err := readDesignFields(c.dir, true)
+	if err != nil {
+		return err
+	}
+	doc := make(map[string]interface{}, len(local))
+	for k, v := range local {
+		if k != "_rev" {
+			doc[k] = v
+		}
+	}
+	doc["_id"] = docID
+
+	c.log.Debugf("[push] Will push design document: %s/%s/%s", client.DSN(), db, docID)
+	return c.retry(func() error {
+		var remote map[string]interface{}
+		err := client.DB(db).Get(cmd.Context(), docID).ScanDoc(&remote)
+		if err != nil && kivik.HTTPStatus(err) != http.StatusNotFound {
+			return err
+		}
+		result := &designPush{
+			ID:      docID,
+			Changes: diffDesign(remote, doc),
+		}
+		result.Rev, _ = remote["_rev"].(string)
+		if len(result.Changes) > 0 && !c.dryRun {
+			if result.Rev != "" {
+				doc["_rev"] = result.Rev
+			}
+			result.Rev, err = client.DB(db).Put(cmd.Context(), docID, doc)
+			if err != nil {
+				return err
+			}
+			result.Updated = true
+		}
+		return c.fmt.Output(output.TemplateReader(designPushTmpl, result, output.JSONReader(result)))
+	})
+}
+
+// designDocFromDSN returns the database and design document ID from the DSN.
+// If the DSN names no document, the ID is read from the _id file in dir, or
+// taken from the name of dir.
+func (r *root) designDocFromDSN(dir string) (db, docID string, err error) {
+	db, docID, err = r.conf.DBDoc()
+	if err != nil {
+		return "", "", err
+	}
+	if db == "" {
+		return "", "", errors.Code(errors.ErrUsage, "database required")
+	}
+	if docID == "" {
+		if id, err := os.ReadFile(filepath.Join(dir, "_id")); err == nil {
+			docID = strings.TrimSpace(string(id))
+		} else {
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return "", "", errors.Code(errors.ErrUsage, err)
+			}
+			docID = filepath.Base(abs)
+		}
+	}
+	if !strings.HasPrefix(docID, "_design/") {
+		docID = "_design/" + docID
+	}
+	return db, docID, nil
+}
+
+// readDesignFields reads each file and subdirectory of dir as a field. If top
+// is true, the _attachments directory is read as the document's attachments.
+func readDesignFields(dir string, top bool) (map[string]interface{}, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Code(errors.ErrNoInput, err)
+	}
+	fields := make(map[string]interface{}, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		key := name
+		var value interface{}
+		switch {
+		case entry.IsDir() && top && name == "_attachments":
+			value, err = readAttachments(path)
+		case entry.IsDir():
+			value, err = readDesignFields(path, false)
+		default:
+			ext := filepath.Ext(name)
+			key = strings.TrimSuffix(name, ext)
+			value, err = readDesignFile(path, ext)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := fields[key]; ok {
+			return nil, errors.Codef(errors.ErrData, "%s: duplicate field %q", dir, key)
+		}
+		fields[key] = value
+	}
+	return fields, nil
+}
+
+// readDesignFile reads a single field. JSON and YAML files are parsed, and
+// any other file is read as a string.
+func readDesignFile(path, ext string) (interface{}, error) {
+	switch ext {
+	case ".json", ".yaml", ".yml":
+		var value interface{}
+		if err := input.FromFile(path).As(&value); err != nil {
+			return nil, errors.Code(errors.ErrData, fmt.Errorf("%s: %w", path, err))
+		}
+		return value, nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Code(errors.ErrIO, err)
+	}
+	return strings.TrimSuffix(string(buf), "\n"), nil
+}
+
+// readAttachments reads each file below dir as an inline attachment, named
+// by its path relative to dir.
+func readAttachments(dir string) (map[string]interface{}, error) {
+	atts := map[string]interface{}{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		atts[filepath.ToSlash(name)] = map[string]interface{}{
+			"content_type": contentType,
+			"data":         base64.StdEncoding.EncodeToString(data),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Code(errors.ErrIO, err)
+	}
+	return atts, nil
+}
+
+// diffDesign compares two design documents, field by field. Nested objects
+// are compared by their individual fields, and attachments by their digests.
+func diffDesign(remote, local map[string]interface{}) []designChange {
+	before, after := map[string]interface{}{}, map[string]interface{}{}
+	flattenDesign(before, "", remote)
+	flattenDesign(after, "", local)
+
+	fields := make([]string, 0, len(after))
+	for field := range after {
+		fields = append(fields, field)
+	}
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []designChange{}
+	for _, field := range fields {
+		old, inRemote := before[field]
+		value, inLocal := after[field]
+		switch {
+		case !inRemote:
+			changes = append(changes, designChange{Field: field, Change: "added"})
+		case !inLocal:
+			changes = append(changes, designChange{Field: field, Change: "removed"})
+		case !reflect.DeepEqual(old, value):
+			changes = append(changes, designChange{Field: field, Change: "modified"})
+		}
+	}
+	return changes
+}
+
+func flattenDesign(fields map[string]interface{}, prefix string, doc map[string]interface{}) {
+	for key, value := range doc {
+		if prefix == "" {
+			switch key {
+			case "_id", "_rev":
+				continue
+			case "_attachments":
+				atts, _ := value.(map[string]interface{})
+				for name, att := range atts {
+					fields["_attachments/"+name] = attachmentDigest(att)
+				}
+				continue
+			}
+		}
+		if obj, ok := value.(map[string]interface{}); ok && len(obj) > 0 {
+			flattenDesign(fields, prefix+key+".", obj)
+			continue
+		}
+		fields[prefix+key] = value
+	}
+}
+
+// attachmentDigest returns the digest of an attachment stub, or calculates it
+// from the data of an inline attachment.
+func attachmentDigest(att interface{}) string {
+	obj, _ := att.(map[string]interface{})
+	if digest, ok := obj["digest"].(string); ok {
+		return digest
+	}
+	data, _ := obj["data"].(string)
+	raw, _ := base64.StdEncoding.DecodeString(data)
+	sum := md5.Sum(raw) // nolint:gosec
+	return "md5-" + base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,190 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+const testDesignDoc = `{
+	"_id": "_design/app",
+	"_rev": "1-abc",
+	"language": "javascript",
+	"options": {"partitioned": false, "local_seq": true},
+	"validate_doc_update": "function(newDoc, oldDoc, userCtx) {\n  if (!newDoc.name) {\n    throw({forbidden: \"name required\"});\n  }\n}",
+	"views": {
+		"by_name": {
+			"map": "function(doc) {\n  emit(doc.name, null);\n}",
+			"reduce": "_count"
+		}
+	},
+	"_attachments": {
+		"index.html": {"content_type": "text/html; charset=utf-8", "revpos": 1, "digest": "md5-hliBN8tPp4H88fX08pTSAA==", "length": 15, "stub": true},
+		"css/style.css": {"content_type": "text/css; charset=utf-8", "revpos": 1, "digest": "md5-loAQUEZH41F4A8OighJDzA==", "length": 19, "stub": true}
+	}
+}`
+
+const testModifiedDesignDoc = `{
+	"_id": "_design/app",
+	"_rev": "1-abc",
+	"language": "javascript",
+	"options": {"partitioned": false},
+	"views": {
+		"by_name": {
+			"map": "function(doc) {\n  emit(doc.name, 1);\n}",
+			"reduce": "_count"
+		},
+		"by_age": {
+			"map": "function(doc) {\n  emit(doc.age, null);\n}"
+		}
+	},
+	"_attachments": {
+		"index.html": {"content_type": "text/html; charset=utf-8", "revpos": 1, "digest": "md5-1B2M2Y8AsgTpgAmY7PhCfg==", "length": 0, "stub": true}
+	}
+}`
+
+func Test_push_design_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing directory argument", cmdTest{
+		args:   []string{"push", "design"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("missing database", cmdTest{
+		args:   []string{"push", "design", "./testdata/design/app", "http://example.com/"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("directory not found", cmdTest{
+		args:   []string{"push", "design", "./testdata/design/missing", "http://example.com/db"},
+		status: errors.ErrNoInput,
+	})
+	tests.Add("new", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /db/_design/app":
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, `{"error":"not_found","reason":"missing"}`)
+			case "PUT /db/_design/app":
+				if d := testy.DiffAsJSON(testy.Snapshot(t), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("ETag", `"2-def"`)
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true,"id":"_design/app","rev":"2-def"}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"push", "design", "./testdata/design/app", s.URL + "/db"},
+		}
+	})
+	tests.Add("up to date", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, testDesignDoc), expectRequest("GET /db/_design/app"))
+
+		return cmdTest{
+			args: []string{"push", "design", "./testdata/design/app", s.URL + "/db"},
+		}
+	})
+	tests.Add("modified", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /db/_design/app":
+				_, _ = io.WriteString(w, testModifiedDesignDoc)
+			case "PUT /db/_design/app":
+				if d := testy.DiffAsJSON(testy.Snapshot(t), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("ETag", `"2-def"`)
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true,"id":"_design/app","rev":"2-def"}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"push", "design", "./testdata/design/app", s.URL + "/db"},
+		}
+	})
+	tests.Add("modified json", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /db/_design/app":
+				_, _ = io.WriteString(w, testModifiedDesignDoc)
+			case "PUT /db/_design/app":
+				if d := testy.DiffAsJSON(testy.Snapshot(t), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("ETag", `"2-def"`)
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true,"id":"_design/app","rev":"2-def"}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"push", "design", "./testdata/design/app", s.URL + "/db", "-f", "json"},
+		}
+	})
+	tests.Add("dry run", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, testModifiedDesignDoc), expectRequest("GET /db/_design/app"))
+
+		return cmdTest{
+			args: []string{"push", "design", "./testdata/design/app", s.URL + "/db", "--dry-run"},
+		}
+	})
+	tests.Add("id from dsn", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.Path {
+			case "GET /db/_design/other":
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, `{"error":"not_found","reason":"missing"}`)
+			case "PUT /db/_design/other":
+				if d := testy.DiffAsJSON(testy.Snapshot(t), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("ETag", `"2-def"`)
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `{"ok":true,"id":"_design/other","rev":"2-def"}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"push", "design", "./testdata/design/app", s.URL + "/db/_design/other"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -23,7 +23,7 @@ type put struct {
 	*input.Input
 	*root
 
-	db, doc, att, cf, sec *cobra.Command
+	db, doc, att, cf, sec, idx, rep *cobra.Command
 }
 
 func putCmd(r *root) *cobra.Command {
@@ -36,6 +36,8 @@ func putCmd(r *root) *cobra.Command {
 	c.att = putAttCmd(c)
 	c.cf = putConfigCmd(c)
 	c.sec = putSecurityCmd(c)
+	c.idx = putIndexCmd(c)
+	c.rep = putReplicationCmd(c)
 
 	cmd := &cobra.Command{
 		Use:   "put",
@@ -51,6 +53,8 @@ func putCmd(r *root) *cobra.Command {
 	cmd.AddCommand(c.att)
 	cmd.AddCommand(c.cf)
 	cmd.AddCommand(c.sec)
+	cmd.AddCommand(c.idx)
+	cmd.AddCommand(c.rep)
 
 	return cmd
 }
@@ -66,6 +70,9 @@ func (c *put) RunE(cmd *cobra.Command, args []string) error {
 	if _, ok := securityFromDSN(dsn); ok {
 		return c.sec.RunE(cmd, args)
 	}
+	if _, _, _, ok := indexFromDSN(dsn); ok {
+		return c.idx.RunE(cmd, args)
+	}
 	if c.conf.HasAttachment() {
 		return c.att.RunE(cmd, args)
 	}
@@ -13,26 +13,36 @@
 package cmd
 
 import (
+	"net/url"
+
 	"github.com/spf13/cobra"
 
+	"github.com/go-kivik/kivik/v4"
+
 	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
 )
 
 type putDB struct {
 	*root
+	partitioned bool
 }
 
 func putDBCmd(r *root) *cobra.Command {
 	g := &putDB{
 		root: r,
 	}
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:     "database [dsn]/[database]",
 		Aliases: []string{"db"},
 		Short:   "Create a database",
 		Long:    `Create the named database`,
 		RunE:    g.RunE,
 	}
+
+	pf := cmd.PersistentFlags()
+	pf.BoolVar(&g.partitioned, "partitioned", false, "Create a partitioned database. Requires CouchDB 3.0.0 or newer.")
+
+	return cmd
 }
 
 func (c *putDB) RunE(cmd *cobra.Command, _ []string) error {
@@ -44,9 +54,13 @@ func (c *putDB) RunE(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
+	var opts []kivik.Option
+	if c.partitioned {
+		opts = append(opts, createDBParam{"partitioned": []string{"true"}})
+	}
 	c.log.Debugf("[create] Will create database: %s/%s", client.DSN(), db)
 	return c.retry(func() error {
-		err := client.CreateDB(cmd.Context(), db)
+		err := client.CreateDB(cmd.Context(), db, opts...)
 		if err != nil {
 			return err
 		}
@@ -54,3 +68,20 @@ func (c *putDB) RunE(cmd *cobra.Command, _ []string) error {
 		return c.fmt.Output(output.TemplateReader("OK", nil, output.JSONReader(map[string]interface{}{"ok": true})))
 	})
 }
+
+// createDBParam sets query parameters for CreateDB. kivik.Param can't be used,
+// as the CouchDB driver applies options to a nil url.Values.
+type createDBParam url.Values
+
+func (p createDBParam) Apply(target interface{}) {
+	q, ok := target.(*url.Values)
+	if !ok {
+		return
+	}
+	if *q == nil {
+		*q = url.Values{}
+	}
+	for k, v := range p {
+		(*q)[k] = append((*q)[k], v...)
+	}
+}
@@ -41,6 +41,19 @@ func Test_put_database_RunE(t *testing.T) {
 			args: []string{"--debug", "put", "database", s.URL + "/foo"},
 		}
 	})
+	tests.Add("partitioned", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Body: io.NopCloser(strings.NewReader(`{"status":"ok"}`)),
+		}, func(t *testing.T, req *http.Request) {
+			if want, got := "partitioned=true", req.URL.RawQuery; want != got {
+				t.Errorf("Unexpected query: %s", got)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"put", "database", s.URL + "/foo", "--partitioned"},
+		}
+	})
 
 	tests.Run(t, func(t *testing.T, tt cmdTest) {
 		tt.Test(t)
@@ -0,0 +1,262 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+	"github.com/go-kivik/kivik/v4/couchdb/chttp"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/input"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type putIndex struct {
+	*root
+	*input.Input
+	ddoc, name string
+}
+
+func putIndexCmd(p *put) *cobra.Command {
+	c := &putIndex{
+		root:  p.root,
+		Input: p.Input,
+	}
+	cmd := &cobra.Command{
+		Use:     "index [dsn]/[database]",
+		Aliases: []string{"idx"},
+		Short:   "Create a Mango index",
+		Long: `Create one or more Mango indexes, if they do not already exist.
+
+The input data may be a single index definition, or a list of definitions, in the same format accepted by the /{db}/_index endpoint:
+
+    ddoc: foo
+    name: by-name
+    index:
+      fields: [name]
+
+An index which already exists with an equal definition is reported as 'exists'.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.ddoc, "ddoc", "", "Design document name. Overrides the value from the input data.")
+	pf.StringVar(&c.name, "name", "", "Index name. Overrides the value from the input data.")
+
+	return cmd
+}
+
+// indexDef is an index definition, as accepted by the /{db}/_index endpoint.
+type indexDef struct {
+	DDoc  string                 `json:"ddoc,omitempty"`
+	Name  string                 `json:"name,omitempty"`
+	Type  string                 `json:"type,omitempty"`
+	Index map[string]interface{} `json:"index"`
+}
+
+type indexResult struct {
+	DDoc   string `json:"ddoc,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Result string `json:"result"`
+}
+
+func (c *putIndex) definitions() ([]*indexDef, error) {
+	var raw json.RawMessage
+	if err := c.As(&raw); err != nil {
+		return nil, err
+	}
+	var defs []*indexDef
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		if err := json.Unmarshal(raw, &defs); err != nil {
+			return nil, errors.Code(errors.ErrData, err)
+		}
+	} else {
+		def := new(indexDef)
+		if err := json.Unmarshal(raw, def); err != nil {
+			return nil, errors.Code(errors.ErrData, err)
+		}
+		defs = []*indexDef{def}
+	}
+	if len(defs) != 1 && (c.ddoc != "" || c.name != "") {
+		return nil, errors.Code(errors.ErrUsage, "--ddoc and --name may only be used with a single index definition")
+	}
+	for _, def := range defs {
+		if c.ddoc != "" {
+			def.DDoc = c.ddoc
+		}
+		if c.name != "" {
+			def.Name = c.name
+		}
+		def.DDoc = strings.TrimPrefix(def.DDoc, "_design/")
+		if len(def.Index) == 0 {
+			return nil, errors.Code(errors.ErrData, "index definition required")
+		}
+	}
+	return defs, nil
+}
+
+func (c *putIndex) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, ddoc, name, err := c.indexDB()
+	if err != nil {
+		return err
+	}
+	if c.ddoc == "" {
+		c.ddoc = ddoc
+	}
+	if c.name == "" {
+		c.name = name
+	}
+	defs, err := c.definitions()
+	if err != nil {
+		return err
+	}
+
+	c.log.Debugf("[put] Will create %d index(es): %s/%s", len(defs), client.DSN(), db)
+	var existing []kivik.Index
+	err = c.retry(func() error {
+		var err error
+		existing, err = client.DB(db).GetIndexes(cmd.Context())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	results := make([]indexResult, 0, len(defs))
+	for _, def := range defs {
+		result, err := c.createIndex(cmd.Context(), db, existing, def)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		ddoc := result.DDoc
+		if ddoc == "" {
+			ddoc = "-"
+		}
+		name := result.Name
+		if name == "" {
+			name = "-"
+		}
+		rows = append(rows, []string{ddoc, name, result.Result})
+	}
+	var data interface{} = results
+	if len(results) == 1 {
+		data = results[0]
+	}
+	return c.fmt.Output(output.TableReader([]string{"DDOC", "NAME", "RESULT"}, rows, output.JSONReader(data)))
+}
+
+func (c *putIndex) createIndex(ctx context.Context, db string, existing []kivik.Index, def *indexDef) (indexResult, error) {
+	for _, idx := range existing {
+		if indexEqual(idx, def) {
+			c.log.Debugf("[put] Index %s/%s already exists", idx.DesignDoc, idx.Name)
+			return indexResult{
+				DDoc:   strings.TrimPrefix(idx.DesignDoc, "_design/"),
+				Name:   idx.Name,
+				Result: "exists",
+			}, nil
+		}
+	}
+	couch, err := c.couch()
+	if err != nil {
+		return indexResult{}, err
+	}
+	query := url.Values{}
+	for k, v := range c.options {
+		query.Set(k, fmt.Sprint(v))
+	}
+	// The index is posted directly, as the driver does not send its type.
+	var response struct {
+		Result string `json:"result"`
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+	}
+	err = c.retry(func() error {
+		return couch.DoJSON(ctx, http.MethodPost, "/"+url.PathEscape(db)+"/_index", &chttp.Options{
+			Query:   query,
+			GetBody: chttp.BodyEncoder(def),
+		}, &response)
+	})
+	if err != nil {
+		return indexResult{}, err
+	}
+	return indexResult{
+		DDoc:   strings.TrimPrefix(response.ID, "_design/"),
+		Name:   response.Name,
+		Result: response.Result,
+	}, nil
+}
+
+// indexEqual returns true if idx, as returned by the server, is equivalent to
+// def. When def does not specify a design doc or name, any index with an
+// equivalent definition is considered equal.
+func indexEqual(idx kivik.Index, def *indexDef) bool {
+	if def.DDoc != "" && strings.TrimPrefix(idx.DesignDoc, "_design/") != def.DDoc {
+		return false
+	}
+	if def.Name != "" && idx.Name != def.Name {
+		return false
+	}
+	typ := def.Type
+	if typ == "" {
+		typ = "json"
+	}
+	if idx.Type != typ {
+		return false
+	}
+	return reflect.DeepEqual(normalizeIndex(idx.Definition), normalizeIndex(def.Index))
+}
+
+// normalizeIndex converts an index definition to a canonical form for
+// comparison, expanding bare field names to {"field":"asc"}.
+func normalizeIndex(def interface{}) map[string]interface{} {
+	var obj map[string]interface{}
+	buf, _ := json.Marshal(def)
+	_ = json.Unmarshal(buf, &obj)
+	if obj == nil {
+		obj = map[string]interface{}{}
+	}
+	if fields, ok := obj["fields"].([]interface{}); ok {
+		for i, field := range fields {
+			if name, ok := field.(string); ok {
+				fields[i] = map[string]interface{}{name: "asc"}
+			}
+		}
+	}
+	result := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		if m, ok := v.(map[string]interface{}); ok && len(m) == 0 {
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func Test_put_index_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing definition", cmdTest{
+		args:   []string{"put", "index", "http://example.com/db", "--data", `{"ddoc":"foo"}`},
+		status: errors.ErrData,
+	})
+	tests.Add("flags with multiple definitions", cmdTest{
+		args:   []string{"put", "index", "http://example.com/db", "--data-file", "./testdata/indexes.yaml", "--name", "foo"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("create and exists", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method {
+			case http.MethodGet:
+				_, _ = w.Write([]byte(indexesResponse))
+			case http.MethodPost:
+				if d := testy.DiffAsJSON(testy.Snapshot(t), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = w.Write([]byte(`{"result":"created","id":"_design/foo","name":"by-age"}`))
+			default:
+				t.Errorf("Unexpected method: %s", r.Method)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"put", "index", s.URL + "/db", "--data-file", "./testdata/indexes.yaml"},
+		}
+	})
+	tests.Add("text index exists on server", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method {
+			case http.MethodGet:
+				_, _ = w.Write([]byte(indexesResponse))
+			case http.MethodPost:
+				if d := testy.DiffAsJSON(testy.Snapshot(t), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				_, _ = w.Write([]byte(`{"result":"exists","id":"_design/search","name":"by-text"}`))
+			default:
+				t.Errorf("Unexpected method: %s", r.Method)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"put", "index", s.URL + "/db", "--data", `{"ddoc":"search","name":"by-text","type":"text","index":{"fields":[{"name":"name","type":"string"}]}}`},
+		}
+	})
+	tests.Add("auto exists", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				t.Errorf("Unexpected method: %s", r.Method)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(indexesResponse))
+		}))
+
+		return cmdTest{
+			args: []string{"put", s.URL + "/db/_index", "--data", `{"index":{"fields":["name"]}}`, "-f", "json"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,205 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/input"
+)
+
+type putReplication struct {
+	*root
+	*input.Input
+	replicatorDB string
+}
+
+func putReplicationCmd(p *put) *cobra.Command {
+	c := &putReplication{
+		root:  p.root,
+		Input: p.Input,
+	}
+	cmd := &cobra.Command{
+		Use:     "replication [dsn]/[replicator-db]/[name]",
+		Aliases: []string{"rep"},
+		Short:   "Create or update a persistent replication",
+		Long: `Create or update the named replication document in a replicator database, from a JSON or YAML spec.
+
+The source and target may each be a URL, the name of a kivik context, optionally followed by /database, or an object with context and database fields. Contexts are resolved from the config file, and their credentials are added to the replication document. Any other fields, such as filter, selector, doc_ids, continuous, or create_target, are stored unchanged. For example:
+
+    source: production/orders
+    target:
+      context: backup
+      database: orders
+    continuous: true
+    selector:
+      type: order
+
+If the replication document already exists, it is updated only if the spec has changed.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.replicatorDB, "replicator-db", defaultReplicatorDB, "Replicator database, if not included in the DSN")
+
+	return cmd
+}
+
+func (c *putReplication) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, name, err := c.replicatorDoc(c.replicatorDB)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errors.Code(errors.ErrUsage, "replication name required")
+	}
+
+	var spec map[string]interface{}
+	if err := c.As(&spec); err != nil {
+		return err
+	}
+	doc := make(map[string]interface{}, len(spec))
+	for k, v := range spec {
+		if k != "_id" && k != "_rev" {
+			doc[k] = v
+		}
+	}
+	for _, field := range []string{"source", "target"} {
+		doc[field], err = c.replicationEndpoint(field, spec[field])
+		if err != nil {
+			return err
+		}
+	}
+
+	c.log.Debugf("[put] Will put replication: %s/%s/%s", client.DSN(), db, name)
+	return c.retry(func() error {
+		var current map[string]interface{}
+		err := client.DB(db).Get(cmd.Context(), name).ScanDoc(&current)
+		switch {
+		case kivik.HTTPStatus(err) == http.StatusNotFound:
+		case err != nil:
+			return err
+		default:
+			rev, _ := current["_rev"].(string)
+			unchanged, err := replicationUnchanged(current, doc)
+			if err != nil {
+				return err
+			}
+			if unchanged {
+				c.log.Debugf("[put] Replication %s is unchanged", name)
+				return c.fmt.UpdateResult(name, rev)
+			}
+			doc["_rev"] = rev
+		}
+		newRev, err := client.DB(db).Put(cmd.Context(), name, doc)
+		if err != nil {
+			return err
+		}
+		return c.fmt.UpdateResult(name, newRev)
+	})
+}
+
+// replicationEndpoint resolves the source or target of a replication spec.
+// URLs, and objects without a context field, are returned unchanged.
+func (r *root) replicationEndpoint(field string, endpoint interface{}) (interface{}, error) {
+	var name, db string
+	switch t := endpoint.(type) {
+	case nil:
+		return nil, errors.Codef(errors.ErrUsage, "replication %s required", field)
+	case string:
+		if strings.Contains(t, "://") {
+			return t, nil
+		}
+		name, db, _ = strings.Cut(t, "/")
+	case map[string]interface{}:
+		cxName, ok := t["context"].(string)
+		if !ok {
+			return t, nil
+		}
+		name = cxName
+		db, _ = t["database"].(string)
+	default:
+		return nil, errors.Codef(errors.ErrUsage, "invalid replication %s: expected URL, context, or object", field)
+	}
+
+	cx, ok := r.conf.Contexts[name]
+	if !ok {
+		return nil, errors.Codef(errors.ErrUsage, "replication %s: context %q not found", field, name)
+	}
+	if db == "" {
+		db = strings.Trim(cx.Database, "/")
+	}
+	if db == "" {
+		return nil, errors.Codef(errors.ErrUsage, "replication %s: no database for context %q", field, name)
+	}
+	addr := &url.URL{Host: cx.Host, Path: "/" + db}
+	switch cx.Scheme {
+	case "", "http", "couch", "couchdb":
+		addr.Scheme = "http"
+	case "https", "couchs", "couchdbs":
+		addr.Scheme = "https"
+	default:
+		return nil, errors.Codef(errors.ErrUsage, "replication %s: context %q is not a CouchDB server", field, name)
+	}
+	user, password, err := cx.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	if user == "" {
+		return addr.String(), nil
+	}
+	return map[string]interface{}{
+		"url": addr.String(),
+		"auth": map[string]interface{}{
+			"basic": map[string]interface{}{
+				"username": user,
+				"password": password,
+			},
+		},
+	}, nil
+}
+
+// replicationUnchanged reports whether the stored replication document
+// matches doc, ignoring the fields maintained by CouchDB.
+func replicationUnchanged(current, doc map[string]interface{}) (bool, error) {
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return false, err
+	}
+	var want map[string]interface{}
+	if err := json.Unmarshal(buf, &want); err != nil {
+		return false, err
+	}
+	got := make(map[string]interface{}, len(current))
+	for k, v := range current {
+		switch {
+		case k == "_id", k == "_rev", k == "owner", strings.HasPrefix(k, "_replication_"):
+			continue
+		}
+		got[k] = v
+	}
+	return reflect.DeepEqual(got, want), nil
+}
@@ -0,0 +1,452 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type query struct {
+	*root
+	key, keys, startKey, endKey string
+	group, reduce, includeDocs  bool
+	groupLevel, limit, pageSize int
+	stale, update, partition    string
+
+	// allDocs queries /{db}/_all_docs, rather than a view.
+	allDocs bool
+}
+
+func queryCmd(r *root) *cobra.Command {
+	c := &query{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "query [dsn]/[database]/_design/[ddoc]/_view/[view]",
+		Aliases: []string{"view"},
+		Short:   "Query a MapReduce view",
+		Long: `Query a MapReduce view, paging through the results automatically.
+
+Key values (--key, --keys, --startkey, --endkey) are interpreted as JSON when valid, and as plain strings otherwise.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	c.rangeFlags(pf)
+	pf.BoolVar(&c.group, "group", false, "Group the results to a group or single row")
+	pf.IntVar(&c.groupLevel, "group-level", 0, "Group the results to the specified key array length")
+	pf.BoolVar(&c.reduce, "reduce", true, "Use the reduce function, if defined")
+	pf.StringVar(&c.stale, "stale", "", "Allow stale results. One of: ok|update_after")
+	pf.StringVar(&c.update, "update", "", "Whether to update the view before returning results. One of: true|false|lazy")
+
+	return cmd
+}
+
+func getAllDocsCmd(r *root) *cobra.Command {
+	c := &query{
+		root:    r,
+		allDocs: true,
+	}
+	cmd := &cobra.Command{
+		Use:   "all-docs [dsn]/[database]",
+		Short: "List the documents in a database",
+		Long: `List the documents in a database, paging through the results automatically.
+
+Key values (--key, --keys, --startkey, --endkey) are interpreted as JSON when valid, and as plain strings otherwise.`,
+		RunE: c.RunE,
+	}
+
+	c.rangeFlags(cmd.PersistentFlags())
+
+	return cmd
+}
+
+// rangeFlags configures the flags shared by view and _all_docs queries.
+func (c *query) rangeFlags(pf *pflag.FlagSet) {
+	pf.StringVar(&c.key, "key", "", "Return only rows that match the specified key")
+	pf.StringVar(&c.keys, "keys", "", "Return only rows that match one of the specified keys, as a JSON array or comma-separated list")
+	pf.StringVar(&c.startKey, "startkey", "", "Return rows starting with the specified key")
+	pf.StringVar(&c.endKey, "endkey", "", "Stop returning rows when the specified key is reached")
+	pf.BoolVar(&c.includeDocs, "include-docs", false, "Include the associated document with each row")
+	pf.IntVar(&c.limit, "limit", 0, "Maximum number of rows to return. 0 returns all rows.")
+	pf.IntVar(&c.pageSize, "page-size", 1000, "Number of rows to request per page") // nolint:gomnd
+	pf.StringVarP(&c.partition, "partition", "p", "", "Limit the query to the named partition of a partitioned database")
+}
+
+// viewFromDSN parses a DSN in the form /{db}/_design/{ddoc}/_view/{view}, or
+// /{db}/_partition/{partition}/_design/{ddoc}/_view/{view}.
+func viewFromDSN(dsn *url.URL) (db, ddoc, view, partition string, ok bool) {
+	path := dsn.Path
+	if pdb, part, rest, ok := partitionFromDSN(dsn); ok {
+		path, partition = "/"+pdb+"/"+rest, part
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != 6 || parts[2] != "_design" || parts[4] != "_view" { // nolint:gomnd
+		return "", "", "", "", false
+	}
+	return parts[1], parts[3], parts[5], partition, true
+}
+
+// allDocsFromDSN parses a DSN in the form /{db}/_all_docs, or
+// /{db}/_partition/{partition}/_all_docs.
+func allDocsFromDSN(dsn *url.URL) (db, partition string, ok bool) {
+	if db, partition, rest, ok := partitionFromDSN(dsn); ok && rest == "_all_docs" {
+		return db, partition, true
+	}
+	if command, db := dbCommandFromDSN(dsn); command == "_all_docs" {
+		return db, "", true
+	}
+	return "", "", false
+}
+
+// jsonKeyOpts are the query options which are interpreted as JSON.
+var jsonKeyOpts = []string{"keys", "startkey", "start_key", "endkey", "end_key"}
+
+// jsonOrString returns val as a json.RawMessage if it is valid JSON, or
+// unaltered otherwise.
+func jsonOrString(val string) interface{} {
+	if json.Valid([]byte(val)) {
+		return json.RawMessage(val)
+	}
+	return val
+}
+
+func (c *query) queryOpts(cmd *cobra.Command) (map[string]interface{}, error) {
+	opts := make(map[string]interface{}, len(c.options))
+	for k, v := range c.options {
+		switch k {
+		case "limit":
+			if c.limit == 0 {
+				if _, err := fmt.Sscan(fmt.Sprint(v), &c.limit); err != nil {
+					return nil, errors.Codef(errors.ErrUsage, "invalid limit: %v", v)
+				}
+			}
+		case "key":
+			if c.key == "" {
+				c.key = fmt.Sprint(v)
+			}
+		case "include_docs":
+			c.includeDocs = c.includeDocs || fmt.Sprint(v) == "true"
+		default:
+			opts[k] = v
+		}
+	}
+	for _, k := range jsonKeyOpts {
+		if v, ok := opts[k].(string); ok {
+			opts[k] = jsonOrString(v)
+		}
+	}
+	if c.key != "" {
+		// A single key is expressed as a range, so that it may be paged.
+		opts["startkey"] = jsonOrString(c.key)
+		opts["endkey"] = opts["startkey"]
+	}
+	if c.keys != "" {
+		if keys := jsonOrString(c.keys); keys != c.keys {
+			opts["keys"] = keys
+		} else {
+			opts["keys"] = strings.Split(c.keys, ",")
+		}
+	}
+	if keys, ok := opts["keys"].(json.RawMessage); ok {
+		var list []interface{}
+		if err := json.Unmarshal(keys, &list); err != nil {
+			return nil, errors.Code(errors.ErrUsage, "keys must be a JSON array")
+		}
+		opts["keys"] = list
+	}
+	if c.startKey != "" {
+		opts["startkey"] = jsonOrString(c.startKey)
+	}
+	if c.endKey != "" {
+		opts["endkey"] = jsonOrString(c.endKey)
+	}
+	if c.group {
+		opts["group"] = true
+	}
+	if c.groupLevel > 0 {
+		opts["group_level"] = c.groupLevel
+	}
+	if cmd.Flags().Changed("reduce") {
+		opts["reduce"] = c.reduce
+	}
+	if c.includeDocs {
+		opts["include_docs"] = true
+	}
+	if c.stale != "" {
+		opts["stale"] = c.stale
+	}
+	if c.update != "" {
+		opts["update"] = c.update
+	}
+	if c.pageSize <= 0 {
+		return nil, errors.Code(errors.ErrUsage, "page size must be positive")
+	}
+	return opts, nil
+}
+
+func (c *query) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	dsn, err := c.conf.URL()
+	if err != nil {
+		return err
+	}
+	var db, ddoc, view, partition string
+	if c.allDocs {
+		var ok bool
+		if db, partition, ok = allDocsFromDSN(dsn); ok {
+			c.conf.Finalize()
+		} else if db, err = c.conf.DB(); err != nil {
+			return err
+		}
+	} else {
+		var ok bool
+		db, ddoc, view, partition, ok = viewFromDSN(dsn)
+		if !ok {
+			return errors.Code(errors.ErrUsage, "view path of the form [database]/_design/[ddoc]/_view/[view] required")
+		}
+		c.conf.Finalize()
+	}
+	if partition != "" {
+		c.partition = partition
+	}
+	opts, err := c.queryOpts(cmd)
+	if err != nil {
+		return err
+	}
+	if c.allDocs {
+		c.log.Debugf("[query] Will list documents: %s/%s", client.DSN(), db)
+	} else {
+		c.log.Debugf("[query] Will query view: %s/%s/_design/%s/_view/%s", client.DSN(), db, ddoc, view)
+	}
+	result := &viewResult{
+		pages: func(ctx context.Context, page func([]viewRow) error) error {
+			return c.queryPages(ctx, client.DB(db), ddoc, view, opts, page)
+		},
+		ctx: cmd.Context(),
+	}
+	return c.fmt.Output(result)
+}
+
+// queryPages queries the view, calling page for each page of results. Queries
+// with explicit keys are not paged.
+func (c *query) queryPages(ctx context.Context, db *kivik.DB, ddoc, view string, opts map[string]interface{}, page func([]viewRow) error) error {
+	if _, ok := opts["keys"]; ok {
+		if c.limit > 0 {
+			opts["limit"] = c.limit
+		}
+		var rows []viewRow
+		err := c.retry(func() error {
+			var err error
+			rows, err = c.fetchRows(ctx, db, ddoc, view, opts)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return page(rows)
+	}
+	remaining := c.limit
+	for {
+		size := c.pageSize
+		if c.limit > 0 && remaining < size {
+			size = remaining
+		}
+		opts["limit"] = size + 1
+		var rows []viewRow
+		err := c.retry(func() error {
+			var err error
+			rows, err = c.fetchRows(ctx, db, ddoc, view, opts)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		more := len(rows) > size
+		if more {
+			rows = rows[:size]
+		}
+		if err := page(rows); err != nil {
+			return err
+		}
+		remaining -= len(rows)
+		if !more || (c.limit > 0 && remaining <= 0) {
+			return nil
+		}
+		next := rows[len(rows)-1]
+		c.log.Debugf("[query] Fetching next page, starting after key %s", next.Key)
+		// Fetch the next page starting with the last row, which is
+		// skipped, as it was already returned.
+		opts["startkey"] = next.Key
+		if next.ID != "" {
+			opts["startkey_docid"] = next.ID
+		}
+		opts["skip"] = 1
+	}
+}
+
+func (c *query) fetchRows(ctx context.Context, db *kivik.DB, ddoc, view string, opts map[string]interface{}) ([]viewRow, error) {
+	options := append([]kivik.Option{kivik.Params(opts)}, partitionOpts(c.partition)...)
+	var rs *kivik.ResultSet
+	if c.allDocs {
+		rs = db.AllDocs(ctx, options...)
+	} else {
+		rs = db.Query(ctx, ddoc, view, options...)
+	}
+	defer rs.Close() // nolint:errcheck
+	var rows []viewRow
+	for rs.Next() {
+		var row viewRow
+		var err error
+		if row.ID, err = rs.ID(); err != nil {
+			return nil, err
+		}
+		if err := rs.ScanKey(&row.Key); err != nil {
+			return nil, err
+		}
+		if err := rs.ScanValue(&row.Value); err != nil {
+			return nil, err
+		}
+		if c.includeDocs {
+			if err := rs.ScanDoc(&row.Doc); err != nil {
+				return nil, err
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, rs.Err()
+}
+
+type viewRow struct {
+	ID    string          `json:"id,omitempty"`
+	Key   json.RawMessage `json:"key"`
+	Value json.RawMessage `json:"value"`
+	Doc   json.RawMessage `json:"doc,omitempty"`
+}
+
+// viewResult streams the results of a view query, one page at a time. In
+// friendly mode, the rows are rendered as a table. Otherwise, a JSON array of
+// rows is produced.
+type viewResult struct {
+	io.Reader
+	ctx   context.Context
+	pages func(context.Context, func([]viewRow) error) error
+}
+
+var _ output.FriendlyOutput = &viewResult{}
+
+func (v *viewResult) Read(p []byte) (int, error) {
+	if v.Reader == nil {
+		r, w := io.Pipe()
+		v.Reader = r
+		go func() {
+			_ = w.CloseWithError(v.writeJSON(w))
+		}()
+	}
+	return v.Reader.Read(p)
+}
+
+func (v *viewResult) writeJSON(w io.Writer) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	sep := ""
+	err := v.pages(v.ctx, func(rows []viewRow) error {
+		for _, row := range rows {
+			buf, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s%s", sep, buf); err != nil {
+				return err
+			}
+			sep = ","
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+// Execute renders the rows as a table. Column widths are determined by the
+// first page of results, so that subsequent pages can be written as they
+// arrive, while remaining aligned.
+func (v *viewResult) Execute(w io.Writer) error {
+	var widths []int
+	var withID bool
+	return v.pages(v.ctx, func(rows []viewRow) error {
+		if len(rows) == 0 {
+			return nil
+		}
+		lines := make([][]string, 0, len(rows)+1)
+		if widths == nil {
+			withID = rows[0].ID != ""
+			lines = append(lines, viewColumns(withID, "ID", "KEY", "", "VALUE"))
+		}
+		for _, row := range rows {
+			lines = append(lines, viewColumns(withID, row.ID, string(row.Key), "→", string(row.Value)))
+		}
+		if widths == nil {
+			widths = make([]int, len(lines[0]))
+			for _, line := range lines {
+				for i, col := range line {
+					if n := utf8.RuneCountInString(col); n > widths[i] {
+						widths[i] = n
+					}
+				}
+			}
+		}
+		for _, line := range lines {
+			for i, col := range line[:len(line)-1] {
+				pad := widths[i] - utf8.RuneCountInString(col)
+				if pad < 0 {
+					pad = 0
+				}
+				if _, err := fmt.Fprintf(w, "%s%s  ", col, strings.Repeat(" ", pad)); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintln(w, line[len(line)-1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func viewColumns(withID bool, id, key, sep, value string) []string {
+	if withID {
+		return []string{id, key, sep, value}
+	}
+	return []string{key, sep, value}
+}
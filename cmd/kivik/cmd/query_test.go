@@ -0,0 +1,166 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+func Test_query_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing view", cmdTest{
+		args:   []string{"query", "http://example.com/db"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid keys", cmdTest{
+		args:   []string{"query", "http://example.com/db/_design/foo/_view/bar", "--keys", `{"a":1}`},
+		status: errors.ErrUsage,
+	})
+	tests.Add("reduce with options", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"rows":[{"key":["a"],"value":3},{"key":["b"],"value":12}]}`)),
+		}, func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_design/foo/_view/bar" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+			want := "endkey=%5B%22b%22%5D&group_level=1&limit=1001&stale=ok&startkey=%5B%22a%22%5D"
+			if q := req.URL.RawQuery; q != want {
+				t.Errorf("Unexpected query: %s", q)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"query", s.URL + "/db/_design/foo/_view/bar", "--startkey", `["a"]`, "--endkey", `["b"]`, "--group-level", "1", "--stale", "ok"},
+		}
+	})
+	tests.Add("keys", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"total_rows":2,"offset":0,"rows":[{"id":"x","key":"a","value":null},{"id":"y","key":"b","value":null}]}`)),
+		}, gunzip(func(t *testing.T, req *http.Request) {
+			if req.Method != http.MethodPost {
+				t.Errorf("Unexpected method: %s", req.Method)
+			}
+			if d := testy.DiffAsJSON(testy.Snapshot(t), req.Body); d != nil {
+				t.Error(d)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"query", s.URL + "/db/_design/foo/_view/bar", "--keys", "a,b", "--reduce=false", "-f", "json"},
+		}
+	})
+	tests.Add("auto get view", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"total_rows":1,"offset":0,"rows":[{"id":"x","key":"a","value":1}]}`)),
+		}, func(t *testing.T, req *http.Request) {
+			want := "endkey=%22a%22&limit=1001&startkey=%22a%22"
+			if q := req.URL.RawQuery; q != want {
+				t.Errorf("Unexpected query: %s", q)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/db/_design/foo/_view/bar?key=%22a%22"},
+		}
+	})
+	tests.Add("partition", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"rows":[{"id":"sensor:1","key":"a","value":1}]}`)),
+		}, func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_partition/sensor/_design/foo/_view/bar" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"query", s.URL + "/db/_design/foo/_view/bar", "--partition", "sensor"},
+		}
+	})
+	tests.Add("auto get partitioned view", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"rows":[{"id":"sensor:1","key":"a","value":1}]}`)),
+		}, func(t *testing.T, req *http.Request) {
+			if req.URL.Path != "/db/_partition/sensor/_design/foo/_view/bar" {
+				t.Errorf("Unexpected path: %s", req.URL.Path)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"get", s.URL + "/db/_partition/sensor/_design/foo/_view/bar"},
+		}
+	})
+	tests.Add("auto paging", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/_design/foo/_view/bar?limit=3&startkey=1":
+				_, _ = io.WriteString(w, `{"total_rows":5,"offset":1,"rows":[{"id":"doc1","key":1,"value":"v1"},{"id":"doc2","key":2,"value":"v2"},{"id":"doc3","key":3,"value":"v3"}]}`)
+			case "GET /db/_design/foo/_view/bar?limit=3&skip=1&startkey=2&startkey_docid=doc2":
+				_, _ = io.WriteString(w, `{"total_rows":5,"offset":3,"rows":[{"id":"doc3","key":3,"value":"v3"},{"id":"doc4","key":4,"value":"v4"}]}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"--debug", "query", s.URL + "/db/_design/foo/_view/bar", "--page-size", "2", "-O", "startkey=1"},
+		}
+	})
+	tests.Add("limit across pages", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/_design/foo/_view/bar?limit=3":
+				_, _ = io.WriteString(w, `{"total_rows":10,"offset":0,"rows":[{"id":"doc0","key":0,"value":"v0"},{"id":"doc1","key":1,"value":"v1"},{"id":"doc2","key":2,"value":"v2"}]}`)
+			case "GET /db/_design/foo/_view/bar?limit=2&skip=1&startkey=1&startkey_docid=doc1":
+				_, _ = io.WriteString(w, `{"total_rows":10,"offset":2,"rows":[{"id":"doc2","key":2,"value":"v2"},{"id":"doc3","key":3,"value":"v3"}]}`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"query", s.URL + "/db/_design/foo/_view/bar", "--limit", "3", "--page-size", "2", "-f", "raw"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
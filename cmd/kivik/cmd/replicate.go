@@ -73,6 +73,7 @@ func (c *replicate) connect(key string) (*kivik.DB, error) {
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", key, err)
 	}
+	c.contextFlags(cx)
 	db, err := cx.DB()
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", key, err)
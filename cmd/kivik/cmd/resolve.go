@@ -0,0 +1,490 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/input"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+const (
+	strategyLatest = "latest"
+	strategyWinner = "winner"
+	strategyMerge  = "merge"
+)
+
+type resolve struct {
+	*root
+	*input.Input
+	strategy  string
+	timeField string
+	chunkSize int
+}
+
+func resolveCmd(r *root) *cobra.Command {
+	c := &resolve{
+		root:  r,
+		Input: input.New(),
+	}
+	cmd := &cobra.Command{
+		Use:   "resolve [dsn]/[database]/[document]",
+		Short: "Resolve document conflicts",
+		Long: `Show and resolve conflicts between the leaf revisions of a document.
+
+Without --strategy or a merge document, the fields which differ between the conflicting leaves are shown. To resolve the conflict, select a strategy:
+
+  winner  Keep the revision CouchDB selected as the winner.
+  latest  Keep the revision with the greatest value of --time-field.
+  merge   Combine the fields of all leaves. Fails if any field has
+          conflicting values.
+
+Alternatively, provide the resolved document via --data or --data-file, to be saved on top of the winning revision. All losing leaves are deleted with _bulk_docs requests of at most --chunk-size documents.
+
+When no document ID is given, all conflicted documents in the database are listed, or resolved with the selected strategy.`,
+		RunE: c.RunE,
+	}
+
+	c.Input.ConfigFlags(cmd.PersistentFlags())
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.strategy, "strategy", "", "Resolution strategy: latest, winner or merge")
+	pf.StringVar(&c.timeField, "time-field", "updated_at", "Field to compare with the latest strategy. Use dots to select nested fields.")
+	pf.IntVar(&c.chunkSize, "chunk-size", 500, "Number of documents to send per _bulk_docs request") // nolint:gomnd
+
+	return cmd
+}
+
+// conflictLeaf is a non-deleted leaf revision of a document.
+type conflictLeaf struct {
+	Rev  string
+	Body map[string]interface{}
+}
+
+// conflictDiff describes the fields which differ between a document's leaf
+// revisions.
+type conflictDiff struct {
+	ID     string                                `json:"id"`
+	Winner string                                `json:"winner"`
+	Leaves []string                              `json:"leaves"`
+	Diff   map[string]map[string]json.RawMessage `json:"diff"`
+}
+
+// resolveResult is the outcome of resolving a single leaf revision.
+type resolveResult struct {
+	ID     string `json:"id"`
+	Rev    string `json:"rev,omitempty"`
+	Action string `json:"action"`
+	NewRev string `json:"new_rev,omitempty"`
+	OK     bool   `json:"ok,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+
+	err error
+}
+
+func (c *resolve) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, docID, err := c.conf.DBDoc()
+	if err != nil {
+		return err
+	}
+	switch c.strategy {
+	case "", strategyLatest, strategyWinner, strategyMerge:
+	default:
+		return errors.Codef(errors.ErrUsage, "unknown strategy: %s", c.strategy)
+	}
+	if c.chunkSize <= 0 {
+		return errors.Code(errors.ErrUsage, "chunk size must be positive")
+	}
+	var mergeDoc map[string]interface{}
+	if c.HasInput() {
+		if c.strategy != "" {
+			return errors.Code(errors.ErrUsage, "--strategy and --data/--data-file are mutually exclusive")
+		}
+		if docID == "" {
+			return errors.Code(errors.ErrUsage, "a merge document requires a document ID")
+		}
+		if err := c.As(&mergeDoc); err != nil {
+			return err
+		}
+	}
+
+	if docID == "" {
+		c.log.Debugf("[resolve] Will find conflicted documents: %s/%s", client.DSN(), db)
+		return c.resolveDB(cmd.Context(), client.DB(db))
+	}
+
+	c.log.Debugf("[resolve] Will resolve conflicts: %s/%s/%s", client.DSN(), db, docID)
+	var leaves []conflictLeaf
+	err = c.retry(func() error {
+		var err error
+		leaves, err = c.leaves(cmd.Context(), client.DB(db), docID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	diff := diffLeaves(docID, leaves)
+	if len(leaves) < 2 { // nolint:gomnd
+		return c.fmt.Output(output.TemplateReader(`{{ .ID }} has no conflicts`, diff, output.JSONReader(diff)))
+	}
+	if c.strategy == "" && mergeDoc == nil {
+		header := []string{"FIELD"}
+		for _, leaf := range leaves {
+			label := leaf.Rev
+			if leaf.Rev == diff.Winner {
+				label += " (winner)"
+			}
+			header = append(header, label)
+		}
+		fields := make([]string, 0, len(diff.Diff))
+		for field := range diff.Diff {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		rows := make([][]string, 0, len(fields))
+		for _, field := range fields {
+			row := []string{field}
+			for _, leaf := range leaves {
+				value, ok := diff.Diff[field][leaf.Rev]
+				if !ok {
+					value = json.RawMessage("-")
+				}
+				row = append(row, string(value))
+			}
+			rows = append(rows, row)
+		}
+		return c.fmt.Output(output.TableReader(header, rows, output.JSONReader(diff)))
+	}
+
+	ops, results, err := c.plan(docID, leaves, mergeDoc)
+	if err != nil {
+		return err
+	}
+	return c.apply(cmd.Context(), client.DB(db), ops, results)
+}
+
+// resolveDB lists, or resolves, all conflicted documents in db.
+func (c *resolve) resolveDB(ctx context.Context, db *kivik.DB) error {
+	conflicts := map[string][]string{}
+	var ids []string
+	err := c.retry(func() error {
+		conflicts, ids = map[string][]string{}, nil
+		rs := db.AllDocs(ctx, kivik.Params(map[string]interface{}{
+			"include_docs": true,
+			"conflicts":    true,
+		}))
+		defer rs.Close() // nolint:errcheck
+		for rs.Next() {
+			var doc struct {
+				ID        string   `json:"_id"`
+				Conflicts []string `json:"_conflicts"`
+			}
+			if err := rs.ScanDoc(&doc); err != nil {
+				return err
+			}
+			if len(doc.Conflicts) > 0 {
+				ids = append(ids, doc.ID)
+				conflicts[doc.ID] = doc.Conflicts
+			}
+		}
+		return rs.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.strategy == "" {
+		rows := make([][]string, 0, len(ids))
+		for _, id := range ids {
+			rows = append(rows, []string{id, strings.Join(conflicts[id], ", ")})
+		}
+		return c.fmt.Output(output.TableReader([]string{"ID", "CONFLICTS"}, rows, output.JSONReader(conflicts)))
+	}
+
+	var ops []interface{}
+	results := []resolveResult{}
+	for _, id := range ids {
+		var leaves []conflictLeaf
+		err := c.retry(func() error {
+			var err error
+			leaves, err = c.leaves(ctx, db, id)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		docOps, docResults, err := c.plan(id, leaves, nil)
+		if err != nil {
+			c.log.Debugf("[resolve] Unable to resolve %s: %s", id, err)
+			results = append(results, resolveResult{
+				ID:     id,
+				Action: "unresolved",
+				Error:  "unresolved",
+				Reason: err.Error(),
+				err:    err,
+			})
+			continue
+		}
+		ops = append(ops, docOps...)
+		results = append(results, docResults...)
+	}
+	return c.apply(ctx, db, ops, results)
+}
+
+// leaves returns the non-deleted leaf revisions of the document, with the
+// winning revision first.
+func (c *resolve) leaves(ctx context.Context, db *kivik.DB, docID string) ([]conflictLeaf, error) {
+	docs, err := openRevs(ctx, db, docID, c.opts())
+	if err != nil {
+		return nil, err
+	}
+	leaves := make([]conflictLeaf, 0, len(docs))
+	for _, doc := range docs {
+		var body map[string]interface{}
+		if err := json.Unmarshal(doc, &body); err != nil {
+			return nil, errors.Code(errors.ErrProtocol, err)
+		}
+		rev, _ := body["_rev"].(string)
+		if deleted, _ := body["_deleted"].(bool); deleted || rev == "" {
+			continue
+		}
+		leaves = append(leaves, conflictLeaf{Rev: rev, Body: body})
+	}
+	if len(leaves) == 0 {
+		return nil, errors.Codef(errors.ErrNotFound, "%s: no available leaf revisions", docID)
+	}
+	// CouchDB selects the non-deleted leaf with the highest revision as the
+	// winner.
+	sort.Slice(leaves, func(i, j int) bool {
+		return revLess(leaves[j].Rev, leaves[i].Rev)
+	})
+	return leaves, nil
+}
+
+// diffLeaves returns the top-level fields whose values differ between leaves.
+func diffLeaves(docID string, leaves []conflictLeaf) *conflictDiff {
+	diff := &conflictDiff{
+		ID:     docID,
+		Winner: leaves[0].Rev,
+		Diff:   map[string]map[string]json.RawMessage{},
+	}
+	fields := map[string]struct{}{}
+	for _, leaf := range leaves {
+		diff.Leaves = append(diff.Leaves, leaf.Rev)
+		for field := range leaf.Body {
+			fields[field] = struct{}{}
+		}
+	}
+	for field := range fields {
+		if field == "_rev" || field == "_revisions" {
+			continue
+		}
+		values := map[string]json.RawMessage{}
+		var differ bool
+		for _, leaf := range leaves {
+			value, ok := leaf.Body[field]
+			if !ok {
+				differ = true
+				continue
+			}
+			if !reflect.DeepEqual(value, leaves[0].Body[field]) {
+				differ = true
+			}
+			values[leaf.Rev], _ = json.Marshal(value)
+		}
+		if differ {
+			diff.Diff[field] = values
+		}
+	}
+	return diff
+}
+
+// plan returns the _bulk_docs operations needed to resolve the conflict, and
+// a result for each leaf.
+func (c *resolve) plan(docID string, leaves []conflictLeaf, mergeDoc map[string]interface{}) ([]interface{}, []resolveResult, error) {
+	keep := leaves[0]
+	var update map[string]interface{}
+	switch {
+	case mergeDoc != nil:
+		update = mergeDoc
+	case c.strategy == strategyMerge:
+		var err error
+		if update, err = mergeLeaves(docID, leaves); err != nil {
+			return nil, nil, err
+		}
+	case c.strategy == strategyLatest:
+		var latest interface{}
+		for i, leaf := range leaves {
+			value, ok := fieldValue(leaf.Body, c.timeField)
+			if !ok {
+				return nil, nil, errors.Codef(errors.ErrData, "%s: revision %s has no field %q", docID, leaf.Rev, c.timeField)
+			}
+			if i == 0 {
+				latest = value
+				continue
+			}
+			cmp, ok := compareValues(value, latest)
+			if !ok {
+				return nil, nil, errors.Codef(errors.ErrData, "%s: field %q is not comparable between revisions", docID, c.timeField)
+			}
+			if cmp > 0 {
+				keep, latest = leaf, value
+			}
+		}
+	}
+
+	var ops []interface{}
+	var results []resolveResult
+	if update != nil {
+		doc := make(map[string]interface{}, len(update))
+		for k, v := range update {
+			doc[k] = v
+		}
+		doc["_id"] = docID
+		doc["_rev"] = keep.Rev
+		ops = append(ops, doc)
+		results = append(results, resolveResult{ID: docID, Rev: keep.Rev, Action: "updated"})
+	} else {
+		results = append(results, resolveResult{ID: docID, Rev: keep.Rev, Action: "kept", OK: true})
+	}
+	for _, leaf := range leaves {
+		if leaf.Rev == keep.Rev {
+			continue
+		}
+		ops = append(ops, map[string]interface{}{
+			"_id":      docID,
+			"_rev":     leaf.Rev,
+			"_deleted": true,
+		})
+		results = append(results, resolveResult{ID: docID, Rev: leaf.Rev, Action: "deleted"})
+	}
+	return ops, results, nil
+}
+
+// mergeLeaves combines the fields of all leaves, failing if any field has
+// conflicting values. Attachments are taken from the winning revision.
+func mergeLeaves(docID string, leaves []conflictLeaf) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+	for _, leaf := range leaves {
+		fields := make([]string, 0, len(leaf.Body))
+		for field := range leaf.Body {
+			fields = append(fields, field)
+		}
+		// Sorted, so the reported conflict is deterministic.
+		sort.Strings(fields)
+		for _, field := range fields {
+			value := leaf.Body[field]
+			switch field {
+			case "_id", "_rev", "_revisions", "_attachments":
+				continue
+			}
+			existing, ok := merged[field]
+			if !ok {
+				merged[field] = value
+				continue
+			}
+			if !reflect.DeepEqual(existing, value) {
+				return nil, errors.Codef(errors.ErrData, "%s: conflicting values for field %q; provide a merge document instead", docID, field)
+			}
+		}
+	}
+	if att, ok := leaves[0].Body["_attachments"]; ok {
+		merged["_attachments"] = att
+	}
+	return merged, nil
+}
+
+// apply sends the operations in _bulk_docs requests of at most chunkSize
+// documents, and reports the results. results contains one entry per
+// operation, in order, plus entries for kept and unresolved documents.
+func (c *resolve) apply(ctx context.Context, db *kivik.DB, ops []interface{}, results []resolveResult) error {
+	if len(ops) > 0 {
+		res := make([]bulkDocResult, 0, len(ops))
+		for start := 0; start < len(ops); start += c.chunkSize {
+			end := start + c.chunkSize
+			if end > len(ops) {
+				end = len(ops)
+			}
+			chunk := make([]json.RawMessage, 0, end-start)
+			for _, op := range ops[start:end] {
+				doc, err := json.Marshal(op)
+				if err != nil {
+					return err
+				}
+				chunk = append(chunk, doc)
+			}
+			c.log.Debugf("[resolve] Sending %d updates", len(chunk))
+			chunkRes, err := c.bulkDocs(ctx, db, chunk, nil)
+			if err != nil {
+				return err
+			}
+			res = append(res, chunkRes...)
+		}
+		var i int
+		for j := range results {
+			switch results[j].Action {
+			case "kept", "unresolved":
+				continue
+			}
+			r := res[i]
+			i++
+			results[j].OK = r.OK
+			results[j].NewRev = r.Rev
+			results[j].Error = r.Error
+			results[j].Reason = r.Reason
+			if !r.OK {
+				results[j].err = errors.HTTPStatus(r.status, r.Reason)
+			}
+		}
+	}
+
+	var failed int
+	var failure error
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		state := "ok"
+		if !result.OK {
+			state = result.Error
+			if result.Reason != "" {
+				state += ": " + result.Reason
+			}
+			failed++
+			if failure == nil {
+				failure = result.err
+			}
+		}
+		rows = append(rows, []string{result.ID, result.Rev, result.Action, state})
+	}
+	if err := c.fmt.Output(output.TableReader([]string{"ID", "REV", "ACTION", "STATUS"}, rows, output.JSONReader(results))); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errors.Codef(errors.InspectErrorCode(failure), "%d of %d resolutions failed", failed, len(results))
+	}
+	return nil
+}
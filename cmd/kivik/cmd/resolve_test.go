@@ -0,0 +1,336 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// conflictedFoo is the open_revs=all response for foo, with two conflicting
+// leaves and one deleted leaf.
+var conflictedFoo = multipartLeaves(
+	`{"_id":"foo","_rev":"3-ccc","name":"Bob","age":42,"updated_at":"2021-01-04"}`,
+	`{"_id":"foo","_rev":"3-ddd","name":"Robert","updated_at":"2021-01-03","email":"bob@example.com"}`,
+	`{"_id":"foo","_rev":"4-fff","_deleted":true}`,
+)
+
+// leavesResponse returns an open_revs=all response with body.
+func leavesResponse(body string) *http.Response {
+	return &http.Response{
+		Header: http.Header{
+			"Content-Type": []string{`multipart/mixed; boundary="abc123"`},
+		},
+		Body: io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// openRevsValidator checks that a request fetches all leaves of docID.
+func openRevsValidator(docID string) testy.RequestValidator {
+	return func(t *testing.T, req *http.Request) {
+		if want, got := "GET /db/"+docID+"?open_revs=all", req.Method+" "+req.URL.String(); want != got {
+			t.Errorf("Unexpected request: %s", got)
+		}
+	}
+}
+
+func Test_resolve_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing database", cmdTest{
+		args:   []string{"resolve"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("unknown strategy", cmdTest{
+		args:   []string{"resolve", "http://example.com/db/foo", "--strategy", "oldest"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("strategy and data", cmdTest{
+		args:   []string{"resolve", "http://example.com/db/foo", "--strategy", "winner", "--data", `{}`},
+		status: errors.ErrUsage,
+	})
+	tests.Add("data without document", cmdTest{
+		args:   []string{"resolve", "http://example.com/db", "--data", `{}`},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid chunk size", cmdTest{
+		args:   []string{"resolve", "http://example.com/db", "--strategy", "winner", "--chunk-size", "0"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("diff", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, leavesResponse(conflictedFoo), openRevsValidator("foo"))
+
+		return cmdTest{
+			args: []string{"resolve", s.URL + "/db/foo"},
+		}
+	})
+	tests.Add("diff json", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, leavesResponse(conflictedFoo), openRevsValidator("foo"))
+
+		return cmdTest{
+			args: []string{"resolve", s.URL + "/db/foo", "-f", "json"},
+		}
+	})
+	tests.Add("no conflicts", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, leavesResponse(multipartLeaves(
+			`{"_id":"foo","_rev":"3-ccc","name":"Bob","age":42,"updated_at":"2021-01-04"}`,
+		)), openRevsValidator("foo"))
+
+		return cmdTest{
+			args: []string{"resolve", s.URL + "/db/foo", "--strategy", "winner"},
+		}
+	})
+	tests.Add("winner", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/foo?open_revs=all":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, conflictedFoo)
+			case "POST /db/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(`{"docs":[{"_deleted":true,"_id":"foo","_rev":"3-ccc"}]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"foo","rev":"4-new"}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"resolve", s.URL + "/db/foo", "--strategy", "winner"},
+		}
+	})
+	tests.Add("update conflict", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/foo?open_revs=all":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, conflictedFoo)
+			case "POST /db/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(`{"docs":[{"_deleted":true,"_id":"foo","_rev":"3-ccc"}]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"id":"foo","error":"conflict","reason":"Document update conflict."}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args:   []string{"resolve", s.URL + "/db/foo", "--strategy", "winner"},
+			status: errors.ErrConflict,
+		}
+	})
+	tests.Add("latest", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/foo?open_revs=all":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, conflictedFoo)
+			case "POST /db/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(`{"docs":[{"_deleted":true,"_id":"foo","_rev":"3-ddd"}]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"foo","rev":"4-new"}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"resolve", s.URL + "/db/foo", "--strategy", "latest"},
+		}
+	})
+	tests.Add("latest missing field", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, leavesResponse(conflictedFoo), openRevsValidator("foo"))
+
+		return cmdTest{
+			args:   []string{"resolve", s.URL + "/db/foo", "--strategy", "latest", "--time-field", "modified"},
+			status: errors.ErrData,
+		}
+	})
+	tests.Add("merge conflict", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, leavesResponse(conflictedFoo), openRevsValidator("foo"))
+
+		return cmdTest{
+			args:   []string{"resolve", s.URL + "/db/foo", "--strategy", "merge"},
+			status: errors.ErrData,
+		}
+	})
+	tests.Add("merge", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/foo?open_revs=all":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, multipartLeaves(
+					`{"_id":"foo","_rev":"3-ccc","name":"Bob","age":42}`,
+					`{"_id":"foo","_rev":"3-ddd","name":"Bob","email":"bob@example.com"}`,
+				))
+			case "POST /db/_bulk_docs":
+				want := `{"docs":[{"_id":"foo","_rev":"3-ddd","age":42,"email":"bob@example.com","name":"Bob"},{"_deleted":true,"_id":"foo","_rev":"3-ccc"}]}`
+				if d := testy.DiffAsJSON([]byte(want), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"foo","rev":"4-new"},{"ok":true,"id":"foo","rev":"4-new"}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"resolve", s.URL + "/db/foo", "--strategy", "merge", "-f", "json"},
+		}
+	})
+	tests.Add("merge document", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/foo?open_revs=all":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, conflictedFoo)
+			case "POST /db/_bulk_docs":
+				want := `{"docs":[{"_id":"foo","_rev":"3-ddd","age":42,"name":"Robert"},{"_deleted":true,"_id":"foo","_rev":"3-ccc"}]}`
+				if d := testy.DiffAsJSON([]byte(want), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"foo","rev":"4-new"},{"ok":true,"id":"foo","rev":"4-new"}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"resolve", s.URL + "/db/foo", "--data", `{"name":"Robert","age":42}`},
+		}
+	})
+	tests.Add("list database", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{
+			Header: http.Header{
+				"Content-Type": []string{"application/json"},
+			},
+			Body: io.NopCloser(strings.NewReader(`{"total_rows":1,"offset":0,"rows":[{"id":"foo","key":"foo","value":{},"doc":{"_id":"foo","_conflicts":["3-ccc"]}}]}`)),
+		}, func(t *testing.T, req *http.Request) {
+			if want, got := "/db/_all_docs?conflicts=true&include_docs=true", req.URL.String(); want != got {
+				t.Errorf("Unexpected request: %s", got)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"resolve", s.URL + "/db"},
+		}
+	})
+	tests.Add("resolve database", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/_all_docs?conflicts=true&include_docs=true":
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"total_rows":2,"offset":0,"rows":[`+
+					`{"id":"bar","key":"bar","value":{},"doc":{"_id":"bar","_conflicts":["2-aaa"]}},`+
+					`{"id":"foo","key":"foo","value":{},"doc":{"_id":"foo","_conflicts":["3-ccc"]}}]}`)
+			case "GET /db/bar?open_revs=all":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, multipartLeaves(
+					`{"_id":"bar","_rev":"2-aaa","updated_at":1}`,
+					`{"_id":"bar","_rev":"2-bbb"}`,
+				))
+			case "GET /db/foo?open_revs=all":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, conflictedFoo)
+			case "POST /db/_bulk_docs":
+				if d := testy.DiffAsJSON([]byte(`{"docs":[{"_deleted":true,"_id":"foo","_rev":"3-ddd"}]}`), gunzipBody(t, r.Body)); d != nil {
+					t.Error(d)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, `[{"ok":true,"id":"foo","rev":"4-new"}]`)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args:   []string{"resolve", s.URL + "/db", "--strategy", "latest"},
+			status: errors.ErrData,
+		}
+	})
+	tests.Add("resolve database in chunks", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method + " " + r.URL.String() {
+			case "GET /db/_all_docs?conflicts=true&include_docs=true":
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"total_rows":2,"offset":0,"rows":[`+
+					`{"id":"bar","key":"bar","value":{},"doc":{"_id":"bar","_conflicts":["2-aaa"]}},`+
+					`{"id":"foo","key":"foo","value":{},"doc":{"_id":"foo","_conflicts":["3-ccc"]}}]}`)
+			case "GET /db/bar?open_revs=all":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, multipartLeaves(
+					`{"_id":"bar","_rev":"2-aaa","updated_at":1}`,
+					`{"_id":"bar","_rev":"2-bbb"}`,
+				))
+			case "GET /db/foo?open_revs=all":
+				w.Header().Set("Content-Type", `multipart/mixed; boundary="abc123"`)
+				_, _ = io.WriteString(w, conflictedFoo)
+			case "POST /db/_bulk_docs":
+				body, err := io.ReadAll(gunzipBody(t, r.Body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				switch strings.TrimSpace(string(body)) {
+				case `{"docs":[{"_deleted":true,"_id":"bar","_rev":"2-aaa"}]}`:
+					w.WriteHeader(http.StatusCreated)
+					_, _ = io.WriteString(w, `[{"ok":true,"id":"bar","rev":"3-new"}]`)
+				case `{"docs":[{"_deleted":true,"_id":"foo","_rev":"3-ccc"}]}`:
+					w.WriteHeader(http.StatusCreated)
+					_, _ = io.WriteString(w, `[{"ok":true,"id":"foo","rev":"4-new"}]`)
+				default:
+					t.Errorf("Unexpected _bulk_docs body: %s", body)
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"resolve", s.URL + "/db", "--strategy", "winner", "--chunk-size", "1"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
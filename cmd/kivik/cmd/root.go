@@ -40,12 +40,13 @@ import (
 )
 
 type root struct {
-	confFile string
-	debug    bool
-	log      log.Logger
-	conf     *config.Config
-	cmd      *cobra.Command
-	fmt      *output.Formatter
+	confFile   string
+	useContext string
+	debug      bool
+	log        log.Logger
+	conf       *config.Config
+	cmd        *cobra.Command
+	fmt        *output.Formatter
 
 	requestTimeout       string
 	parsedRequestTimeout time.Duration
@@ -53,9 +54,27 @@ type root struct {
 	connectTimeout       string
 	parsedConnectTimeout time.Duration
 	retryTimeout         string
-	options              map[string]interface{}
-	stringOptions        map[string]string
-	boolOptions          map[string]string
+
+	// TLS flags, which override the context
+	caFile                    string
+	certFile                  string
+	keyFile                   string
+	insecureSkipVerify        bool
+	serverName                string
+	tlsHandshakeTimeout       string
+	parsedTLSHandshakeTimeout time.Duration
+
+	// HTTP flags, which override the context
+	proxy          string
+	userAgent      string
+	requestHeaders []string
+	parsedHeaders  map[string]string
+	unixSocket     string
+	resolve        []string
+
+	options       map[string]interface{}
+	stringOptions map[string]string
+	boolOptions   map[string]string
 
 	trace      *chttp.ClientTrace
 	dumpHeader bool
@@ -70,6 +89,8 @@ type root struct {
 
 	// resolveHome is used to resolve ~ in the default config file path
 	resolveHome func(string) string
+	// now returns the current time, for calculating elapsed times
+	now func() time.Time
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -122,6 +143,7 @@ func rootCmd(lg log.Logger) *root {
 		log:         lg,
 		fmt:         formatter(),
 		resolveHome: resolveHome,
+		now:         time.Now,
 	}
 	r.cmd = &cobra.Command{
 		Use:               "kivik",
@@ -138,6 +160,7 @@ func rootCmd(lg log.Logger) *root {
 
 	r.fmt.ConfigFlags(pf)
 	pf.StringVar(&r.confFile, "config", "~/.kivik/config", "Path to config file to use for CLI requests")
+	pf.StringVar(&r.useContext, "context", "", "Name of the config file context to use, instead of the current context")
 	pf.BoolVar(&r.debug, "debug", false, "Enable debug output")
 	pf.IntVar(&r.retryCount, "retry", 0, "In case of transient error, retry up to this many times. A negative value retries forever.")
 	pf.StringToStringVarP(&r.stringOptions, "option", "O", nil, "CouchDB string option, specified as key=value. May be repeated.")
@@ -147,7 +170,6 @@ func rootCmd(lg log.Logger) *root {
 
 	// Timeouts
 	// Might consider adding:
-	// - http.Transport.TLSHandshakeTimeout
 	// - http.Transport.ResponseHeaderTimeout
 	// - http.Transport.ExpectContinueTimeout (not sure this is relevant, as I'm not sure CouchDB ever uses a 100)
 	// - Read timeout (would have to be an HTTP transport that wraps the Response.Body reader with a context-aware reader that extends the timeout every time more data is read)
@@ -155,6 +177,23 @@ func rootCmd(lg log.Logger) *root {
 	pf.StringVar(&r.retryDelay, "retry-delay", "", "Delay between retry attempts. Disables the default exponential backoff algorithm.")
 	pf.StringVar(&r.connectTimeout, "connect-timeout", "", "Limits the time spent establishing a TCP connection.")
 	pf.StringVar(&r.retryTimeout, "retry-timeout", "", "When used with --retry, no more retries will be attempted after this timeout.")
+	pf.StringVar(&r.tlsHandshakeTimeout, "tls-handshake-timeout", "", "Limits the time spent on the TLS handshake.")
+
+	// TLS
+	pf.StringVar(&r.caFile, "ca-file", "", "PEM file of CA certificates used to verify the server")
+	pf.StringVar(&r.certFile, "cert-file", "", "PEM file of the client certificate, for use with --key-file")
+	pf.StringVar(&r.keyFile, "key-file", "", "PEM file of the client certificate key, for use with --cert-file")
+	pf.BoolVar(&r.insecureSkipVerify, "insecure-skip-verify", false, "Do not verify the server certificate")
+	pf.StringVar(&r.serverName, "server-name", "", "Server name used to verify the server certificate")
+
+	// HTTP
+	pf.StringVar(&r.proxy, "proxy", "", "HTTP proxy URL. By default, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are read from the environment.")
+	pf.StringVar(&r.userAgent, "user-agent", "", "User-Agent header to send, in place of the default")
+	// --header is taken by the response header dump, so custom request
+	// headers use --request-header.
+	pf.StringArrayVar(&r.requestHeaders, "request-header", nil, "Header to send with each request, given as 'Name: value'. May be repeated.")
+	pf.StringVar(&r.unixSocket, "unix-socket", "", "Connect through this Unix domain socket, instead of the network")
+	pf.StringArrayVar(&r.resolve, "resolve", nil, "Connect to addr in place of host and port, given as host:port:addr. May be repeated.")
 
 	r.cmd.AddCommand(getCmd(r))
 	r.cmd.AddCommand(pingCmd(r))
@@ -167,9 +206,22 @@ func rootCmd(lg log.Logger) *root {
 	r.cmd.AddCommand(postFlushCmd(r))
 	r.cmd.AddCommand(postCompactCmd(r))
 	r.cmd.AddCommand(postCompactViewsCmd(r))
+	r.cmd.AddCommand(autocompactCmd(r))
+	r.cmd.AddCommand(warmCmd(r))
+	r.cmd.AddCommand(migrateCmd(r))
 	r.cmd.AddCommand(postPurgeRootCmd(r))
 	r.cmd.AddCommand(copyCmd(r))
 	r.cmd.AddCommand(replicateCmd(r))
+	r.cmd.AddCommand(findCmd(r))
+	r.cmd.AddCommand(queryCmd(r))
+	r.cmd.AddCommand(resolveCmd(r))
+	r.cmd.AddCommand(clusterCmd(r))
+	r.cmd.AddCommand(waitCmd(r))
+	r.cmd.AddCommand(pushCmd(r))
+	r.cmd.AddCommand(pullCmd(r))
+	r.cmd.AddCommand(loadCmd(r))
+	r.cmd.AddCommand(configCmd(r))
+	r.cmd.AddCommand(loginCmd(r))
 
 	return r
 }
@@ -218,10 +270,27 @@ func (r *root) init(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	r.parsedTLSHandshakeTimeout, err = parseDuration(r.tlsHandshakeTimeout)
+	if err != nil {
+		return err
+	}
+	if r.parsedHeaders, err = parseHeaders(r.requestHeaders); err != nil {
+		return err
+	}
+	for _, resolve := range r.resolve {
+		if _, _, _, err := config.ParseResolve(resolve); err != nil {
+			return err
+		}
+	}
 
 	if err := r.conf.Read(r.resolveHome(r.confFile), r.log); err != nil {
 		return err
 	}
+	if r.useContext != "" {
+		if err := r.conf.UseContext(r.useContext); err != nil {
+			return err
+		}
+	}
 
 	if r.options == nil {
 		r.options = map[string]interface{}{}
@@ -237,6 +306,9 @@ func (r *root) init(cmd *cobra.Command, args []string) error {
 			}
 		}
 	}
+	if cx, err := r.conf.CurrentCx(); err == nil {
+		r.contextFlags(cx)
+	}
 	for k, v := range r.stringOptions {
 		if _, ok := r.options[k]; !ok {
 			r.options[k] = v
@@ -264,6 +336,68 @@ func (r *root) init(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// contextFlags applies the connection flags given on the command line to cx,
+// overriding the values from the config file.
+func (r *root) contextFlags(cx *config.Context) {
+	if r.caFile != "" {
+		cx.CAFile = r.caFile
+	}
+	if r.certFile != "" {
+		cx.CertFile = r.certFile
+	}
+	if r.keyFile != "" {
+		cx.KeyFile = r.keyFile
+	}
+	if r.insecureSkipVerify {
+		cx.InsecureSkipVerify = true
+	}
+	if r.serverName != "" {
+		cx.ServerName = r.serverName
+	}
+	if r.parsedTLSHandshakeTimeout > 0 {
+		cx.TLSHandshakeTimeout = r.parsedTLSHandshakeTimeout
+	}
+	if r.proxy != "" {
+		cx.Proxy = r.proxy
+	}
+	if r.userAgent != "" {
+		cx.UserAgent = r.userAgent
+	}
+	if len(r.parsedHeaders) > 0 {
+		headers := make(map[string]string, len(cx.Headers)+len(r.parsedHeaders))
+		for name, value := range cx.Headers {
+			headers[name] = value
+		}
+		for name, value := range r.parsedHeaders {
+			headers[name] = value
+		}
+		cx.Headers = headers
+	}
+	if r.unixSocket != "" {
+		cx.UnixSocket = r.unixSocket
+	}
+	if len(r.resolve) > 0 {
+		// Later entries take precedence, so the flags follow the context.
+		cx.Resolve = append(append([]string{}, cx.Resolve...), r.resolve...)
+	}
+}
+
+// parseHeaders parses headers given as "Name: value".
+func parseHeaders(headers []string) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]string, len(headers))
+	for _, header := range headers {
+		name, value, err := config.ParseHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = value
+	}
+	return result, nil
+}
+
 func (r *root) client() (*kivik.Client, error) {
 	cx, err := r.conf.CurrentCx()
 	if err != nil {
@@ -272,6 +406,16 @@ func (r *root) client() (*kivik.Client, error) {
 	return cx.KivikClient(r.parsedConnectTimeout, r.parsedRequestTimeout)
 }
 
+// couch returns a low-level CouchDB client, for endpoints not supported by
+// Kivik.
+func (r *root) couch() (*chttp.Client, error) {
+	cx, err := r.conf.CurrentCx()
+	if err != nil {
+		return nil, err
+	}
+	return cx.CouchClient(r.parsedConnectTimeout, r.parsedRequestTimeout)
+}
+
 func (r *root) RunE(cmd *cobra.Command, args []string) error {
 	if _, err := r.client(); err != nil {
 		return err
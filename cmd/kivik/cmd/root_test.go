@@ -17,7 +17,9 @@ import (
 	"compress/gzip"
 	"context"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os/user"
 	"path/filepath"
 	"regexp"
@@ -50,6 +52,28 @@ func gunzip(next testy.RequestValidator) testy.RequestValidator {
 	}
 }
 
+// expectRequest checks that the method and URL of a request match want,
+// given as "METHOD /path?query".
+func expectRequest(want string) testy.RequestValidator {
+	return func(t *testing.T, r *http.Request) {
+		t.Helper()
+		if got := r.Method + " " + r.URL.String(); got != want {
+			t.Errorf("Unexpected request: %s", got)
+		}
+	}
+}
+
+// jsonResponse returns a JSON response with the given status and body.
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+		},
+		Body: io.NopCloser(strings.NewReader(body)),
+	}
+}
+
 func Test_root_RunE(t *testing.T) {
 	tests := testy.NewTable()
 	tests.Add("unknown flag", cmdTest{
@@ -107,6 +131,55 @@ func Test_root_RunE(t *testing.T) {
 		args:   []string{"--connect-timeout", "oink", "ping", "http://localhost:5984"},
 		status: errors.ErrUsage,
 	})
+	tests.Add("request headers", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, &http.Response{}, func(t *testing.T, req *http.Request) {
+			if got := req.Header.Get("X-Api-Key"); got != "abc123" {
+				t.Errorf("Unexpected X-Api-Key header: %q", got)
+			}
+			if got := req.Header.Get("User-Agent"); got != "backup/1.0" {
+				t.Errorf("Unexpected User-Agent header: %q", got)
+			}
+		})
+
+		return cmdTest{
+			args: []string{"--request-header", "X-Api-Key: abc123", "--user-agent", "backup/1.0", "ping", s.URL},
+		}
+	})
+	tests.Add("invalid request header", cmdTest{
+		args:   []string{"--request-header", "X-Api-Key", "ping", "http://localhost:5984"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid proxy", cmdTest{
+		args:   []string{"--proxy", "proxy:3128", "ping", "http://localhost:5984"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("unix socket", func(t *testing.T) interface{} {
+		path := filepath.Join(t.TempDir(), "couchdb.sock")
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		s.Listener = l
+		s.Start()
+		t.Cleanup(s.Close)
+
+		return cmdTest{
+			args: []string{"--unix-socket", path, "ping", "http://couchdb.invalid/"},
+		}
+	})
+	tests.Add("resolve", func(t *testing.T) interface{} {
+		s := testy.ServeResponse(&http.Response{})
+		_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+
+		return cmdTest{
+			args: []string{"--resolve", "couchdb.invalid:" + port + ":127.0.0.1", "ping", "http://couchdb.invalid:" + port + "/"},
+		}
+	})
+	tests.Add("invalid resolve", cmdTest{
+		args:   []string{"--resolve", "couchdb.invalid:127.0.0.1", "ping", "http://localhost:5984"},
+		status: errors.ErrUsage,
+	})
 	tests.Add("retry max time", cmdTest{
 		args:   []string{"--retry", "100", "--retry-delay", "40ms", "--retry-timeout", "100ms", "ping", "http://localhost:5984"},
 		status: errors.ErrUnavailable,
@@ -246,6 +319,14 @@ var standardReplacements = []testy.Replacement{
 		Regexp:      regexp.MustCompile(`http://127\.0\.0\.1:\d+/`),
 		Replacement: "http://127.0.0.1:XXX/",
 	},
+	{
+		Regexp:      regexp.MustCompile(`https://127\.0\.0\.1:\d+`),
+		Replacement: "https://127.0.0.1:XXX",
+	},
+	{
+		Regexp:      regexp.MustCompile(`@127\.0\.0\.1:\d+`),
+		Replacement: "@127.0.0.1:XXX",
+	},
 	{
 		Regexp:      regexp.MustCompile(`Date: .*`),
 		Replacement: `Date: XXX`,
@@ -265,6 +346,7 @@ func (tt *cmdTest) Test(t *testing.T, re ...testy.Replacement) {
 	lg := log.New()
 	root := rootCmd(lg)
 	root.resolveHome = func(i string) string { return i }
+	root.now = func() time.Time { return time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC) }
 
 	root.cmd.SetArgs(tt.args)
 	var status int
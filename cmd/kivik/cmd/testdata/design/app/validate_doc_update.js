@@ -0,0 +1,5 @@
+function(newDoc, oldDoc, userCtx) {
+  if (!newDoc.name) {
+    throw({forbidden: "name required"});
+  }
+}
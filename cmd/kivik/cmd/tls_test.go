@@ -0,0 +1,90 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// tlsServer starts a TLS server, and returns it with the path to a PEM file
+// holding its CA certificate.
+func tlsServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprint(w, `{}`)
+	}))
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+func Test_tls(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("unknown CA", func(t *testing.T) interface{} {
+		s, _ := tlsServer(t)
+
+		return cmdTest{
+			args:   []string{"ping", s.URL},
+			status: errors.ErrUnavailable,
+		}
+	})
+	tests.Add("--ca-file", func(t *testing.T) interface{} {
+		s, caFile := tlsServer(t)
+
+		return cmdTest{
+			args: []string{"ping", "--ca-file", caFile, s.URL},
+		}
+	})
+	tests.Add("--insecure-skip-verify", func(t *testing.T) interface{} {
+		s, _ := tlsServer(t)
+
+		return cmdTest{
+			args: []string{"ping", "--insecure-skip-verify", s.URL},
+		}
+	})
+	tests.Add("ca-file from context", func(t *testing.T) interface{} {
+		s, caFile := tlsServer(t)
+		path := filepath.Join(t.TempDir(), "config")
+		config := fmt.Sprintf("apiVersion: kivik/v1\ncontexts:\n- name: tls\n  context:\n    dsn: %s\n    ca-file: %s\ncurrent-context: tls\n", s.URL, caFile)
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		return cmdTest{
+			args: []string{"--config", path, "ping"},
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
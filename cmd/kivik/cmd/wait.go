@@ -0,0 +1,29 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func waitCmd(r *root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wait [command]",
+		Short: "Wait for a condition",
+		Long:  `Block until a condition is met, for use in scripts`,
+	}
+
+	cmd.AddCommand(waitTaskCmd(r))
+
+	return cmd
+}
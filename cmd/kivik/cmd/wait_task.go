@@ -0,0 +1,98 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+type waitTask struct {
+	*root
+	taskType     string
+	db           string
+	ddoc         string
+	pollInterval string
+	timeout      string
+}
+
+func waitTaskCmd(r *root) *cobra.Command {
+	c := &waitTask{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:     "task [dsn]/[database]",
+		Aliases: []string{"tasks"},
+		Short:   "Wait for running tasks to complete",
+		Long: `Poll /_active_tasks until no task matches the given type, database and design document.
+
+The database may be given with --db, or in the DSN. Tasks on the shards of a clustered database are matched by database name. If no matching task is running, the command returns immediately.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.taskType, "type", "", "Task type to wait for, such as indexer, database_compaction, view_compaction or replication")
+	pf.StringVar(&c.db, "db", "", "Wait only for tasks on this database")
+	pf.StringVar(&c.ddoc, "ddoc", "", "Wait only for tasks on this design document")
+	pf.StringVar(&c.pollInterval, "poll-interval", "1s", "Interval between checks of /_active_tasks")
+	pf.StringVar(&c.timeout, "timeout", "", "Maximum time to wait. By default, waits indefinitely.")
+
+	return cmd
+}
+
+func (c *waitTask) RunE(cmd *cobra.Command, _ []string) error {
+	if _, err := c.client(); err != nil {
+		return err
+	}
+	if c.db == "" && c.conf.HasDB() {
+		db, err := c.conf.DB()
+		if err != nil {
+			return err
+		}
+		c.db = db
+	}
+	c.conf.Finalize()
+	if c.ddoc != "" && c.db == "" {
+		return errors.Code(errors.ErrUsage, "--ddoc requires a database")
+	}
+	interval, err := parseDuration(c.pollInterval)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.Code(errors.ErrUsage, "poll interval must be positive")
+	}
+	timeout, err := parseDuration(c.timeout)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	filter := taskFilter{typ: c.taskType, db: c.db, ddoc: c.ddoc}
+	c.log.Debugf("[wait] Will wait for %s", filter)
+	if err := c.waitTasks(ctx, filter, interval); err != nil {
+		if ctx.Err() == context.DeadlineExceeded && cmd.Context().Err() == nil {
+			return errors.Codef(errors.ErrUnavailable, "timed out waiting for %s", filter)
+		}
+		return err
+	}
+	return c.fmt.OK()
+}
@@ -0,0 +1,126 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+const indexingOrders = `[{"node":"node1@127.0.0.1","type":"indexer","database":"shards/00000000-7fffffff/orders.1609459200","design_document":"_design/app","progress":42,"started_on":1609502280}]`
+
+func Test_wait_task_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("ddoc without db", cmdTest{
+		args:   []string{"wait", "task", "http://example.com/", "--ddoc", "app"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid poll interval", cmdTest{
+		args:   []string{"wait", "task", "http://example.com/", "--poll-interval", "0"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("no tasks", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, `[]`), expectRequest("GET /_active_tasks"))
+
+		return cmdTest{
+			args: []string{"wait", "task", s.URL, "--type", "indexer"},
+		}
+	})
+	tests.Add("other database", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, indexingOrders), expectRequest("GET /_active_tasks"))
+
+		return cmdTest{
+			args: []string{"wait", "task", s.URL, "--type", "indexer", "--db", "logs"},
+		}
+	})
+	tests.Add("other type", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusOK, indexingOrders), expectRequest("GET /_active_tasks"))
+
+		return cmdTest{
+			args: []string{"wait", "task", s.URL + "/orders", "--type", "view_compaction"},
+		}
+	})
+	tests.Add("wait", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		var polls int
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Method+" "+r.URL.Path != "GET /_active_tasks" {
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+			}
+			polls++
+			w.Header().Set("Content-Type", "application/json")
+			// The task finishes after two polls.
+			if polls <= 2 {
+				_, _ = io.WriteString(w, indexingOrders)
+				return
+			}
+			_, _ = io.WriteString(w, `[]`)
+		}))
+
+		return cmdTest{
+			args: []string{"wait", "task", s.URL, "--type", "indexer", "--db", "orders", "--ddoc", "app", "--poll-interval", "1ms"},
+		}
+	})
+	tests.Add("db from dsn", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		var polls int
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Method+" "+r.URL.Path != "GET /_active_tasks" {
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+			}
+			polls++
+			w.Header().Set("Content-Type", "application/json")
+			// The task finishes after one poll.
+			if polls <= 1 {
+				_, _ = io.WriteString(w, indexingOrders)
+				return
+			}
+			_, _ = io.WriteString(w, `[]`)
+		}))
+
+		return cmdTest{
+			args: []string{"wait", "task", s.URL + "/orders", "--type", "indexer", "--poll-interval", "1ms"},
+		}
+	})
+	tests.Add("timeout", func(t *testing.T) interface{} {
+		// The task never finishes.
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method+" "+r.URL.Path != "GET /_active_tasks" {
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, indexingOrders)
+		}))
+
+		return cmdTest{
+			args:   []string{"wait", "task", s.URL, "--db", "orders", "--poll-interval", "1ms", "--timeout", "20ms"},
+			status: errors.ErrUnavailable,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,204 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/output"
+)
+
+type warm struct {
+	*root
+	pollInterval string
+	timeout      string
+}
+
+func warmCmd(r *root) *cobra.Command {
+	c := &warm{
+		root: r,
+	}
+	cmd := &cobra.Command{
+		Use:   "warm [dsn]/[database]/[_design/name]",
+		Short: "Build view indexes",
+		Long: `Trigger the build of the view index of a design document, by querying one of its views with limit=0, and wait until all views are current.
+
+If no design document is given, the views of every design document in the database are warmed. While the views are queried, the progress of the indexer is tracked through /_active_tasks, and logged with --debug. The command exits once every query has completed, and no indexer task remains for the design documents.
+
+Each query is subject to --request-timeout, and repeated according to --retry, so that a slow index build may be waited for with, for example, --request-timeout 1m --retry 30.`,
+		RunE: c.RunE,
+	}
+
+	pf := cmd.PersistentFlags()
+	pf.StringVar(&c.pollInterval, "poll-interval", "1s", "Interval between checks of /_active_tasks")
+	pf.StringVar(&c.timeout, "timeout", "", "Maximum time to wait. By default, waits indefinitely.")
+
+	return cmd
+}
+
+// warmView is a single view to be warmed.
+type warmView struct {
+	DesignDoc string `json:"design_doc"`
+	View      string `json:"view"`
+}
+
+func (c *warm) RunE(cmd *cobra.Command, _ []string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	db, ddoc, err := c.conf.DBDoc()
+	if err != nil {
+		return err
+	}
+	if db == "" {
+		return errors.Code(errors.ErrUsage, "database required")
+	}
+	ddoc = strings.TrimPrefix(ddoc, "_design/")
+	interval, err := parseDuration(c.pollInterval)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.Code(errors.ErrUsage, "poll interval must be positive")
+	}
+	timeout, err := parseDuration(c.timeout)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	views, err := c.views(ctx, client.DB(db), ddoc)
+	if err != nil {
+		return err
+	}
+
+	filter := taskFilter{typ: "indexer", db: db, ddoc: ddoc}
+	c.log.Debugf("[warm] Will warm %d views: %s/%s", len(views), client.DSN(), db)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.query(ctx, client.DB(db), views)
+	}()
+	if err := c.track(ctx, filter, interval, errc); err != nil {
+		if ctx.Err() == context.DeadlineExceeded && cmd.Context().Err() == nil {
+			return errors.Codef(errors.ErrUnavailable, "timed out waiting for %s", filter)
+		}
+		return err
+	}
+
+	rows := make([][]string, 0, len(views))
+	for _, view := range views {
+		rows = append(rows, []string{view.DesignDoc, view.View, "current"})
+	}
+	return c.fmt.Output(output.TableReader([]string{"DESIGN DOC", "VIEW", "STATUS"}, rows, output.JSONReader(views)))
+}
+
+// views returns the views of ddoc, or of every design document in the
+// database if ddoc is empty.
+func (c *warm) views(ctx context.Context, db *kivik.DB, ddoc string) ([]warmView, error) {
+	ddocs := []string{ddoc}
+	if ddoc == "" {
+		err := c.retry(func() error {
+			var err error
+			ddocs, err = designDocs(ctx, db)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	views := []warmView{}
+	for _, ddoc := range ddocs {
+		var doc struct {
+			Views map[string]interface{} `json:"views"`
+		}
+		err := c.retry(func() error {
+			return db.Get(ctx, "_design/"+ddoc).ScanDoc(&doc)
+		})
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(doc.Views))
+		for name := range doc.Views {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			views = append(views, warmView{DesignDoc: ddoc, View: name})
+		}
+	}
+	return views, nil
+}
+
+// query queries the first view of each design document with limit=0, which
+// returns once the design document's index is current. As the views of a
+// design document share an index, the other views are then current too.
+func (c *warm) query(ctx context.Context, db *kivik.DB, views []warmView) error {
+	queried := map[string]bool{}
+	for _, view := range views {
+		if queried[view.DesignDoc] {
+			continue
+		}
+		queried[view.DesignDoc] = true
+		c.log.Debugf("[warm] Querying view: %s/_design/%s/_view/%s", db.Name(), view.DesignDoc, view.View)
+		err := c.retry(func() error {
+			rs := db.Query(ctx, "_design/"+view.DesignDoc, view.View, kivik.Param("limit", 0))
+			defer rs.Close() // nolint:errcheck
+			// With limit=0, no rows are returned.
+			_ = rs.Next()
+			return rs.Err()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// track polls /_active_tasks every interval, logging the progress of the
+// tasks matching filter, until the queries have completed, as reported on
+// errc, and no matching task remains.
+func (c *warm) track(ctx context.Context, filter taskFilter, interval time.Duration, errc <-chan error) error {
+	queried := false
+	return c.pollTasks(ctx, filter, interval, func(tasks []activeTask) (bool, error) {
+		for _, task := range tasks {
+			if task.Progress != nil {
+				c.log.Debugf("[warm] Indexing %s on %s: %d%% complete", task.DesignDocument, task.Database, *task.Progress)
+			}
+		}
+		if !queried {
+			select {
+			case err := <-errc:
+				if err != nil {
+					return false, err
+				}
+				queried = true
+			default:
+			}
+		}
+		return queried && len(tasks) == 0, nil
+	})
+}
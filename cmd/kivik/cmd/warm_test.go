@@ -0,0 +1,189 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+const (
+	ordersDesignDocs = `{"total_rows":2,"offset":0,"rows":[{"id":"_design/app","key":"_design/app","value":{"rev":"1-abc"}},{"id":"_design/reports","key":"_design/reports","value":{"rev":"1-abc"}}]}`
+	appDesignDoc     = `{"_id":"_design/app","_rev":"1-abc","views":{"by_name":{"map":"function(doc){}"},"by_date":{"map":"function(doc){}"}}}`
+	reportsDesignDoc = `{"_id":"_design/reports","_rev":"1-abc","views":{"totals":{"map":"function(doc){}","reduce":"_sum"}}}`
+	emptyView        = `{"total_rows":0,"offset":0,"rows":[]}`
+)
+
+func Test_warm_RunE(t *testing.T) {
+	tests := testy.NewTable()
+
+	tests.Add("missing database", cmdTest{
+		args:   []string{"warm", "http://example.com/"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("invalid poll interval", cmdTest{
+		args:   []string{"warm", "http://example.com/orders", "--poll-interval", "0"},
+		status: errors.ErrUsage,
+	})
+	tests.Add("design doc", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		polls := 0
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "GET /orders/_design/app":
+				_, _ = io.WriteString(w, appDesignDoc)
+			case "GET /orders/_design/app/_view/by_date?limit=0":
+				_, _ = io.WriteString(w, emptyView)
+			case "GET /_active_tasks":
+				mu.Lock()
+				defer mu.Unlock()
+				polls++
+				if polls > 2 {
+					_, _ = io.WriteString(w, "[]")
+					return
+				}
+				_, _ = io.WriteString(w, indexingOrders)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"warm", s.URL + "/orders/_design/app", "--poll-interval", "1ms"},
+		}
+	})
+	tests.Add("all design docs", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "GET /orders/_design_docs":
+				_, _ = io.WriteString(w, ordersDesignDocs)
+			case "GET /orders/_design/app":
+				_, _ = io.WriteString(w, appDesignDoc)
+			case "GET /orders/_design/reports":
+				_, _ = io.WriteString(w, reportsDesignDoc)
+			case "GET /orders/_design/app/_view/by_date?limit=0", "GET /orders/_design/reports/_view/totals?limit=0":
+				_, _ = io.WriteString(w, emptyView)
+			case "GET /_active_tasks":
+				_, _ = io.WriteString(w, "[]")
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"warm", s.URL + "/orders", "--poll-interval", "1ms"},
+		}
+	})
+	tests.Add("json", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "GET /orders/_design/reports":
+				_, _ = io.WriteString(w, reportsDesignDoc)
+			case "GET /orders/_design/reports/_view/totals?limit=0":
+				_, _ = io.WriteString(w, emptyView)
+			case "GET /_active_tasks":
+				_, _ = io.WriteString(w, "[]")
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"warm", s.URL + "/orders/_design/reports", "--poll-interval", "1ms", "-f", "json"},
+		}
+	})
+	tests.Add("design doc not found", func(t *testing.T) interface{} {
+		s := testy.ServeResponseValidator(t, jsonResponse(http.StatusNotFound, `{"error":"not_found","reason":"missing"}`), expectRequest("GET /orders/_design/missing"))
+
+		return cmdTest{
+			args:   []string{"warm", s.URL + "/orders/_design/missing", "--poll-interval", "1ms"},
+			status: errors.ErrNotFound,
+		}
+	})
+	tests.Add("retry after request timeout", func(t *testing.T) interface{} {
+		var mu sync.Mutex
+		queries, polls := 0, 0
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "GET /orders/_design/reports":
+				_, _ = io.WriteString(w, reportsDesignDoc)
+			case "GET /orders/_design/reports/_view/totals?limit=0":
+				mu.Lock()
+				queries++
+				first := queries == 1
+				mu.Unlock()
+				// The first query outlasts the request timeout.
+				if first {
+					time.Sleep(500 * time.Millisecond)
+				}
+				_, _ = io.WriteString(w, emptyView)
+			case "GET /_active_tasks":
+				mu.Lock()
+				defer mu.Unlock()
+				polls++
+				if polls > 1 {
+					_, _ = io.WriteString(w, "[]")
+					return
+				}
+				_, _ = io.WriteString(w, indexingOrders)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args: []string{"warm", s.URL + "/orders/_design/reports", "--poll-interval", "50ms", "--request-timeout", "100ms", "--retry", "1", "--retry-delay", "0"},
+		}
+	})
+	tests.Add("timeout", func(t *testing.T) interface{} {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.Method + " " + r.URL.String() {
+			case "GET /orders/_design/app":
+				_, _ = io.WriteString(w, appDesignDoc)
+			case "GET /orders/_design/app/_view/by_date?limit=0":
+				_, _ = io.WriteString(w, emptyView)
+			case "GET /_active_tasks":
+				_, _ = io.WriteString(w, indexingOrders)
+			default:
+				t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		return cmdTest{
+			args:   []string{"warm", s.URL + "/orders/_design/app", "--poll-interval", "1ms", "--timeout", "50ms"},
+			status: errors.ErrUnavailable,
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt cmdTest) {
+		tt.Test(t)
+	})
+}
@@ -0,0 +1,77 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// watcher implements the --watch flag, for commands whose output may be
+// refreshed periodically.
+type watcher struct {
+	watch    bool
+	interval string
+	count    int
+}
+
+func (w *watcher) flags(pf *pflag.FlagSet) {
+	pf.BoolVarP(&w.watch, "watch", "w", false, "Refresh the output periodically, until interrupted")
+	pf.StringVar(&w.interval, "interval", "2s", "Interval between refreshes, with --watch")
+	pf.IntVar(&w.count, "count", 0, "Number of refreshes before exiting, with --watch. 0 refreshes until interrupted.")
+}
+
+// watchOutput outputs the result of fn. With --watch, fn is called
+// repeatedly, and the output refreshed in place.
+func (r *root) watchOutput(ctx context.Context, w *watcher, fn func() (io.Reader, error)) error {
+	output := func(out func(io.Reader) error) error {
+		return r.retry(func() error {
+			result, err := fn()
+			if err != nil {
+				return err
+			}
+			return out(result)
+		})
+	}
+	if !w.watch {
+		return output(r.fmt.Output)
+	}
+	interval, err := parseDuration(w.interval)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return errors.Code(errors.ErrUsage, "interval must be positive")
+	}
+	if w.count < 0 {
+		return errors.Code(errors.ErrUsage, "count must not be negative")
+	}
+	for i := 0; w.count == 0 || i < w.count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+		if err := output(r.fmt.Refresh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
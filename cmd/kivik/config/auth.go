@@ -0,0 +1,131 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-kivik/kivik/v4"
+	"github.com/go-kivik/kivik/v4/couchdb"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// Supported authentication types.
+const (
+	AuthBasic  = "basic"
+	AuthCookie = "cookie"
+	AuthJWT    = "jwt"
+	AuthProxy  = "proxy"
+)
+
+// Auth configures how a context authenticates with the server. Without it,
+// credentials in the context are used for cookie authentication.
+type Auth struct {
+	// Type is one of basic, cookie, jwt or proxy. Basic and cookie
+	// authentication use the user and password of the context.
+	Type string `yaml:"type"`
+	// Token is a static JWT token, for jwt authentication.
+	Token string `yaml:"token"`
+	// TokenCommand is a shell command whose output is the JWT token, for jwt
+	// authentication.
+	TokenCommand string `yaml:"token-command"`
+	// Secret is the HMAC secret configured on the server, used to sign the
+	// user name for proxy authentication.
+	Secret string `yaml:"secret"`
+	// Roles are the roles sent with proxy authentication.
+	Roles []string `yaml:"roles"`
+}
+
+// authFields lists the fields permitted in the auth block of a context, by
+// authentication type.
+var authFields = map[string][]string{
+	AuthBasic:  {"type"},
+	AuthCookie: {"type"},
+	AuthJWT:    {"type", "token", "token-command"},
+	AuthProxy:  {"type", "secret", "roles"},
+}
+
+// authOption returns the kivik option to authenticate the context, or nil if
+// credentials are to be taken from the DSN.
+func (c *Context) authOption() (kivik.Option, error) {
+	if c.Auth == nil {
+		return nil, nil
+	}
+	switch c.Auth.Type {
+	case AuthBasic:
+		return couchdb.BasicAuth(c.User, c.Password), nil
+	case AuthCookie:
+		if c.User == "" {
+			// Rely on a session cookie saved by kivik login.
+			return nil, nil
+		}
+		return couchdb.CookieAuth(c.User, c.Password), nil
+	case AuthJWT:
+		token := c.Auth.Token
+		if c.Auth.TokenCommand != "" {
+			var err error
+			if token, err = commandOutput("token-command", c.Auth.TokenCommand); err != nil {
+				return nil, err
+			}
+		}
+		return couchdb.JWTAuth(token), nil
+	case AuthProxy:
+		if c.User == "" {
+			return nil, errors.Code(errors.ErrUsage, "proxy authentication requires a user")
+		}
+		return couchdb.ProxyAuth(c.User, c.Auth.Secret, c.Auth.Roles), nil
+	}
+	return nil, errors.Codef(errors.ErrUsage, "unsupported auth type: %s", c.Auth.Type)
+}
+
+// usesCookies returns true if the context authenticates with a session
+// cookie, which may have been saved by kivik login.
+func (c *Context) usesCookies() bool {
+	return c.Auth == nil || c.Auth.Type == AuthCookie
+}
+
+// clientDSN returns dsn, less any credentials when they are instead provided
+// by the auth option.
+func (c *Context) clientDSN(dsn string) string {
+	if c.Auth == nil {
+		return dsn
+	}
+	uri, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	uri.User = nil
+	return uri.String()
+}
+
+// cookieJar returns a cookie jar holding the session cookie saved for the
+// context by kivik login, if any.
+func (c *Context) cookieJar() (http.CookieJar, error) {
+	if !c.usesCookies() {
+		return nil, nil
+	}
+	cookie, err := c.loadSession()
+	if err != nil || cookie == nil {
+		return nil, err
+	}
+	uri, err := url.Parse(strings.TrimSuffix(c.ServerDSN(), "/") + "/")
+	if err != nil {
+		return nil, errors.WithCode(err, errors.ErrUsage)
+	}
+	jar := newCookieJar()
+	jar.SetCookies(uri, []*http.Cookie{cookie})
+	return jar, nil
+}
@@ -13,7 +13,6 @@
 package config
 
 import (
-	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -27,6 +26,7 @@ import (
 
 	"github.com/go-kivik/kivik/v4"
 	"github.com/go-kivik/kivik/v4/couchdb"
+	"github.com/go-kivik/kivik/v4/couchdb/chttp"
 	_ "github.com/go-kivik/kivik/v4/x/fsdb" // Filesystem driver
 
 	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
@@ -49,8 +49,47 @@ type Context struct {
 	Host     string `yaml:"host"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
-	Database string `yaml:"database"`
-	DocID    string `yaml:"-"`
+	// PasswordEnv names an environment variable holding the password.
+	PasswordEnv string `yaml:"password-env"`
+	// PasswordCommand is a shell command whose output is the password.
+	PasswordCommand string `yaml:"password-command"`
+	// PasswordFile is the path to a file holding the password, which must
+	// not be accessible by group or others.
+	PasswordFile string `yaml:"password-file"`
+	Database     string `yaml:"database"`
+	// CAFile is a PEM file of CA certificates, used instead of the system
+	// pool to verify the server.
+	CAFile string `yaml:"ca-file"`
+	// CertFile and KeyFile are the PEM encoded client certificate and key,
+	// for servers which require client certificates.
+	CertFile string `yaml:"cert-file"`
+	KeyFile  string `yaml:"key-file"`
+	// InsecureSkipVerify disables verification of the server certificate.
+	InsecureSkipVerify bool `yaml:"insecure-skip-verify"`
+	// ServerName overrides the host name used to verify the server
+	// certificate.
+	ServerName string `yaml:"server-name"`
+	// TLSHandshakeTimeout limits the time spent on the TLS handshake.
+	TLSHandshakeTimeout time.Duration `yaml:"tls-handshake-timeout"`
+	// Proxy is the URL of an HTTP proxy. When empty, the proxy is taken from
+	// the environment.
+	Proxy string `yaml:"proxy"`
+	// Headers are sent with every request.
+	Headers map[string]string `yaml:"headers"`
+	// UserAgent replaces the default User-Agent header.
+	UserAgent string `yaml:"user-agent"`
+	// UnixSocket is the path of a Unix domain socket, used in place of the
+	// network to reach the server.
+	UnixSocket string `yaml:"unix-socket"`
+	// Resolve lists addresses to dial in place of a host and port, each
+	// given as host:port:addr.
+	Resolve []string `yaml:"resolve"`
+	// Auth selects the authentication method. If nil, any credentials are
+	// used for cookie authentication.
+	Auth  *Auth  `yaml:"auth"`
+	DocID string `yaml:"-"`
+	// SessionFile is where a session cookie saved by kivik login is kept.
+	SessionFile string `yaml:"-"`
 }
 
 func (c *Context) String() string {
@@ -121,20 +160,19 @@ func (c *Context) DBDocFilename() (db, doc, filename string, err error) {
 
 // UnmarshalYAML handles parsing of a Context from YAML input.
 func (c *Context) UnmarshalYAML(v *yaml.Node) error {
-	dsn := struct {
-		DSN string `yaml:"dsn"`
+	type alias Context
+	intl := struct {
+		alias `yaml:",inline"`
+		DSN   string `yaml:"dsn"`
 	}{}
-	if err := v.Decode(&dsn); err != nil {
+	if err := v.Decode(&intl); err != nil {
 		return err
 	}
-	if dsn.DSN == "" {
-		type alias Context
-		intl := alias{}
-		err := v.Decode(&intl)
-		*c = Context(intl)
-		return err
+	*c = Context(intl.alias)
+	if intl.DSN == "" {
+		return nil
 	}
-	uri, err := url.Parse(dsn.DSN)
+	uri, err := url.Parse(intl.DSN)
 	if err != nil {
 		return err
 	}
@@ -143,13 +181,14 @@ func (c *Context) UnmarshalYAML(v *yaml.Node) error {
 		user = u.Username()
 		password, _ = u.Password()
 	}
-	*c = Context{
-		Scheme:   uri.Scheme,
-		Host:     uri.Host,
-		User:     user,
-		Password: password,
-		Database: uri.Path,
+	if password != "" && c.passwordSource() != "" {
+		return errors.Codef(errors.ErrUsage, "dsn includes a password, and cannot be combined with %s", c.passwordSource())
 	}
+	c.Scheme = uri.Scheme
+	c.Host = uri.Host
+	c.User = user
+	c.Password = password
+	c.Database = uri.Path
 	return nil
 }
 
@@ -170,6 +209,11 @@ func (c *Config) Read(filename string, lg log.Logger) error {
 	if err := c.readYAML(filename); err != nil {
 		return errors.WithCode(err, errors.ErrUsage)
 	}
+	if filename != "" {
+		for name, cx := range c.Contexts {
+			cx.SessionFile = sessionFile(filename, name)
+		}
+	}
 	if dsn := os.Getenv(envPrefix + "DSN"); dsn != "" {
 		if err := c.setDefaultDSN(dsn); err != nil {
 			return err
@@ -194,6 +238,9 @@ func (c *Config) readYAML(filename string) error {
 	}
 	if err := yaml.NewDecoder(f).Decode(c); err != nil {
 		c.log.Debugf("YAML parse error: %s", err)
+		if errors.InspectErrorCode(err) == errors.ErrUsage {
+			return errors.Codef(errors.ErrUsage, "%s: %w", filename, err)
+		}
 		return err
 	}
 	c.log.Debugf("successfully read config file %q", filename)
@@ -228,20 +275,98 @@ func (c *Context) KivikClient(connTimeout, reqTimeout time.Duration) (*kivik.Cli
 	case "file":
 		return kivik.New("fs", dsn)
 	case "http", "https", "couch", "couchs", "couchdb", "couchdbs":
-		return kivik.New("couch", dsn, couchdb.OptionHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				DialContext: (&net.Dialer{
-					Timeout: connTimeout,
-				}).DialContext,
-			},
-			Timeout: reqTimeout,
-		}))
+		client, auth, err := c.httpClient(connTimeout, reqTimeout)
+		if err != nil {
+			return nil, err
+		}
+		options := []kivik.Option{couchdb.OptionHTTPClient(client)}
+		if auth != nil {
+			options = append(options, auth)
+		}
+		return kivik.New("couch", c.clientDSN(dsn), options...)
 	}
 	return nil, errors.Codef(errors.ErrUsage, "unsupported URL scheme: %s", scheme)
 }
 
+// CouchClient returns a low-level CouchDB HTTP client, for endpoints not
+// supported by Kivik.
+func (c *Context) CouchClient(connTimeout, reqTimeout time.Duration) (*chttp.Client, error) {
+	scheme, dsn, err := c.ClientInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	switch scheme {
+	case "http", "https", "couch", "couchs", "couchdb", "couchdbs":
+		client, auth, err := c.httpClient(connTimeout, reqTimeout)
+		if err != nil {
+			return nil, err
+		}
+		if auth == nil {
+			auth = kivik.Params(nil)
+		}
+		return chttp.New(client, c.clientDSN(dsn), auth)
+	}
+	return nil, errors.Codef(errors.ErrUsage, "unsupported URL scheme: %s", scheme)
+}
+
+// httpClient returns the HTTP client for the context, and the option to
+// authenticate it, if any.
+func (c *Context) httpClient(connTimeout, reqTimeout time.Duration) (*http.Client, kivik.Option, error) {
+	client, err := c.HTTPClient(connTimeout, reqTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, err := c.authOption()
+	if err != nil {
+		return nil, nil, err
+	}
+	if client.Jar, err = c.cookieJar(); err != nil {
+		return nil, nil, err
+	}
+	return client, auth, nil
+}
+
+// HTTPClient returns a plain HTTP client for the context, without
+// authentication, for requests made outside of kivik.
+func (c *Context) HTTPClient(connTimeout, reqTimeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := c.proxy()
+	if err != nil {
+		return nil, err
+	}
+	dial, err := c.dialContext(connTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: c.transport(&http.Transport{
+			Proxy:               proxy,
+			DialContext:         dial,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: c.TLSHandshakeTimeout,
+		}),
+		Timeout: reqTimeout,
+	}, nil
+}
+
+// Credentials returns the user and password of the context, reading the
+// password from its source, if necessary.
+func (c *Context) Credentials() (user, password string, err error) {
+	if err := c.resolvePassword(); err != nil {
+		return "", "", err
+	}
+	return c.User, c.Password, nil
+}
+
 // ClientInfo returns the URL scheme, and DSN of the context.
 func (c *Context) ClientInfo() (string, string, error) {
+	if err := c.resolvePassword(); err != nil {
+		return "", "", err
+	}
 	dsn := c.ServerDSN()
 	if dsn == "" {
 		return "", "", errors.Code(errors.ErrUsage, "server hostname required")
@@ -253,6 +378,16 @@ func (c *Context) ClientInfo() (string, string, error) {
 	return scheme, dsn, nil
 }
 
+// UseContext makes the named context current, overriding the current-context
+// from the config file, and any DSN set in the environment.
+func (c *Config) UseContext(name string) error {
+	if _, ok := c.Contexts[name]; !ok || name == "*" {
+		return errors.Codef(errors.ErrUsage, "context %q not found", name)
+	}
+	c.CurrentContext = name
+	return nil
+}
+
 // ClientInfo returns the URL scheme, and DSN, for use by the root command to
 // establish the kivik client connection.
 func (c *Config) ClientInfo() (string, string, error) {
@@ -454,13 +589,12 @@ func (c *Config) SetURL(dsn string) (map[string]string, error) {
 	curCx, _ := c.CurrentCx()
 	if cx.Host == "" && curCx != nil {
 		c.log.Debugf("Incomplete DSN provided: %q, merging with current context: %q", dsn, curCx)
-		cx.Scheme = curCx.Scheme
-		cx.Host = curCx.Host
-		cx.User = curCx.User
-		cx.Password = curCx.Password
-		if cx.Database == "" {
-			cx.Database = curCx.Database
+		merged := *curCx
+		if cx.Database != "" {
+			merged.Database = cx.Database
 		}
+		merged.DocID = cx.DocID
+		cx = &merged
 	}
 	c.Contexts["*"] = cx
 	c.CurrentContext = "*"
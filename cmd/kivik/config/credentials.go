@@ -0,0 +1,135 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// Context fields which hold, or name the source of, the password. At most one
+// may be set.
+const (
+	fieldPassword        = "password"
+	fieldPasswordEnv     = "password-env"
+	fieldPasswordCommand = "password-command"
+	fieldPasswordFile    = "password-file"
+)
+
+// passwordFields lists the fields which provide the password.
+var passwordFields = []string{fieldPassword, fieldPasswordEnv, fieldPasswordCommand, fieldPasswordFile}
+
+// passwordSource returns the name of the field the password is to be read
+// from, if any.
+func (c *Context) passwordSource() string {
+	switch {
+	case c.PasswordEnv != "":
+		return fieldPasswordEnv
+	case c.PasswordCommand != "":
+		return fieldPasswordCommand
+	case c.PasswordFile != "":
+		return fieldPasswordFile
+	}
+	return ""
+}
+
+// resolvePassword reads the password from the source named by the context, if
+// any, and stores it in Password, so that the source is read only once.
+func (c *Context) resolvePassword() error {
+	var (
+		password string
+		err      error
+	)
+	switch c.passwordSource() {
+	case fieldPasswordEnv:
+		password, err = passwordFromEnv(c.PasswordEnv)
+	case fieldPasswordCommand:
+		password, err = commandOutput(fieldPasswordCommand, c.PasswordCommand)
+	case fieldPasswordFile:
+		password, err = passwordFromFile(c.PasswordFile)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.Password = password
+	c.PasswordEnv, c.PasswordCommand, c.PasswordFile = "", "", ""
+	return nil
+}
+
+func passwordFromEnv(name string) (string, error) {
+	password, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errors.Codef(errors.ErrUsage, "password-env: environment variable %s is not set", name)
+	}
+	return password, nil
+}
+
+// commandOutput runs command with the shell, and returns its output, less any
+// trailing newline. The command may prompt the user, as it shares stdin and
+// stderr with kivik. field names the config field the command was read from.
+func commandOutput(field, command string) (string, error) {
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Codef(errors.ErrUsage, "%s: %w", field, err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// passwordFromFile returns the contents of the file at path, less any trailing
+// newline. As with ssh private keys, the file must not be accessible by group
+// or others.
+func passwordFromFile(path string) (string, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", errors.Codef(errors.ErrNoInput, "password-file: %w", err)
+	}
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0o077 != 0 {
+		return "", errors.Codef(errors.ErrUsage, "password-file: %s has mode %s, but must not be accessible by group or others; run chmod 600 %[1]s", path, perm)
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return "", errors.Codef(errors.ErrNoInput, "password-file: %w", err)
+	}
+	return strings.TrimRight(string(buf), "\r\n"), nil
+}
+
+// expandHome expands a leading ~/ in path to the user's home directory.
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Code(errors.ErrNoInput, err)
+	}
+	return filepath.Join(home, path[2:]), nil
+}
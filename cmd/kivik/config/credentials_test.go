@@ -0,0 +1,92 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestContext_resolvePassword(t *testing.T) {
+	type tt struct {
+		cx   *Context
+		want string
+		err  string
+	}
+
+	tests := testy.NewTable()
+	tests.Add("plaintext", tt{
+		cx:   &Context{Password: "abc123"},
+		want: "abc123",
+	})
+	tests.Add("env", func(t *testing.T) interface{} {
+		t.Setenv("KIVIK_TEST_PASSWORD", "abc123")
+		return tt{
+			cx:   &Context{PasswordEnv: "KIVIK_TEST_PASSWORD"},
+			want: "abc123",
+		}
+	})
+	tests.Add("env not set", tt{
+		cx:  &Context{PasswordEnv: "KIVIK_TEST_UNSET_PASSWORD"},
+		err: "password-env: environment variable KIVIK_TEST_UNSET_PASSWORD is not set",
+	})
+	tests.Add("command", tt{
+		cx:   &Context{PasswordCommand: "echo abc123"},
+		want: "abc123",
+	})
+	tests.Add("command fails", tt{
+		cx:  &Context{PasswordCommand: "exit 3"},
+		err: "password-command: exit status 3",
+	})
+	tests.Add("file", func(t *testing.T) interface{} {
+		path := filepath.Join(t.TempDir(), "password")
+		if err := os.WriteFile(path, []byte("abc123\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return tt{
+			cx:   &Context{PasswordFile: path},
+			want: "abc123",
+		}
+	})
+	tests.Add("file readable by others", func(t *testing.T) interface{} {
+		path := filepath.Join(t.TempDir(), "password")
+		if err := os.WriteFile(path, []byte("abc123\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return tt{
+			cx:  &Context{PasswordFile: path},
+			err: "password-file: " + path + " has mode -rw-r--r--, but must not be accessible by group or others; run chmod 600 " + path,
+		}
+	})
+	tests.Add("file not found", tt{
+		cx:  &Context{PasswordFile: "testdata/not-found"},
+		err: "password-file: stat testdata/not-found: no such file or directory",
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		err := tt.cx.resolvePassword()
+		testy.Error(t, tt.err, err)
+		if tt.cx.Password != tt.want {
+			t.Errorf("Unexpected password: %q", tt.cx.Password)
+		}
+		if src := tt.cx.passwordSource(); src != "" {
+			t.Errorf("Password source not cleared: %s", src)
+		}
+	})
+}
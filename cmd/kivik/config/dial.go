@@ -0,0 +1,77 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// Context fields which configure dialing.
+const (
+	fieldUnixSocket = "unix-socket"
+	keyResolve      = "resolve"
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialContext returns the function used to dial the server. With a Unix
+// socket, every connection is made to the socket. Otherwise, addresses
+// matching a resolve entry are dialed at the address given instead.
+func (c *Context) dialContext(connTimeout time.Duration) (dialFunc, error) {
+	dialer := &net.Dialer{Timeout: connTimeout}
+	if c.UnixSocket != "" {
+		path, err := expandHome(c.UnixSocket)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		}, nil
+	}
+	if len(c.Resolve) == 0 {
+		return dialer.DialContext, nil
+	}
+	addrs := make(map[string]string, len(c.Resolve))
+	for _, resolve := range c.Resolve {
+		host, port, addr, err := ParseResolve(resolve)
+		if err != nil {
+			return nil, err
+		}
+		addrs[net.JoinHostPort(host, port)] = net.JoinHostPort(addr, port)
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if resolved, ok := addrs[addr]; ok {
+			addr = resolved
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}, nil
+}
+
+// ParseResolve parses a resolve entry given as "host:port:addr", as by curl,
+// meaning that connections to host and port are made to addr instead. An
+// IPv6 addr may be given in brackets.
+func ParseResolve(resolve string) (host, port, addr string, err error) {
+	host, rest, _ := strings.Cut(resolve, ":")
+	port, addr, _ = strings.Cut(rest, ":")
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 || host == "" || addr == "" {
+		return "", "", "", errors.Codef(errors.ErrUsage, "invalid resolve %q, expected host:port:addr", resolve)
+	}
+	return host, port, addr, nil
+}
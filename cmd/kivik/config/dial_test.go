@@ -0,0 +1,146 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestContext_KivikClient_dial(t *testing.T) {
+	type tt struct {
+		server *httptest.Server
+		cx     *Context
+		err    string
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+	port := func(s *httptest.Server) string {
+		_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+		return port
+	}
+
+	tests := testy.NewTable()
+	tests.Add("unix socket", func(t *testing.T) interface{} {
+		path := filepath.Join(t.TempDir(), "couchdb.sock")
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := httptest.NewUnstartedServer(handler)
+		s.Listener = l
+		s.Start()
+		return tt{
+			server: s,
+			cx:     &Context{Scheme: "http", Host: "couchdb.invalid", UnixSocket: path},
+		}
+	})
+	tests.Add("missing unix socket", func(t *testing.T) interface{} {
+		return tt{
+			server: httptest.NewServer(handler),
+			cx:     &Context{Scheme: "http", Host: "couchdb.invalid", UnixSocket: filepath.Join(t.TempDir(), "couchdb.sock")},
+			err:    "connect: no such file or directory",
+		}
+	})
+	tests.Add("resolve", func(t *testing.T) interface{} {
+		s := httptest.NewServer(handler)
+		return tt{
+			server: s,
+			cx: &Context{
+				Scheme:  "http",
+				Host:    "couchdb.invalid:" + port(s),
+				Resolve: []string{"other.invalid:" + port(s) + ":192.0.2.1", "couchdb.invalid:" + port(s) + ":127.0.0.1"},
+			},
+		}
+	})
+	tests.Add("resolve with TLS", func(t *testing.T) interface{} {
+		s := newTLSServer(handler)
+		return tt{
+			server: s,
+			cx: &Context{
+				Scheme:  "https",
+				Host:    "example.com:" + port(s),
+				CAFile:  writePEM(t, "CERTIFICATE", s.Certificate().Raw),
+				Resolve: []string{"example.com:" + port(s) + ":127.0.0.1"},
+			},
+		}
+	})
+	tests.Add("invalid resolve", tt{
+		server: httptest.NewServer(handler),
+		cx:     &Context{Scheme: "http", Host: "couchdb.invalid", Resolve: []string{"couchdb.invalid:127.0.0.1"}},
+		err:    `invalid resolve "couchdb.invalid:127.0.0.1", expected host:port:addr`,
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		t.Cleanup(tt.server.Close)
+		client, err := tt.cx.KivikClient(0, 0)
+		if err == nil {
+			_, err = client.Ping(context.Background())
+		}
+		if tt.err == "" {
+			testy.Error(t, "", err)
+			return
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Unexpected error: %v, expected %q", err, tt.err)
+		}
+	})
+}
+
+func TestParseResolve(t *testing.T) {
+	type tt struct {
+		resolve          string
+		host, port, addr string
+		err              string
+	}
+
+	tests := testy.NewTable()
+	tests.Add("ipv4", tt{
+		resolve: "couchdb.example.com:6984:10.0.0.5",
+		host:    "couchdb.example.com",
+		port:    "6984",
+		addr:    "10.0.0.5",
+	})
+	tests.Add("ipv6", tt{
+		resolve: "couchdb.example.com:6984:[fd00::5]",
+		host:    "couchdb.example.com",
+		port:    "6984",
+		addr:    "fd00::5",
+	})
+	tests.Add("missing addr", tt{
+		resolve: "couchdb.example.com:6984",
+		err:     `invalid resolve "couchdb.example.com:6984", expected host:port:addr`,
+	})
+	tests.Add("invalid port", tt{
+		resolve: "couchdb.example.com:https:10.0.0.5",
+		err:     `invalid resolve "couchdb.example.com:https:10.0.0.5", expected host:port:addr`,
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		host, port, addr, err := ParseResolve(tt.resolve)
+		testy.Error(t, tt.err, err)
+		if host != tt.host || port != tt.port || addr != tt.addr {
+			t.Errorf("Unexpected result: %q, %q, %q", host, port, addr)
+		}
+	})
+}
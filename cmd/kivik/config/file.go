@@ -0,0 +1,649 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// contextFields lists the fields of a context, in the order they are written.
+var contextFields = []string{
+	"scheme", "host", "user", fieldPassword, fieldPasswordEnv, fieldPasswordCommand, fieldPasswordFile, "database",
+	fieldCAFile, fieldCertFile, fieldKeyFile, fieldInsecureSkipVerify, fieldServerName, fieldTLSHandshakeTimeout,
+	fieldProxy, fieldUserAgent, fieldUnixSocket,
+}
+
+// redacted replaces passwords in redacted output.
+const redacted = "*****"
+
+// File is a config file, held as a tree of YAML nodes, so that it may be
+// edited and saved without losing comments or formatting.
+type File struct {
+	path string
+	doc  *yaml.Node
+}
+
+// OpenFile reads the config file at path. A missing file is treated as empty,
+// and is created by Save.
+func OpenFile(path string) (*File, error) {
+	f := &File{
+		path: path,
+		doc:  &yaml.Node{Kind: yaml.DocumentNode},
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Code(errors.ErrNoInput, err)
+	}
+	if err := yaml.Unmarshal(buf, f.doc); err != nil {
+		return nil, errors.WithCode(err, errors.ErrUsage)
+	}
+	if len(f.doc.Content) == 0 {
+		f.doc.Kind = yaml.DocumentNode
+		f.doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	if f.root().Kind != yaml.MappingNode {
+		return nil, errors.Codef(errors.ErrUsage, "%s: config must be a YAML mapping", path)
+	}
+	if _, err := f.entries(); err != nil {
+		return nil, errors.Codef(errors.ErrUsage, "%s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f *File) root() *yaml.Node {
+	return f.doc.Content[0]
+}
+
+// Config returns the decoded configuration.
+func (f *File) Config() (*Config, error) {
+	c := New(nil)
+	if err := f.doc.Decode(c); err != nil {
+		return nil, errors.WithCode(err, errors.ErrUsage)
+	}
+	return c, nil
+}
+
+// lookup returns the index of key in the mapping node m, and its value, or -1
+// and nil if it is not found.
+func lookup(m *yaml.Node, key string) (int, *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i, m.Content[i+1]
+		}
+	}
+	return -1, nil
+}
+
+// set sets key in the mapping node m to value, appending it if necessary.
+func set(m *yaml.Node, key string, value *yaml.Node) {
+	if i, _ := lookup(m, key); i >= 0 {
+		// Keep any comments attached to the old value.
+		old := m.Content[i+1]
+		value.LineComment = old.LineComment
+		m.Content[i+1] = value
+		return
+	}
+	m.Content = append(m.Content, scalar(key), value)
+}
+
+// unset removes key from the mapping node m, if present.
+func unset(m *yaml.Node, key string) bool {
+	i, _ := lookup(m, key)
+	if i < 0 {
+		return false
+	}
+	m.Content = append(m.Content[:i], m.Content[i+2:]...)
+	return true
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// form returns the schema form of the file.
+func (f *File) form() form {
+	fm, _ := detectForm(f.root())
+	return fm
+}
+
+// entries returns the contexts in the file, in the order they appear.
+func (f *File) entries() ([]entry, error) {
+	fm, err := detectForm(f.root())
+	if err != nil {
+		return nil, err
+	}
+	return entries(f.root(), fm)
+}
+
+// entry returns the named context, or false if it does not exist.
+func (f *File) entry(name string) (entry, bool) {
+	cxs, _ := f.entries()
+	for _, e := range cxs {
+		if e.name.Value == name {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// editable returns an error if the file is in a form that cannot be edited
+// in place.
+func (f *File) editable() error {
+	if f.form() == formLegacyList {
+		return errors.Codef(errors.ErrUsage, "%s: config uses the legacy list format; run 'kivik config migrate' to upgrade it", f.path)
+	}
+	return nil
+}
+
+// addContext appends a new, empty context, and returns its fields node. An
+// empty file is given the current schema.
+func (f *File) addContext(name string) *yaml.Node {
+	fields := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	root := f.root()
+	if f.form() == formLegacyMap {
+		_, cxs := lookup(root, keyContexts)
+		cxs.Content = append(cxs.Content, scalar(name), fields)
+		return fields
+	}
+	if f.form() == formEmpty {
+		setAPIVersion(root)
+	}
+	_, cxs := lookup(root, keyContexts)
+	if cxs == nil || cxs.Kind != yaml.SequenceNode {
+		cxs = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		set(root, keyContexts, cxs)
+	}
+	item := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	set(item, keyName, scalar(name))
+	set(item, keyContext, fields)
+	cxs.Content = append(cxs.Content, item)
+	return fields
+}
+
+// setAPIVersion sets the apiVersion as the first key of root, moving any
+// comment at the top of the file above it.
+func setAPIVersion(root *yaml.Node) {
+	if i, _ := lookup(root, keyAPIVersion); i >= 0 {
+		set(root, keyAPIVersion, scalar(APIVersion))
+		return
+	}
+	key := scalar(keyAPIVersion)
+	if len(root.Content) > 0 {
+		key.HeadComment = root.Content[0].HeadComment
+		root.Content[0].HeadComment = ""
+	}
+	root.Content = append([]*yaml.Node{key, scalar(APIVersion)}, root.Content...)
+}
+
+// ContextNames returns the names of the contexts, in the order they appear.
+func (f *File) ContextNames() []string {
+	cxs, _ := f.entries()
+	if len(cxs) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(cxs))
+	for _, e := range cxs {
+		names = append(names, e.name.Value)
+	}
+	return names
+}
+
+// CurrentContext returns the name of the current context.
+func (f *File) CurrentContext() string {
+	cur := currentContext(f.root())
+	if cur == nil {
+		return ""
+	}
+	return cur.Value
+}
+
+func notFound(name string) error {
+	return errors.Codef(errors.ErrUsage, "context %q not found", name)
+}
+
+// UseContext makes the named context current.
+func (f *File) UseContext(name string) error {
+	if err := f.editable(); err != nil {
+		return err
+	}
+	if _, ok := f.entry(name); !ok {
+		return notFound(name)
+	}
+	set(f.root(), keyCurrentContext, scalar(name))
+	return nil
+}
+
+// SetContext creates the named context, or updates an existing one. fields
+// maps the context fields (scheme, host, user, password, database) to their
+// new values. An empty value removes the field. If fields includes dsn, it
+// replaces all other fields, except the password sources and connection
+// fields, such as TLS. Setting one of the password fields removes the others.
+// If an existing context is given as a DSN, and fields which it represents are
+// set, the DSN is first expanded into its fields.
+// SetContext returns true if the context was created.
+func (f *File) SetContext(name string, fields map[string]string) (bool, error) {
+	if name == "" {
+		return false, errors.Code(errors.ErrUsage, "context name required")
+	}
+	if err := f.editable(); err != nil {
+		return false, err
+	}
+	e, ok := f.entry(name)
+	created := !ok
+	cx := e.fields
+	switch {
+	case created:
+		cx = f.addContext(name)
+	case e.item != nil:
+		// Attach the context, in case it was empty.
+		set(e.item, keyContext, cx)
+	}
+	if dsn, ok := fields[keyDSN]; ok {
+		if _, err := url.Parse(dsn); err != nil {
+			return false, errors.WithCode(err, errors.ErrUsage)
+		}
+		sources := cx.Content
+		cx.Content = nil
+		set(cx, keyDSN, scalar(dsn))
+		for i := 0; i+1 < len(sources); i += 2 {
+			if key := sources[i].Value; (key != fieldPassword && contains(passwordFields, key)) || contains(connectionFields, key) {
+				cx.Content = append(cx.Content, sources[i], sources[i+1])
+			}
+		}
+		setPasswordFields(cx, fields)
+		return created, setFields(cx, fields, connectionFields)
+	}
+	if _, dsn := lookup(cx, keyDSN); dsn != nil && !connectionOnly(fields) {
+		if err := expandDSNNode(cx, dsn.Value); err != nil {
+			return false, err
+		}
+	}
+	if err := setFields(cx, fields, contextFields); err != nil {
+		return false, err
+	}
+	setPasswordFields(cx, fields)
+	return created, nil
+}
+
+// connectionOnly returns true if fields sets only connection fields, which
+// may be combined with a DSN.
+func connectionOnly(fields map[string]string) bool {
+	for field := range fields {
+		if !contains(connectionFields, field) {
+			return false
+		}
+	}
+	return true
+}
+
+// setFields sets the non-password fields in list of the context node cx,
+// found in fields.
+func setFields(cx *yaml.Node, fields map[string]string, list []string) error {
+	for _, field := range list {
+		if contains(passwordFields, field) {
+			continue
+		}
+		value, ok := fields[field]
+		switch {
+		case !ok:
+		case value == "":
+			unset(cx, field)
+		default:
+			node, err := fieldValue(field, value)
+			if err != nil {
+				return err
+			}
+			set(cx, field, node)
+		}
+	}
+	return nil
+}
+
+// fieldValue returns the node for value of field, validating fields which
+// are not strings.
+func fieldValue(field, value string) (*yaml.Node, error) {
+	switch field {
+	case fieldInsecureSkipVerify:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.Codef(errors.ErrUsage, "%s: invalid boolean value: %s", field, value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(b)}, nil
+	case fieldTLSHandshakeTimeout:
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, errors.Codef(errors.ErrUsage, "%s: %w", field, err)
+		}
+	}
+	return scalar(value), nil
+}
+
+// setPasswordFields sets the password fields of the context node cx found in
+// fields. As only one may be used, setting one removes the others.
+func setPasswordFields(cx *yaml.Node, fields map[string]string) {
+	for _, field := range passwordFields {
+		value, ok := fields[field]
+		switch {
+		case !ok:
+		case value == "":
+			unset(cx, field)
+		default:
+			for _, other := range passwordFields {
+				if other != field {
+					unset(cx, other)
+				}
+			}
+			set(cx, field, scalar(value))
+		}
+	}
+}
+
+// SetHeaders sets headers sent with every request by the named context, which
+// must exist. A header with an empty value is removed.
+func (f *File) SetHeaders(name string, headers map[string]string) error {
+	if err := f.editable(); err != nil {
+		return err
+	}
+	e, ok := f.entry(name)
+	if !ok {
+		return notFound(name)
+	}
+	_, node := lookup(e.fields, keyHeaders)
+	if node == nil {
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	names := make([]string, 0, len(headers))
+	for header := range headers {
+		names = append(names, header)
+	}
+	sort.Strings(names)
+	for _, header := range names {
+		if value := headers[header]; value != "" {
+			set(node, header, scalar(value))
+		} else {
+			unset(node, header)
+		}
+	}
+	if len(node.Content) == 0 {
+		unset(e.fields, keyHeaders)
+		return nil
+	}
+	set(e.fields, keyHeaders, node)
+	return nil
+}
+
+// SetResolve replaces the resolve entries of the named context, which must
+// exist. An empty list removes them.
+func (f *File) SetResolve(name string, resolve []string) error {
+	if err := f.editable(); err != nil {
+		return err
+	}
+	e, ok := f.entry(name)
+	if !ok {
+		return notFound(name)
+	}
+	if len(resolve) == 0 {
+		unset(e.fields, keyResolve)
+		return nil
+	}
+	node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, entry := range resolve {
+		if _, _, _, err := ParseResolve(entry); err != nil {
+			return err
+		}
+		node.Content = append(node.Content, scalar(entry))
+	}
+	set(e.fields, keyResolve, node)
+	return nil
+}
+
+// expandDSNNode replaces the dsn field of the context node cx with the
+// individual fields it represents.
+func expandDSNNode(cx *yaml.Node, dsn string) error {
+	var parsed Context
+	if err := yaml.Unmarshal([]byte("dsn: "+dsn), &parsed); err != nil {
+		return errors.WithCode(err, errors.ErrUsage)
+	}
+	unset(cx, keyDSN)
+	values := map[string]string{
+		"scheme":   parsed.Scheme,
+		"host":     parsed.Host,
+		"user":     parsed.User,
+		"password": parsed.Password,
+		"database": strings.TrimPrefix(parsed.Database, "/"),
+	}
+	for _, field := range contextFields {
+		if values[field] != "" {
+			set(cx, field, scalar(values[field]))
+		}
+	}
+	return nil
+}
+
+// DeleteContext removes the named context. If it was the current context,
+// the current context is unset.
+func (f *File) DeleteContext(name string) error {
+	if err := f.editable(); err != nil {
+		return err
+	}
+	e, ok := f.entry(name)
+	if !ok {
+		return notFound(name)
+	}
+	_, cxs := lookup(f.root(), keyContexts)
+	if e.item == nil {
+		unset(cxs, name)
+	} else {
+		for i, item := range cxs.Content {
+			if item == e.item {
+				cxs.Content = append(cxs.Content[:i], cxs.Content[i+1:]...)
+				break
+			}
+		}
+	}
+	if f.CurrentContext() == name {
+		unset(f.root(), keyCurrentContext)
+	}
+	return nil
+}
+
+// RenameContext renames a context. If it was the current context, the
+// current context is updated.
+func (f *File) RenameContext(oldName, newName string) error {
+	if err := f.editable(); err != nil {
+		return err
+	}
+	if newName == "" {
+		return errors.Code(errors.ErrUsage, "new context name required")
+	}
+	e, ok := f.entry(oldName)
+	if !ok {
+		return notFound(oldName)
+	}
+	if _, ok := f.entry(newName); ok {
+		return errors.Codef(errors.ErrUsage, "context %q already exists", newName)
+	}
+	e.name.Value = newName
+	if f.CurrentContext() == oldName {
+		set(f.root(), keyCurrentContext, scalar(newName))
+	}
+	return nil
+}
+
+// Migrate upgrades the file to the current schema, preserving comments where
+// possible. It returns false if the file is empty, or already uses the current
+// schema.
+func (f *File) Migrate() (bool, error) {
+	fm := f.form()
+	root := f.root()
+	if fm == formV1 || len(root.Content) == 0 {
+		return false, nil
+	}
+	cxs, err := f.entries()
+	if err != nil {
+		return false, err
+	}
+	if fm != formEmpty {
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, e := range cxs {
+			seq.Content = append(seq.Content, migrateEntry(e, fm))
+		}
+		set(root, keyContexts, seq)
+	}
+	if i, def := lookup(root, keyDefault); def != nil {
+		if _, cur := lookup(root, keyCurrentContext); cur == nil {
+			root.Content[i].Value = keyCurrentContext
+		} else {
+			unset(root, keyDefault)
+		}
+	}
+	setAPIVersion(root)
+	return true, nil
+}
+
+// migrateEntry returns e as a list item in the current schema.
+func migrateEntry(e entry, fm form) *yaml.Node {
+	item := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	nameKey := scalar(keyName)
+	name := scalar(e.name.Value)
+	name.LineComment = e.name.LineComment
+	// Comments above the context now belong above the list item.
+	if fm == formLegacyMap {
+		item.HeadComment = e.name.HeadComment
+	} else if len(e.item.Content) > 0 {
+		nameKey.HeadComment = e.item.Content[0].HeadComment
+		item.HeadComment = e.item.HeadComment
+	}
+	item.Content = []*yaml.Node{nameKey, name, scalar(keyContext), e.fields}
+	return item
+}
+
+// Encode writes the config as YAML to w. If redact is true, passwords are
+// replaced.
+func (f *File) Encode(w io.Writer, redact bool) error {
+	doc := f.doc
+	if redact {
+		doc = copyNode(f.doc)
+		cxs, _ := (&File{doc: doc}).entries()
+		redactContexts(cxs)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2) // nolint:gomnd
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func copyNode(n *yaml.Node) *yaml.Node {
+	cp := *n
+	cp.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		cp.Content[i] = copyNode(child)
+	}
+	return &cp
+}
+
+func redactContexts(cxs []entry) {
+	for _, e := range cxs {
+		cx := e.fields
+		if _, pw := lookup(cx, "password"); pw != nil && pw.Value != "" {
+			pw.Value = redacted
+		}
+		if _, auth := lookup(cx, keyAuth); auth != nil {
+			for _, key := range []string{"token", "secret"} {
+				if _, v := lookup(auth, key); v != nil && v.Value != "" {
+					v.Value = redacted
+				}
+			}
+		}
+		for _, key := range []string{keyDSN, fieldProxy} {
+			if _, v := lookup(cx, key); v != nil {
+				v.Value = RedactDSN(v.Value)
+			}
+		}
+		if _, headers := lookup(cx, keyHeaders); headers != nil {
+			for i := 0; i+1 < len(headers.Content); i += 2 {
+				if sensitiveHeader(headers.Content[i].Value) && headers.Content[i+1].Value != "" {
+					headers.Content[i+1].Value = redacted
+				}
+			}
+		}
+	}
+}
+
+// RedactDSN returns dsn with any password replaced.
+func RedactDSN(dsn string) string {
+	uri, err := url.Parse(dsn)
+	if err != nil || uri.User == nil {
+		return dsn
+	}
+	if _, ok := uri.User.Password(); !ok {
+		return dsn
+	}
+	// Set the password after formatting, to avoid escaping.
+	uri.User = url.User(uri.User.Username())
+	return strings.Replace(uri.String(), "@", ":"+redacted+"@", 1)
+}
+
+// Save writes the config file atomically, by writing to a temporary file in
+// the same directory, then renaming it over the original.
+func (f *File) Save() error {
+	var buf bytes.Buffer
+	if err := f.Encode(&buf, false); err != nil {
+		return errors.Code(errors.ErrIO, err)
+	}
+	dir := filepath.Dir(f.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil { // nolint:gomnd
+		return errors.Code(errors.ErrCantCreate, err)
+	}
+	mode := os.FileMode(0o600) // nolint:gomnd
+	if info, err := os.Stat(f.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(f.path)+".*")
+	if err != nil {
+		return errors.Code(errors.ErrCantCreate, err)
+	}
+	defer os.Remove(tmp.Name()) // nolint:errcheck
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return errors.Code(errors.ErrIO, err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return errors.Code(errors.ErrIO, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return errors.Code(errors.ErrIO, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Code(errors.ErrIO, err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return errors.Code(errors.ErrIO, err)
+	}
+	return nil
+}
@@ -0,0 +1,400 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// APIVersion is the current version of the config file schema.
+const APIVersion = "kivik/v1"
+
+// Config file keys.
+const (
+	keyAPIVersion     = "apiVersion"
+	keyContexts       = "contexts"
+	keyCurrentContext = "current-context"
+	// keyDefault is the legacy list form's name for current-context.
+	keyDefault = "default"
+	keyName    = "name"
+	keyContext = "context"
+	keyDSN     = "dsn"
+	keyAuth    = "auth"
+)
+
+// dsnCompatible lists the context fields which may be combined with dsn.
+var dsnCompatible = append([]string{fieldPasswordEnv, fieldPasswordCommand, fieldPasswordFile, keyAuth}, connectionFields...)
+
+// form identifies the schema of a config file.
+type form int
+
+const (
+	// formEmpty is a config file with no contexts, and no apiVersion.
+	formEmpty form = iota
+	// formLegacyMap is the original, unversioned schema, with contexts
+	// keyed by name:
+	//
+	//	contexts:
+	//	  foo:
+	//	    dsn: http://localhost:5984/
+	//	current-context: foo
+	formLegacyMap
+	// formLegacyList is the unversioned list schema, once documented in the
+	// README, with context fields alongside the name:
+	//
+	//	contexts:
+	//	- context:
+	//	  name: foo
+	//	  dsn: http://localhost:5984/
+	//	default: foo
+	formLegacyList
+	// formV1 is the kivik/v1 schema:
+	//
+	//	apiVersion: kivik/v1
+	//	contexts:
+	//	- name: foo
+	//	  context:
+	//	    dsn: http://localhost:5984/
+	//	current-context: foo
+	formV1
+)
+
+// entry is a single context in a config file.
+type entry struct {
+	// name is the scalar node holding the context name.
+	name *yaml.Node
+	// fields is the mapping node of context fields. For formLegacyList, it
+	// is a synthetic node, so changes to it are not saved.
+	fields *yaml.Node
+	// item is the list item holding the context, for list forms.
+	item *yaml.Node
+}
+
+// schemaErr returns a usage error describing a problem with node n.
+func schemaErr(n *yaml.Node, format string, args ...interface{}) error {
+	return errors.Codef(errors.ErrUsage, "line %d, column %d: %s", n.Line, n.Column, fmt.Sprintf(format, args...))
+}
+
+// detectForm identifies the schema used by the config root mapping node.
+func detectForm(root *yaml.Node) (form, error) {
+	if _, v := lookup(root, keyAPIVersion); v != nil {
+		if v.Kind != yaml.ScalarNode || v.Value != APIVersion {
+			return 0, schemaErr(v, "unsupported apiVersion %q, expected %q", v.Value, APIVersion)
+		}
+		if _, cxs := lookup(root, keyContexts); cxs != nil && cxs.Kind != yaml.SequenceNode && !isNull(cxs) {
+			return 0, schemaErr(cxs, "contexts must be a list")
+		}
+		return formV1, nil
+	}
+	_, cxs := lookup(root, keyContexts)
+	switch {
+	case cxs == nil || isNull(cxs):
+		return formEmpty, nil
+	case cxs.Kind == yaml.MappingNode:
+		return formLegacyMap, nil
+	case cxs.Kind == yaml.SequenceNode:
+		return formLegacyList, nil
+	}
+	return 0, schemaErr(cxs, "contexts must be a list or a mapping")
+}
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
+
+// topLevelKeys lists the keys permitted at the top level of each form.
+var topLevelKeys = map[form][]string{
+	formEmpty:      {keyContexts, keyCurrentContext},
+	formLegacyMap:  {keyContexts, keyCurrentContext},
+	formLegacyList: {keyContexts, keyCurrentContext, keyDefault},
+	formV1:         {keyAPIVersion, keyContexts, keyCurrentContext},
+}
+
+// checkKeys returns an error for the first key in mapping node m that is not
+// one of known. what describes m, for the error message.
+func checkKeys(m *yaml.Node, what string, known ...string) error {
+	seen := make(map[string]bool, len(m.Content)/2) // nolint:gomnd
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		key := m.Content[i]
+		if seen[key.Value] {
+			return schemaErr(key, "duplicate key %q%s", key.Value, what)
+		}
+		seen[key.Value] = true
+		if !contains(known, key.Value) {
+			return schemaErr(key, "unknown key %q%s", key.Value, what)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// entries returns the contexts in the config root mapping node, in the order
+// they appear, after validating the schema.
+func entries(root *yaml.Node, fm form) ([]entry, error) {
+	if err := checkKeys(root, "", topLevelKeys[fm]...); err != nil {
+		return nil, err
+	}
+	for _, key := range []string{keyCurrentContext, keyDefault} {
+		if _, v := lookup(root, key); v != nil && v.Kind != yaml.ScalarNode {
+			return nil, schemaErr(v, "%s must be a context name", key)
+		}
+	}
+	_, cxs := lookup(root, keyContexts)
+	var result []entry
+	switch fm {
+	case formEmpty:
+		return nil, nil
+	case formLegacyMap:
+		result = make([]entry, 0, len(cxs.Content)/2) // nolint:gomnd
+		for i := 0; i+1 < len(cxs.Content); i += 2 {
+			result = append(result, entry{name: cxs.Content[i], fields: cxs.Content[i+1]})
+		}
+	default:
+		result = make([]entry, 0, len(cxs.Content))
+		for _, item := range cxs.Content {
+			e, err := listEntry(item, fm)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, e)
+		}
+	}
+	names := make(map[string]bool, len(result))
+	for _, e := range result {
+		if e.name.Kind != yaml.ScalarNode || e.name.Value == "" {
+			return nil, schemaErr(e.name, "context name required")
+		}
+		if names[e.name.Value] {
+			return nil, schemaErr(e.name, "duplicate context %q", e.name.Value)
+		}
+		names[e.name.Value] = true
+		if err := checkContext(e); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// listEntry returns the entry for a list item.
+func listEntry(item *yaml.Node, fm form) (entry, error) {
+	if item.Kind != yaml.MappingNode {
+		return entry{}, schemaErr(item, "context must be a mapping")
+	}
+	_, name := lookup(item, keyName)
+	if name == nil {
+		return entry{}, schemaErr(item, "context name required")
+	}
+	_, fields := lookup(item, keyContext)
+	if fm == formV1 || (fields != nil && fields.Kind == yaml.MappingNode) {
+		if err := checkKeys(item, fmt.Sprintf(" in context %q", name.Value), keyName, keyContext); err != nil {
+			return entry{}, err
+		}
+		if fields == nil || isNull(fields) {
+			fields = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: item.Line, Column: item.Column}
+		}
+		return entry{name: name, fields: fields, item: item}, nil
+	}
+	// Legacy list form: the fields are alongside the name.
+	fields = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: item.Line, Column: item.Column}
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		switch key := item.Content[i]; key.Value {
+		case keyName:
+		case keyContext:
+			if v := item.Content[i+1]; !isNull(v) {
+				return entry{}, schemaErr(v, "context must be a mapping")
+			}
+		default:
+			fields.Content = append(fields.Content, key, item.Content[i+1])
+		}
+	}
+	return entry{name: name, fields: fields, item: item}, nil
+}
+
+// checkContext validates the fields of a context.
+func checkContext(e entry) error {
+	if e.fields.Kind != yaml.MappingNode {
+		return schemaErr(e.fields, "context %q must be a mapping", e.name.Value)
+	}
+	known := append([]string{keyDSN, keyAuth, keyHeaders, keyResolve}, contextFields...)
+	if err := checkKeys(e.fields, fmt.Sprintf(" in context %q", e.name.Value), known...); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(e.fields.Content); i += 2 {
+		key, v := e.fields.Content[i], e.fields.Content[i+1]
+		if key.Value == keyAuth {
+			if err := checkAuth(v, e.name.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		if key.Value == keyHeaders {
+			if err := checkHeaders(v, e.name.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		if key.Value == keyResolve {
+			if err := checkResolve(v, e.name.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		if v.Kind != yaml.ScalarNode {
+			return schemaErr(v, "%s in context %q must be a string", key.Value, e.name.Value)
+		}
+	}
+	var password *yaml.Node
+	for i := 0; i+1 < len(e.fields.Content); i += 2 {
+		key := e.fields.Content[i]
+		if !contains(passwordFields, key.Value) {
+			continue
+		}
+		if password != nil {
+			return schemaErr(key, "%s in context %q cannot be combined with %s", key.Value, e.name.Value, password.Value)
+		}
+		password = key
+	}
+	if i, _ := lookup(e.fields, keyDSN); i >= 0 {
+		for j := 0; j+1 < len(e.fields.Content); j += 2 {
+			if key := e.fields.Content[j].Value; key != keyDSN && !contains(dsnCompatible, key) {
+				return schemaErr(e.fields.Content[i], "dsn in context %q cannot be combined with %s", e.name.Value, key)
+			}
+		}
+	}
+	return nil
+}
+
+// checkAuth validates the auth block of the named context.
+func checkAuth(auth *yaml.Node, name string) error {
+	if auth.Kind != yaml.MappingNode {
+		return schemaErr(auth, "auth in context %q must be a mapping", name)
+	}
+	_, typ := lookup(auth, "type")
+	if typ == nil {
+		return schemaErr(auth, "auth in context %q requires a type", name)
+	}
+	known, ok := authFields[typ.Value]
+	if !ok {
+		return schemaErr(typ, "unsupported auth type %q in context %q, expected one of basic, cookie, jwt or proxy", typ.Value, name)
+	}
+	if err := checkKeys(auth, fmt.Sprintf(" in %s auth of context %q", typ.Value, name), known...); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(auth.Content); i += 2 {
+		key, v := auth.Content[i], auth.Content[i+1]
+		if key.Value == "roles" {
+			if v.Kind != yaml.SequenceNode {
+				return schemaErr(v, "roles in context %q must be a list", name)
+			}
+			continue
+		}
+		if v.Kind != yaml.ScalarNode {
+			return schemaErr(v, "%s in context %q must be a string", key.Value, name)
+		}
+	}
+	if typ.Value == AuthJWT {
+		_, token := lookup(auth, "token")
+		_, command := lookup(auth, "token-command")
+		switch {
+		case token == nil && command == nil:
+			return schemaErr(auth, "jwt auth in context %q requires token or token-command", name)
+		case token != nil && command != nil:
+			return schemaErr(command, "token-command in context %q cannot be combined with token", name)
+		}
+	}
+	return nil
+}
+
+// checkHeaders validates the headers of the named context.
+func checkHeaders(headers *yaml.Node, name string) error {
+	if headers.Kind != yaml.MappingNode {
+		return schemaErr(headers, "headers in context %q must be a mapping", name)
+	}
+	for i := 0; i+1 < len(headers.Content); i += 2 {
+		key, v := headers.Content[i], headers.Content[i+1]
+		if key.Value == "" || strings.ContainsAny(key.Value, " \t:") {
+			return schemaErr(key, "invalid header name %q in context %q", key.Value, name)
+		}
+		if v.Kind != yaml.ScalarNode {
+			return schemaErr(v, "header %s in context %q must be a string", key.Value, name)
+		}
+	}
+	return nil
+}
+
+// checkResolve validates the resolve list of the named context.
+func checkResolve(resolve *yaml.Node, name string) error {
+	if resolve.Kind != yaml.SequenceNode {
+		return schemaErr(resolve, "resolve in context %q must be a list", name)
+	}
+	for _, v := range resolve.Content {
+		if v.Kind != yaml.ScalarNode {
+			return schemaErr(v, "resolve in context %q must be a list of host:port:addr", name)
+		}
+		if _, _, _, err := ParseResolve(v.Value); err != nil {
+			return schemaErr(v, "%s in context %q", err, name)
+		}
+	}
+	return nil
+}
+
+// currentContext returns the node holding the current context name, or nil.
+func currentContext(root *yaml.Node) *yaml.Node {
+	if _, cur := lookup(root, keyCurrentContext); cur != nil {
+		return cur
+	}
+	_, cur := lookup(root, keyDefault)
+	return cur
+}
+
+// UnmarshalYAML decodes and validates a config file, in any supported form.
+func (c *Config) UnmarshalYAML(root *yaml.Node) error {
+	if root.Kind != yaml.MappingNode {
+		return schemaErr(root, "config must be a YAML mapping")
+	}
+	fm, err := detectForm(root)
+	if err != nil {
+		return err
+	}
+	cxs, err := entries(root, fm)
+	if err != nil {
+		return err
+	}
+	if c.Contexts == nil {
+		c.Contexts = make(map[string]*Context, len(cxs))
+	}
+	for _, e := range cxs {
+		cx := &Context{}
+		if err := e.fields.Decode(cx); err != nil {
+			return schemaErr(e.fields, "context %q: %s", e.name.Value, err)
+		}
+		c.Contexts[e.name.Value] = cx
+	}
+	if cur := currentContext(root); cur != nil {
+		c.CurrentContext = cur.Value
+	}
+	return nil
+}
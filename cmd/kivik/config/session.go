@@ -0,0 +1,97 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// session is a session cookie saved by kivik login.
+type session struct {
+	User    string    `json:"user,omitempty"`
+	Cookie  string    `json:"cookie"`
+	Path    string    `json:"path,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func newCookieJar() http.CookieJar {
+	// cookiejar.New never returns an error
+	jar, _ := cookiejar.New(nil)
+	return jar
+}
+
+// sessionFile returns the path of the file in which sessions for the named
+// context are saved, alongside the config file.
+func sessionFile(configFile, name string) string {
+	return filepath.Join(filepath.Dir(configFile), "sessions", url.PathEscape(name))
+}
+
+// loadSession returns the saved session cookie for the context, or nil if
+// there is none, or it has expired.
+func (c *Context) loadSession() (*http.Cookie, error) {
+	if c.SessionFile == "" {
+		return nil, nil
+	}
+	buf, err := os.ReadFile(c.SessionFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Code(errors.ErrNoInput, err)
+	}
+	var s session
+	if err := json.Unmarshal(buf, &s); err != nil {
+		return nil, errors.Codef(errors.ErrData, "%s: %w", c.SessionFile, err)
+	}
+	if !s.Expires.IsZero() && s.Expires.Before(time.Now()) {
+		return nil, nil
+	}
+	return &http.Cookie{
+		Name:    kivik.SessionCookieName,
+		Value:   s.Cookie,
+		Path:    s.Path,
+		Expires: s.Expires,
+	}, nil
+}
+
+// SaveSession saves the session cookie for the context, for use by later
+// commands. Like the config file, it is readable only by the owner.
+func (c *Context) SaveSession(cookie *http.Cookie) error {
+	if c.SessionFile == "" {
+		return errors.Code(errors.ErrUsage, "sessions can only be saved for contexts in the config file")
+	}
+	// Marshaling this struct cannot fail.
+	buf, _ := json.Marshal(session{
+		User:    c.User,
+		Cookie:  cookie.Value,
+		Path:    cookie.Path,
+		Expires: cookie.Expires,
+	})
+	if err := os.MkdirAll(filepath.Dir(c.SessionFile), 0o700); err != nil { // nolint:gomnd
+		return errors.Code(errors.ErrCantCreate, err)
+	}
+	if err := os.WriteFile(c.SessionFile, buf, 0o600); err != nil { // nolint:gomnd
+		return errors.Code(errors.ErrCantCreate, err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// Context fields which configure TLS.
+const (
+	fieldCAFile              = "ca-file"
+	fieldCertFile            = "cert-file"
+	fieldKeyFile             = "key-file"
+	fieldInsecureSkipVerify  = "insecure-skip-verify"
+	fieldServerName          = "server-name"
+	fieldTLSHandshakeTimeout = "tls-handshake-timeout"
+)
+
+// tlsFields lists the fields which configure TLS.
+var tlsFields = []string{fieldCAFile, fieldCertFile, fieldKeyFile, fieldInsecureSkipVerify, fieldServerName, fieldTLSHandshakeTimeout}
+
+// tlsConfig returns the TLS configuration for the context, or nil if the
+// defaults are to be used.
+func (c *Context) tlsConfig() (*tls.Config, error) {
+	if c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && !c.InsecureSkipVerify && c.ServerName == "" {
+		return nil, nil
+	}
+	conf := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify, // nolint:gosec
+		MinVersion:         tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		path, err := expandHome(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Codef(errors.ErrNoInput, "ca-file: %w", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Codef(errors.ErrData, "ca-file: no certificates found in %s", c.CAFile)
+		}
+	}
+	switch {
+	case c.CertFile == "" && c.KeyFile == "":
+	case c.CertFile == "" || c.KeyFile == "":
+		return nil, errors.Code(errors.ErrUsage, "cert-file and key-file must be given together")
+	default:
+		certFile, err := expandHome(c.CertFile)
+		if err != nil {
+			return nil, err
+		}
+		keyFile, err := expandHome(c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Codef(errors.ErrData, "cert-file: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
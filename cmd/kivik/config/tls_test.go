@@ -0,0 +1,196 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/flimzy/testy"
+)
+
+// writePEM writes a PEM block of type typ to a temporary file, and returns
+// its path.
+func writePEM(t *testing.T, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), strings.ToLower(strings.ReplaceAll(typ, " ", "-"))+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clientCert creates a self-signed client certificate, and returns the paths
+// of the certificate and key files, and the certificate.
+func clientCert(t *testing.T) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kivik"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "CERTIFICATE", der), writePEM(t, "PRIVATE KEY", keyDER), cert
+}
+
+// newTLSServer starts a TLS server which does not log handshake errors, as
+// they are expected.
+func newTLSServer(handler http.Handler) *httptest.Server {
+	s := httptest.NewUnstartedServer(handler)
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.StartTLS()
+	return s
+}
+
+func TestContext_KivikClient_tls(t *testing.T) {
+	type tt struct {
+		server *httptest.Server
+		cx     *Context
+		err    string
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	})
+	caFile := func(t *testing.T, s *httptest.Server) string {
+		return writePEM(t, "CERTIFICATE", s.Certificate().Raw)
+	}
+
+	tests := testy.NewTable()
+	tests.Add("unknown CA", func(t *testing.T) interface{} {
+		return tt{
+			server: newTLSServer(handler),
+			cx:     &Context{},
+			err:    "certificate signed by unknown authority",
+		}
+	})
+	tests.Add("ca-file", func(t *testing.T) interface{} {
+		s := newTLSServer(handler)
+		return tt{
+			server: s,
+			cx:     &Context{CAFile: caFile(t, s)},
+		}
+	})
+	tests.Add("missing ca-file", func(t *testing.T) interface{} {
+		return tt{
+			server: newTLSServer(handler),
+			cx:     &Context{CAFile: filepath.Join(t.TempDir(), "ca.pem")},
+			err:    "^ca-file: open .*: no such file or directory$",
+		}
+	})
+	tests.Add("ca-file without certificates", func(t *testing.T) interface{} {
+		path := filepath.Join(t.TempDir(), "ca.pem")
+		if err := os.WriteFile(path, []byte("not a certificate"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return tt{
+			server: newTLSServer(handler),
+			cx:     &Context{CAFile: path},
+			err:    "^ca-file: no certificates found in ",
+		}
+	})
+	tests.Add("insecure-skip-verify", tt{
+		server: newTLSServer(handler),
+		cx:     &Context{InsecureSkipVerify: true},
+	})
+	tests.Add("server-name", func(t *testing.T) interface{} {
+		s := newTLSServer(handler)
+		return tt{
+			server: s,
+			cx:     &Context{CAFile: caFile(t, s), ServerName: "example.com"},
+		}
+	})
+	tests.Add("wrong server-name", func(t *testing.T) interface{} {
+		s := newTLSServer(handler)
+		return tt{
+			server: s,
+			cx:     &Context{CAFile: caFile(t, s), ServerName: "couchdb.example.net"},
+			err:    "certificate is valid for .*, not couchdb.example.net$",
+		}
+	})
+	tests.Add("client certificate", func(t *testing.T) interface{} {
+		certFile, keyFile, cert := clientCert(t)
+		s := httptest.NewUnstartedServer(handler)
+		s.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+		s.TLS.ClientCAs.AddCert(cert)
+		s.StartTLS()
+		return tt{
+			server: s,
+			cx:     &Context{CAFile: caFile(t, s), CertFile: certFile, KeyFile: keyFile},
+		}
+	})
+	tests.Add("cert-file without key-file", func(t *testing.T) interface{} {
+		certFile, _, _ := clientCert(t)
+		return tt{
+			server: newTLSServer(handler),
+			cx:     &Context{CertFile: certFile},
+			err:    "^cert-file and key-file must be given together$",
+		}
+	})
+	tests.Add("mismatched key-file", func(t *testing.T) interface{} {
+		certFile, _, _ := clientCert(t)
+		_, keyFile, _ := clientCert(t)
+		return tt{
+			server: newTLSServer(handler),
+			cx:     &Context{CertFile: certFile, KeyFile: keyFile},
+			err:    "^cert-file: tls: private key does not match public key$",
+		}
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		t.Cleanup(tt.server.Close)
+		tt.cx.Scheme = "https"
+		tt.cx.Host = strings.TrimPrefix(tt.server.URL, "https://")
+		client, err := tt.cx.KivikClient(0, 0)
+		if err == nil {
+			_, err = client.Ping(context.Background())
+		}
+		testy.ErrorRE(t, tt.err, err)
+	})
+}
@@ -0,0 +1,106 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-kivik/xkivik/v4/cmd/kivik/errors"
+)
+
+// Context fields which configure the HTTP transport, other than TLS.
+const (
+	fieldProxy     = "proxy"
+	fieldUserAgent = "user-agent"
+	keyHeaders     = "headers"
+)
+
+// connectionFields lists the fields which configure the connection to the
+// server, rather than identify it, so may be combined with dsn.
+var connectionFields = append([]string{fieldProxy, fieldUserAgent, keyHeaders, fieldUnixSocket, keyResolve}, tlsFields...)
+
+// proxy returns the proxy function for the context. Without a proxy
+// configured, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+// are used, unless the server is reached through a Unix socket.
+func (c *Context) proxy() (func(*http.Request) (*url.URL, error), error) {
+	switch {
+	case c.Proxy == "" && c.UnixSocket != "":
+		return nil, nil
+	case c.Proxy == "":
+		return http.ProxyFromEnvironment, nil
+	}
+	uri, err := url.Parse(c.Proxy)
+	if err != nil {
+		return nil, errors.Codef(errors.ErrUsage, "proxy: %w", err)
+	}
+	if uri.Scheme == "" || uri.Host == "" {
+		return nil, errors.Codef(errors.ErrUsage, "proxy: %s is not an absolute URL", RedactDSN(c.Proxy))
+	}
+	return http.ProxyURL(uri), nil
+}
+
+// headerTransport adds the context's headers to each request.
+type headerTransport struct {
+	http.RoundTripper
+	header    map[string]string
+	userAgent string
+}
+
+var _ http.RoundTripper = &headerTransport{}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.header {
+		req.Header.Set(name, value)
+	}
+	if t.userAgent != "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// transport wraps rt to add the context's headers, if any.
+func (c *Context) transport(rt http.RoundTripper) http.RoundTripper {
+	if len(c.Headers) == 0 && c.UserAgent == "" {
+		return rt
+	}
+	return &headerTransport{RoundTripper: rt, header: c.Headers, userAgent: c.UserAgent}
+}
+
+// ParseHeader parses a header given as "Name: value", as by curl.
+func ParseHeader(header string) (name, value string, err error) {
+	name, value, ok := strings.Cut(header, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", errors.Codef(errors.ErrUsage, "invalid header %q, expected Name: value", header)
+	}
+	return http.CanonicalHeaderKey(name), strings.TrimSpace(value), nil
+}
+
+// sensitiveHeader returns true if the value of the named header is likely to
+// be a credential, so should be redacted.
+func sensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	switch name {
+	case "authorization", "proxy-authorization", "cookie":
+		return true
+	}
+	for _, s := range []string{"token", "secret", "key", "password"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+)
+
+func TestContext_KivikClient_transport(t *testing.T) {
+	type tt struct {
+		cx    *Context
+		proxy bool
+		check func(*http.Request) error
+		err   string
+	}
+
+	header := func(name, want string) func(*http.Request) error {
+		return func(r *http.Request) error {
+			if got := r.Header.Get(name); got != want {
+				return fmt.Errorf("Unexpected %s header: %q", name, got)
+			}
+			return nil
+		}
+	}
+
+	tests := testy.NewTable()
+	tests.Add("headers", tt{
+		cx:    &Context{Headers: map[string]string{"X-Api-Key": "abc123"}},
+		check: header("X-Api-Key", "abc123"),
+	})
+	tests.Add("user-agent", tt{
+		cx:    &Context{UserAgent: "nightly-backup/1.0"},
+		check: header("User-Agent", "nightly-backup/1.0"),
+	})
+	tests.Add("proxy", tt{
+		cx:    &Context{},
+		proxy: true,
+		check: func(r *http.Request) error {
+			if r.URL.Host != "couchdb.invalid:5984" {
+				return fmt.Errorf("Unexpected proxied host: %q", r.URL.Host)
+			}
+			return nil
+		},
+	})
+	tests.Add("proxy with headers", tt{
+		cx:    &Context{UserAgent: "kivik", Headers: map[string]string{"X-Gateway": "couch"}},
+		proxy: true,
+		check: func(r *http.Request) error {
+			for name, want := range map[string]string{"User-Agent": "kivik", "X-Gateway": "couch"} {
+				if err := header(name, want)(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	tests.Add("invalid proxy", tt{
+		cx:  &Context{Proxy: "http://proxy/%xx"},
+		err: `proxy: parse "http://proxy/%xx": invalid URL escape "%xx"`,
+	})
+	tests.Add("relative proxy", tt{
+		cx:  &Context{Proxy: "proxy:3128"},
+		err: "proxy: proxy:3128 is not an absolute URL",
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := tt.check(r); err != nil {
+				t.Error(err)
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		t.Cleanup(s.Close)
+		tt.cx.Scheme = "http"
+		tt.cx.Host = strings.TrimPrefix(s.URL, "http://")
+		if tt.proxy {
+			tt.cx.Proxy = s.URL
+			tt.cx.Host = "couchdb.invalid:5984"
+		}
+		client, err := tt.cx.KivikClient(0, 0)
+		if err == nil {
+			_, err = client.Ping(context.Background())
+		}
+		testy.Error(t, tt.err, err)
+	})
+}
+
+func TestParseHeader(t *testing.T) {
+	type tt struct {
+		header      string
+		name, value string
+		err         string
+	}
+
+	tests := testy.NewTable()
+	tests.Add("header", tt{
+		header: "x-api-key: abc123",
+		name:   "X-Api-Key",
+		value:  "abc123",
+	})
+	tests.Add("empty value", tt{
+		header: "X-Api-Key:",
+		name:   "X-Api-Key",
+	})
+	tests.Add("value with colon", tt{
+		header: "Forwarded: for=127.0.0.1:5984",
+		name:   "Forwarded",
+		value:  "for=127.0.0.1:5984",
+	})
+	tests.Add("missing colon", tt{
+		header: "X-Api-Key abc123",
+		err:    `invalid header "X-Api-Key abc123", expected Name: value`,
+	})
+	tests.Add("missing name", tt{
+		header: ": abc123",
+		err:    `invalid header ": abc123", expected Name: value`,
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		name, value, err := ParseHeader(tt.header)
+		testy.Error(t, tt.err, err)
+		if name != tt.name || value != tt.value {
+			t.Errorf("Unexpected result: %q, %q", name, value)
+		}
+	})
+}
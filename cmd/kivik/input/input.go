@@ -13,10 +13,12 @@
 package input
 
 import (
+	"bufio"
 	"encoding/json"
 	"io"
 	"os"
 	"strings"
+	"unicode"
 
 	"github.com/icza/dyno"
 	"github.com/spf13/pflag"
@@ -35,6 +37,12 @@ func New() *Input {
 	return &Input{}
 }
 
+// FromFile returns an Input which reads the named file. The file is assumed
+// to be JSON, unless the file extension is .yaml or .yml.
+func FromFile(filename string) *Input {
+	return &Input{file: filename}
+}
+
 func (i *Input) ConfigFlags(pf *pflag.FlagSet) {
 	pf.StringVarP(&i.data, "data", "d", "", "JSON document data.")
 	pf.StringVarP(&i.file, "data-file", "D", "", "Read document data from the named file. Use - for stdin. Assumed to be JSON, unless the file extension is .yaml or .yml, or the --yaml flag is used.")
@@ -147,3 +155,102 @@ func (i *Input) RawData() (io.ReadCloser, error) {
 	}
 	return nil, errors.Code(errors.ErrUsage, "no attachment data provided")
 }
+
+func (i *Input) isYAML() bool {
+	return i.yaml || strings.HasSuffix(i.file, ".yaml") || strings.HasSuffix(i.file, ".yml")
+}
+
+// Documents calls fn for each document in the input. The input may be a JSON
+// array of documents, newline-delimited JSON, or a multi-document YAML
+// stream. The input is read incrementally, so it need not fit in memory.
+func (i *Input) Documents(fn func(json.RawMessage) error) error {
+	if !i.HasInput() {
+		return errors.Code(errors.ErrUsage, "no document data provided")
+	}
+	r, err := i.RawData()
+	if err != nil {
+		return err
+	}
+	defer r.Close() // nolint:errcheck
+	if i.isYAML() {
+		return yamlDocuments(r, fn)
+	}
+	return jsonDocuments(r, fn)
+}
+
+func jsonDocuments(r io.Reader, fn func(json.RawMessage) error) error {
+	br := bufio.NewReader(r)
+	var array bool
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Code(errors.ErrIO, err)
+		}
+		if !unicode.IsSpace(rune(b)) {
+			array = b == '['
+			_ = br.UnreadByte()
+			break
+		}
+	}
+	dec := json.NewDecoder(br)
+	if !array {
+		for {
+			var doc json.RawMessage
+			if err := dec.Decode(&doc); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return errors.Code(errors.ErrData, err)
+			}
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return errors.Code(errors.ErrData, err)
+	}
+	for dec.More() {
+		var doc json.RawMessage
+		if err := dec.Decode(&doc); err != nil {
+			return errors.Code(errors.ErrData, err)
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return errors.Code(errors.ErrData, err)
+}
+
+func yamlDocuments(r io.Reader, fn func(json.RawMessage) error) error {
+	dec := yaml.NewDecoder(r)
+	for {
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Code(errors.ErrData, err)
+		}
+		docs, ok := doc.([]interface{})
+		if !ok {
+			docs = []interface{}{doc}
+		}
+		for _, doc := range docs {
+			if doc == nil {
+				continue
+			}
+			buf, err := json.Marshal(dyno.ConvertMapI2MapS(doc))
+			if err != nil {
+				return errors.Code(errors.ErrData, err)
+			}
+			if err := fn(buf); err != nil {
+				return err
+			}
+		}
+	}
+}
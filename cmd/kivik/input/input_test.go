@@ -99,3 +99,111 @@ func TestJSONData(t *testing.T) {
 		}
 	})
 }
+
+func TestDocuments(t *testing.T) {
+	type tt struct {
+		args   []string
+		stdin  string
+		want   []string
+		status int
+		err    string
+	}
+
+	tests := testy.NewTable()
+	tests.Add("no input", tt{
+		status: errors.ErrUsage,
+		err:    "no document data provided",
+	})
+	tests.Add("ndjson", tt{
+		args:  []string{"--data-file", "-"},
+		stdin: "{\"_id\":\"foo\"}\n{\"_id\":\"bar\"}\n\n{\"_id\":\"baz\"}\n",
+		want:  []string{`{"_id":"foo"}`, `{"_id":"bar"}`, `{"_id":"baz"}`},
+	})
+	tests.Add("json array", tt{
+		args: []string{"--data", ` [{"_id":"foo"}, {"_id":"bar"}]`},
+		want: []string{`{"_id":"foo"}`, `{"_id":"bar"}`},
+	})
+	tests.Add("empty input", tt{
+		args: []string{"--data", " \n"},
+	})
+	tests.Add("invalid json", tt{
+		args:   []string{"--data", `{"_id":"foo"}{"_id":`},
+		want:   []string{`{"_id":"foo"}`},
+		status: errors.ErrData,
+		err:    "unexpected EOF",
+	})
+	tests.Add("unterminated array", tt{
+		args:   []string{"--data", `[{"_id":"foo"}`},
+		want:   []string{`{"_id":"foo"}`},
+		status: errors.ErrData,
+		err:    "unexpected end of JSON input",
+	})
+	tests.Add("multi-document yaml", tt{
+		args:  []string{"--yaml", "--data-file", "-"},
+		stdin: "_id: foo\nage: 12\n---\n_id: bar\n",
+		want:  []string{`{"_id":"foo","age":12}`, `{"_id":"bar"}`},
+	})
+	tests.Add("yaml list", tt{
+		args: []string{"--data-file", "./testdata/docs.yaml"},
+		want: []string{`{"_id":"foo","name":"Bob"}`, `{"_id":"bar","name":"Alice"}`, `{"_id":"baz"}`},
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		i := New()
+		flags := pflag.NewFlagSet("x", pflag.ContinueOnError)
+		i.ConfigFlags(flags)
+		if err := flags.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		var err error
+		_, _ = testy.RedirIO(strings.NewReader(tt.stdin), func() {
+			err = i.Documents(func(doc json.RawMessage) error {
+				got = append(got, string(doc))
+				return nil
+			})
+		})
+
+		if status := errors.InspectErrorCode(err); status != tt.status {
+			t.Errorf("Unexpected error status. Want %d, got %d", tt.status, status)
+		}
+		testy.Error(t, tt.err, err)
+		if d := testy.DiffInterface(tt.want, got); d != nil {
+			t.Error(d)
+		}
+	})
+}
+
+func TestFromFile(t *testing.T) {
+	type tt struct {
+		filename string
+		want     interface{}
+		status   int
+	}
+
+	tests := testy.NewTable()
+	tests.Add("json", tt{
+		filename: "./testdata/doc.json",
+		want:     map[string]interface{}{"foo": "bar"},
+	})
+	tests.Add("yaml", tt{
+		filename: "./testdata/doc.yaml",
+		want:     map[string]interface{}{"_id": "bar", "_rev": "1-xxx", "foo": "bar"},
+	})
+	tests.Add("missing", tt{
+		filename: "./testdata/missing.yml",
+		status:   errors.ErrNoInput,
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		var got interface{}
+		err := FromFile(tt.filename).As(&got)
+		if status := errors.InspectErrorCode(err); status != tt.status {
+			t.Errorf("Unexpected error status. Want %d, got %d", tt.status, status)
+		}
+		if d := testy.DiffInterface(tt.want, got); d != nil {
+			t.Error(d)
+		}
+	})
+}
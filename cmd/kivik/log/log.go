@@ -16,6 +16,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
 )
 
@@ -68,15 +69,24 @@ func (l *logger) out(line string) {
 	fmt.Fprintln(l.stdout, strings.TrimSpace(line))
 }
 
+// urlPassword matches the password in a URL, such as a DSN.
+var urlPassword = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@"]*):[^/\s@"]*@`)
+
+// redact replaces any passwords in URLs in line, so that debug output may be
+// shared safely.
+func redact(line string) string {
+	return urlPassword.ReplaceAllString(line, "${1}:*****@")
+}
+
 func (l *logger) Debug(args ...interface{}) {
 	if l.debug {
-		l.err(fmt.Sprint(args...))
+		l.err(redact(fmt.Sprint(args...)))
 	}
 }
 
 func (l *logger) Debugf(format string, args ...interface{}) {
 	if l.debug {
-		l.err(fmt.Sprintf(format, args...))
+		l.err(redact(fmt.Sprintf(format, args...)))
 	}
 }
 
@@ -105,6 +105,44 @@ func (f *Formatter) Output(r io.Reader) error {
 	return fmt.Output(out, r)
 }
 
+// clearScreen moves the cursor home and clears the terminal.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// Refresh outputs r, as Output does. When the default format is written to a
+// terminal, the terminal is cleared first, so that repeated calls refresh the
+// output in place.
+func (f *Formatter) Refresh(r io.Reader) error {
+	if f.format == "" && (f.output == "" || f.output == "-") && isTerminal(os.Stdout) {
+		if _, err := io.WriteString(os.Stdout, clearScreen); err != nil {
+			return err
+		}
+	}
+	return f.Output(r)
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Stream copies r to the output as it is read, without any formatting. It is
+// intended for unbounded streams, such as NDJSON feeds, which can only be
+// represented by the default or raw formats.
+func (f *Formatter) Stream(r io.Reader) error {
+	if name := strings.SplitN(f.format, "=", 2)[0]; name != "" && name != "raw" { //nolint:gomnd
+		return errors.Codef(errors.ErrUsage, "output format %s not supported for streaming output", name)
+	}
+	out, err := f.writer()
+	if err != nil {
+		return err
+	}
+	if c, ok := out.(io.Closer); ok {
+		defer c.Close() // nolint:errcheck
+	}
+	_, err = io.Copy(out, r)
+	return err
+}
+
 func (f *Formatter) formatter() (Format, error) {
 	args := strings.SplitN(f.format, "=", 2) //nolint:gomnd
 	name := args[0]
@@ -131,7 +169,8 @@ func (f *Formatter) formatter() (Format, error) {
 func (f *Formatter) writer() (io.Writer, error) {
 	switch f.output {
 	case "", "-":
-		return ensureNewlineEnding(os.Stdout), nil
+		// Stdout is not closed, so that it may be written more than once.
+		return ensureNewlineEnding(struct{ io.Writer }{os.Stdout}), nil
 	}
 	return f.createFile(f.output)
 }
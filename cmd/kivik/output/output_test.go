@@ -43,3 +43,21 @@ func Test_ensurenewlineEnding(t *testing.T) {
 		}
 	})
 }
+
+func TestTableReader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	r := TableReader([]string{"NAME", "VALUE"}, [][]string{
+		{"foo", "1"},
+		{"a longer name", "2"},
+	}, strings.NewReader(""))
+	if err := r.Execute(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `NAME           VALUE
+foo            1
+a longer name  2
+`
+	if buf.String() != want {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+}
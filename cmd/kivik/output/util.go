@@ -14,7 +14,10 @@ package output
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"strings"
+	"text/tabwriter"
 	"text/template"
 )
 
@@ -56,3 +59,37 @@ func (t *tmplReader) Execute(w io.Writer) error {
 	}
 	return t.tmpl.Execute(w, t.data)
 }
+
+type tableReader struct {
+	io.Reader
+	header []string
+	rows   [][]string
+}
+
+var _ FriendlyOutput = &tableReader{}
+
+// TableReader returns a FriendlyOutput that renders rows as aligned columns,
+// beneath header. r is used for all non-friendly output formats.
+func TableReader(header []string, rows [][]string, r io.Reader) FriendlyOutput {
+	return &tableReader{
+		Reader: r,
+		header: header,
+		rows:   rows,
+	}
+}
+
+func (t *tableReader) Execute(w io.Writer) error {
+	if rc, ok := t.Reader.(io.ReadCloser); ok {
+		defer rc.Close() // nolint:errcheck
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0) // nolint:gomnd
+	if _, err := fmt.Fprintln(tw, strings.Join(t.header, "\t")); err != nil {
+		return err
+	}
+	for _, row := range t.rows {
+		if _, err := fmt.Fprintln(tw, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
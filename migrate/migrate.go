@@ -0,0 +1,479 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+// Package migrate applies schema-versioned migrations to the documents in a
+// CouchDB database.
+//
+// A migration is a function, registered under a schema version, which is
+// applied to each document matching a Mango selector. Migrations are applied
+// in order of version, and the progress of each is recorded in a _local
+// document in the database, so that an interrupted run resumes where it left
+// off, and migrations already applied are skipped.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kivik/kivik/v4"
+
+	"github.com/go-kivik/xkivik/v4"
+)
+
+// Func migrates a single document in place. It returns true if the document
+// was changed, and should be saved.
+type Func func(ctx context.Context, doc *xkivik.Document) (changed bool, err error)
+
+// Migration is a single schema migration.
+type Migration struct {
+	// Version is the schema version the migration upgrades documents to. It
+	// must be positive, and unique.
+	Version int
+	// Name is a short, human-readable description of the migration.
+	Name string
+	// Selector is a Mango selector, which limits the documents the migration
+	// is applied to. When empty, the migration is applied to all documents.
+	// Design documents are never migrated.
+	Selector map[string]interface{}
+	// Func is called for each matching document.
+	Func Func
+}
+
+func (m Migration) validate() error {
+	if m.Version <= 0 {
+		return fmt.Errorf("migration %q: version must be positive", m.Name)
+	}
+	if m.Func == nil {
+		return fmt.Errorf("migration %d: no function", m.Version)
+	}
+	return nil
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[int]Migration{}
+)
+
+// Register registers a migration, to be applied by Run via Registered, or by
+// the kivik migrate command in a binary which imports the registering package.
+// Register panics if the migration is invalid, or its version is already
+// registered.
+func Register(m Migration) {
+	if err := m.validate(); err != nil {
+		panic(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := registry[m.Version]; ok {
+		panic(fmt.Sprintf("migration %d already registered", m.Version))
+	}
+	registry[m.Version] = m
+}
+
+// Registered returns the registered migrations, ordered by version.
+func Registered() []Migration {
+	mu.RLock()
+	defer mu.RUnlock()
+	migrations := make([]Migration, 0, len(registry))
+	for _, m := range registry {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+// Migration statuses, as reported in MigrationResult.
+const (
+	// StatusApplied means the migration was applied to all matching
+	// documents.
+	StatusApplied = "applied"
+	// StatusIncomplete means some documents could not be saved. The failed
+	// documents are retried by the next run.
+	StatusIncomplete = "incomplete"
+	// StatusPending means the migration would be applied, in a dry run.
+	StatusPending = "pending"
+)
+
+// Result is the result of a migration run.
+type Result struct {
+	// StartVersion is the schema version of the database before the run.
+	StartVersion int `json:"start_version"`
+	// Version is the schema version of the database after the run.
+	Version int `json:"version"`
+	// Migrations lists the result of each migration applied, or, in a dry
+	// run, which would be applied.
+	Migrations []*MigrationResult `json:"migrations"`
+}
+
+// MigrationResult is the result of a single migration.
+type MigrationResult struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	// Matched is the number of documents the migration function was called
+	// for.
+	Matched int `json:"matched"`
+	// Changed is the number of documents the migration function changed.
+	Changed int `json:"changed"`
+	// Updated is the number of changed documents saved.
+	Updated int `json:"updated"`
+	// Changes lists the IDs of the changed documents, in a dry run.
+	Changes []string `json:"changes,omitempty"`
+	// Failed lists the documents which could not be saved.
+	Failed []*Failure `json:"failed,omitempty"`
+}
+
+// Failure is a document which could not be saved.
+type Failure struct {
+	ID  string `json:"id"`
+	Err error  `json:"-"`
+}
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (f *Failure) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"id":%q,"error":%q}`, f.ID, f.Err.Error())), nil
+}
+
+// DefaultProgressID is the default ID of the _local document which records
+// migration progress.
+const DefaultProgressID = "_local/kivik-migrate"
+
+const (
+	defaultBatchSize = 100
+	// maxAttempts is the number of times a document is saved, in the face of
+	// update conflicts, before it is recorded as failed.
+	maxAttempts = 3
+)
+
+// progress is the content of the progress document.
+type progress struct {
+	Rev string `json:"_rev,omitempty"`
+	// Version is the highest version applied.
+	Version int         `json:"version"`
+	Applied []applied   `json:"applied,omitempty"`
+	Current *checkpoint `json:"current,omitempty"`
+}
+
+type applied struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// checkpoint records the progress of an incomplete migration.
+type checkpoint struct {
+	Version int `json:"version"`
+	// LastID is the ID of the last document processed.
+	LastID string `json:"last_id"`
+	// Failed lists the documents which could not be saved.
+	Failed []string `json:"failed,omitempty"`
+}
+
+type multiOptions []kivik.Option
+
+func (o multiOptions) Apply(t interface{}) {
+	for _, opt := range o {
+		if opt != nil {
+			opt.Apply(t)
+		}
+	}
+}
+
+type migrator struct {
+	db         *kivik.DB
+	progressID string
+	batchSize  int
+	dryRun     bool
+	progress   *progress
+}
+
+// Run applies the pending migrations to db, in order of version. Migrations
+// with a version no greater than that recorded in the database are skipped.
+// Documents are read with the /{db}/_find endpoint, in batches, and changed
+// documents are saved with /{db}/_bulk_docs. Progress is checkpointed after
+// each batch.
+//
+// If any document cannot be saved, the migration is reported as incomplete,
+// and later migrations are not applied. The failed documents are retried by
+// the next run.
+//
+// The following options are supported:
+//
+//	dry_run (bool) - When true, report the documents which would be changed,
+//	                 without saving anything.
+//	batch_size (int) - The number of documents read per request. Defaults to
+//	                   100.
+//	target_version (int) - Apply only migrations up to and including this
+//	                       version.
+//	progress_id (string) - The ID of the _local document used to record
+//	                       progress. Defaults to DefaultProgressID.
+func Run(ctx context.Context, db *kivik.DB, migrations []Migration, options ...kivik.Option) (*Result, error) {
+	opts := map[string]interface{}{}
+	multiOptions(options).Apply(opts)
+	m := &migrator{
+		db:         db,
+		progressID: DefaultProgressID,
+		batchSize:  defaultBatchSize,
+	}
+	m.dryRun, _ = opts["dry_run"].(bool)
+	if id, ok := opts["progress_id"].(string); ok && id != "" {
+		m.progressID = id
+	}
+	if size, ok := opts["batch_size"].(int); ok {
+		if size <= 0 {
+			return nil, fmt.Errorf("batch size must be positive")
+		}
+		m.batchSize = size
+	}
+	target, _ := opts["target_version"].(int)
+
+	pending, err := sorted(migrations)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.readProgress(ctx); err != nil {
+		return nil, err
+	}
+	result := &Result{
+		StartVersion: m.progress.Version,
+		Version:      m.progress.Version,
+		Migrations:   []*MigrationResult{},
+	}
+	for _, mig := range pending {
+		if mig.Version <= m.progress.Version {
+			continue
+		}
+		if target > 0 && mig.Version > target {
+			break
+		}
+		cp := m.progress.Current
+		if cp != nil && cp.Version != mig.Version {
+			return result, fmt.Errorf("migration %d is in progress, but migration %d is next", cp.Version, mig.Version)
+		}
+		if cp == nil {
+			cp = &checkpoint{Version: mig.Version}
+			m.progress.Current = cp
+		}
+		res, err := m.apply(ctx, mig, cp)
+		if res != nil {
+			result.Migrations = append(result.Migrations, res)
+		}
+		if err != nil {
+			return result, err
+		}
+		if res.Status == StatusIncomplete {
+			break
+		}
+		if m.dryRun {
+			// Later migrations are evaluated against the current documents,
+			// from the start.
+			m.progress.Current = nil
+			continue
+		}
+		m.progress.Version = mig.Version
+		m.progress.Applied = append(m.progress.Applied, applied{Version: mig.Version, Name: mig.Name})
+		m.progress.Current = nil
+		if err := m.saveProgress(ctx); err != nil {
+			return result, err
+		}
+		result.Version = mig.Version
+	}
+	return result, nil
+}
+
+func sorted(migrations []Migration) ([]Migration, error) {
+	pending := make([]Migration, len(migrations))
+	copy(pending, migrations)
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Version < pending[j].Version
+	})
+	for i, mig := range pending {
+		if err := mig.validate(); err != nil {
+			return nil, err
+		}
+		if i > 0 && pending[i-1].Version == mig.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", mig.Version)
+		}
+	}
+	return pending, nil
+}
+
+func (m *migrator) readProgress(ctx context.Context) error {
+	m.progress = &progress{}
+	err := m.db.Get(ctx, m.progressID).ScanDoc(m.progress)
+	if kivik.HTTPStatus(err) == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (m *migrator) saveProgress(ctx context.Context) error {
+	if m.dryRun {
+		return nil
+	}
+	rev, err := m.db.Put(ctx, m.progressID, m.progress)
+	if err != nil {
+		return err
+	}
+	m.progress.Rev = rev
+	return nil
+}
+
+func (m *migrator) apply(ctx context.Context, mig Migration, cp *checkpoint) (*MigrationResult, error) {
+	res := &MigrationResult{
+		Version: mig.Version,
+		Name:    mig.Name,
+		Status:  StatusApplied,
+	}
+	if m.dryRun {
+		res.Status = StatusPending
+	}
+	// Documents which failed in a previous run are retried first.
+	if retry := cp.Failed; len(retry) > 0 {
+		cp.Failed = nil
+		docs, err := m.find(ctx, mig.Selector, map[string]interface{}{"$in": retry}, len(retry))
+		if err != nil {
+			return res, err
+		}
+		if err := m.process(ctx, mig, docs, res, cp); err != nil {
+			return res, err
+		}
+		if err := m.saveProgress(ctx); err != nil {
+			return res, err
+		}
+	}
+	for {
+		docs, err := m.find(ctx, mig.Selector, map[string]interface{}{"$gt": cp.LastID}, m.batchSize)
+		if err != nil {
+			return res, err
+		}
+		if len(docs) == 0 {
+			break
+		}
+		if err := m.process(ctx, mig, docs, res, cp); err != nil {
+			return res, err
+		}
+		cp.LastID = docs[len(docs)-1].ID
+		if err := m.saveProgress(ctx); err != nil {
+			return res, err
+		}
+		if len(docs) < m.batchSize {
+			break
+		}
+	}
+	if len(cp.Failed) > 0 {
+		res.Status = StatusIncomplete
+	}
+	return res, nil
+}
+
+// find returns up to limit documents matching selector, whose IDs also match
+// the idCond condition, ordered by ID.
+func (m *migrator) find(ctx context.Context, selector, idCond map[string]interface{}, limit int) ([]*xkivik.Document, error) {
+	var sel interface{} = map[string]interface{}{"_id": idCond}
+	if len(selector) > 0 {
+		sel = map[string]interface{}{"$and": []interface{}{selector, sel}}
+	}
+	rs := m.db.Find(ctx, map[string]interface{}{
+		"selector": sel,
+		"sort":     []interface{}{map[string]string{"_id": "asc"}},
+		"limit":    limit,
+	})
+	defer rs.Close() // nolint:errcheck
+	var docs []*xkivik.Document
+	for rs.Next() {
+		doc := &xkivik.Document{}
+		if err := rs.ScanDoc(doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rs.Err()
+}
+
+// process applies the migration to docs, and saves those changed.
+func (m *migrator) process(ctx context.Context, mig Migration, docs []*xkivik.Document, res *MigrationResult, cp *checkpoint) error {
+	for attempt := 1; len(docs) > 0; attempt++ {
+		var changed []*xkivik.Document
+		for _, doc := range docs {
+			if strings.HasPrefix(doc.ID, "_design/") {
+				continue
+			}
+			if attempt == 1 {
+				res.Matched++
+			}
+			ok, err := mig.Func(ctx, doc)
+			if err != nil {
+				return fmt.Errorf("migration %d: %s: %w", mig.Version, doc.ID, err)
+			}
+			if !ok {
+				continue
+			}
+			if attempt == 1 {
+				res.Changed++
+			}
+			changed = append(changed, doc)
+		}
+		if m.dryRun {
+			for _, doc := range changed {
+				res.Changes = append(res.Changes, doc.ID)
+			}
+			return nil
+		}
+		conflicts, err := m.save(ctx, changed, res, cp, attempt == maxAttempts)
+		if err != nil || len(conflicts) == 0 {
+			return err
+		}
+		// Conflicting documents are read again, and the migration re-applied
+		// to the current revision.
+		docs, err = m.find(ctx, mig.Selector, map[string]interface{}{"$in": conflicts}, len(conflicts))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save saves docs, recording the results in res. It returns the IDs of
+// documents which failed with an update conflict, unless final is true, in
+// which case conflicts are recorded as failures.
+func (m *migrator) save(ctx context.Context, docs []*xkivik.Document, res *MigrationResult, cp *checkpoint, final bool) ([]string, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+	bulk := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		bulk[i] = doc
+	}
+	results, err := m.db.BulkDocs(ctx, bulk)
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []string
+	for _, result := range results {
+		switch {
+		case result.Error == nil:
+			res.Updated++
+		case kivik.HTTPStatus(result.Error) == http.StatusConflict && !final:
+			conflicts = append(conflicts, result.ID)
+		default:
+			res.Failed = append(res.Failed, &Failure{ID: result.ID, Err: result.Error})
+			cp.Failed = append(cp.Failed, result.ID)
+		}
+	}
+	return conflicts, nil
+}
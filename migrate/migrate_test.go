@@ -0,0 +1,486 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package migrate
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/kivik/v4"
+	_ "github.com/go-kivik/kivik/v4/couchdb" // CouchDB driver
+
+	"github.com/go-kivik/xkivik/v4"
+)
+
+// fakeDB is an in-memory database, which supports just enough of the _find,
+// _bulk_docs and _local document APIs to run migrations.
+type fakeDB struct {
+	mu    sync.Mutex
+	docs  map[string]map[string]interface{}
+	local map[string]map[string]interface{}
+	// conflicts lists documents whose next update fails with a conflict,
+	// after their revision is bumped by a concurrent update.
+	conflicts map[string]bool
+	// forbidden lists documents whose updates are rejected.
+	forbidden map[string]bool
+	// finds counts the _find requests.
+	finds int
+}
+
+func newFakeDB(docs ...string) *fakeDB {
+	db := &fakeDB{
+		docs:      map[string]map[string]interface{}{},
+		local:     map[string]map[string]interface{}{},
+		conflicts: map[string]bool{},
+		forbidden: map[string]bool{},
+	}
+	for _, doc := range docs {
+		var d map[string]interface{}
+		if err := json.Unmarshal([]byte(doc), &d); err != nil {
+			panic(err)
+		}
+		d["_rev"] = "1-a"
+		db.docs[d["_id"].(string)] = d
+	}
+	return db
+}
+
+func (db *fakeDB) server(t *testing.T) *kivik.DB {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/db/_local/"):
+			db.serveLocal(t, w, r)
+		case r.URL.Path == "/db/_find":
+			db.serveFind(t, w, r)
+		case r.URL.Path == "/db/_bulk_docs":
+			db.serveBulkDocs(t, w, r)
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	client, err := kivik.New("couch", s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.DB("db")
+}
+
+func (db *fakeDB) serveLocal(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/db/")
+	switch r.Method {
+	case http.MethodGet:
+		doc, ok := db.local[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"error":"not_found","reason":"missing"}`)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(doc)
+	case http.MethodPut:
+		var doc map[string]interface{}
+		if err := decodeBody(r, &doc); err != nil {
+			t.Fatal(err)
+		}
+		doc["_id"] = id
+		doc["_rev"] = "0-1"
+		db.local[id] = doc
+		w.Header().Set("ETag", `"0-1"`)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"ok":true,"id":%q,"rev":"0-1"}`, id)
+	}
+}
+
+func (db *fakeDB) serveFind(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	db.finds++
+	var query struct {
+		Selector map[string]interface{} `json:"selector"`
+		Limit    int                    `json:"limit"`
+	}
+	if err := decodeBody(r, &query); err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, 0, len(db.docs))
+	for id := range db.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	docs := []string{}
+	for _, id := range ids {
+		if len(docs) == query.Limit {
+			break
+		}
+		if matches(db.docs[id], query.Selector) {
+			doc, _ := json.Marshal(db.docs[id])
+			docs = append(docs, string(doc))
+		}
+	}
+	_, _ = fmt.Fprintf(w, `{"docs":[%s]}`, strings.Join(docs, ","))
+}
+
+// matches evaluates the subset of Mango selectors used by the tests.
+func matches(doc, selector map[string]interface{}) bool {
+	for field, cond := range selector {
+		if field == "$and" {
+			for _, sel := range cond.([]interface{}) {
+				if !matches(doc, sel.(map[string]interface{})) {
+					return false
+				}
+			}
+			continue
+		}
+		ops, ok := cond.(map[string]interface{})
+		if !ok {
+			if doc[field] != cond {
+				return false
+			}
+			continue
+		}
+		value, _ := doc[field].(string)
+		for op, arg := range ops {
+			switch op {
+			case "$gt":
+				if value <= arg.(string) {
+					return false
+				}
+			case "$in":
+				found := false
+				for _, v := range arg.([]interface{}) {
+					found = found || v == value
+				}
+				if !found {
+					return false
+				}
+			default:
+				panic("unsupported operator " + op)
+			}
+		}
+	}
+	return true
+}
+
+func (db *fakeDB) serveBulkDocs(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Docs []map[string]interface{} `json:"docs"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		t.Fatal(err)
+	}
+	results := make([]string, 0, len(req.Docs))
+	for _, doc := range req.Docs {
+		id := doc["_id"].(string)
+		current := db.docs[id]
+		switch {
+		case db.forbidden[id]:
+			results = append(results, fmt.Sprintf(`{"id":%q,"error":"forbidden","reason":"Read only."}`, id))
+		case db.conflicts[id]:
+			delete(db.conflicts, id)
+			current["_rev"] = "2-b"
+			results = append(results, fmt.Sprintf(`{"id":%q,"error":"conflict","reason":"Document update conflict."}`, id))
+		case current["_rev"] != doc["_rev"]:
+			results = append(results, fmt.Sprintf(`{"id":%q,"error":"conflict","reason":"Document update conflict."}`, id))
+		default:
+			doc["_rev"] = fmt.Sprintf("%s+", doc["_rev"])
+			db.docs[id] = doc
+			results = append(results, fmt.Sprintf(`{"ok":true,"id":%q,"rev":%q}`, id, doc["_rev"]))
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+	_, _ = fmt.Fprintf(w, "[%s]", strings.Join(results, ","))
+}
+
+// decodeBody decodes the JSON request body into v.
+func decodeBody(r *http.Request, v interface{}) error {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gun, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+		body = gun
+	}
+	return json.NewDecoder(body).Decode(v)
+}
+
+// setField returns a migration function which sets field to value.
+func setField(field string, value interface{}) Func {
+	return func(_ context.Context, doc *xkivik.Document) (bool, error) {
+		if doc.Data[field] == value {
+			return false, nil
+		}
+		doc.Data[field] = value
+		return true, nil
+	}
+}
+
+var testDocs = []string{
+	`{"_id":"_design/foo","language":"javascript"}`,
+	`{"_id":"a","type":"user","name":"Alice"}`,
+	`{"_id":"b","type":"user","name":"Bob"}`,
+	`{"_id":"c","type":"order"}`,
+	`{"_id":"d","type":"user","name":"Dave"}`,
+	`{"_id":"e","type":"user","name":"Eve","active":true}`,
+}
+
+var testMigrations = []Migration{
+	{
+		Version:  2,
+		Name:     "user names",
+		Selector: map[string]interface{}{"type": "user"},
+		Func: func(_ context.Context, doc *xkivik.Document) (bool, error) {
+			doc.Data["name"] = strings.ToUpper(doc.Data["name"].(string))
+			return true, nil
+		},
+	},
+	{
+		Version: 1,
+		Name:    "activate",
+		Func:    setField("active", true),
+	},
+}
+
+func TestRun(t *testing.T) {
+	type tt struct {
+		db      *fakeDB
+		migs    []Migration
+		options []kivik.Option
+		want    *Result
+		err     string
+		check   func(*testing.T, *fakeDB)
+	}
+
+	tests := testy.NewTable()
+	tests.Add("invalid version", tt{
+		db:   newFakeDB(),
+		migs: []Migration{{Name: "foo", Func: setField("a", 1)}},
+		err:  `migration "foo": version must be positive`,
+	})
+	tests.Add("duplicate version", tt{
+		db:   newFakeDB(),
+		migs: []Migration{testMigrations[1], testMigrations[1]},
+		err:  "duplicate migration version 1",
+	})
+	tests.Add("invalid batch size", tt{
+		db:      newFakeDB(),
+		migs:    testMigrations,
+		options: []kivik.Option{kivik.Param("batch_size", 0)},
+		err:     "batch size must be positive",
+	})
+	tests.Add("apply all", tt{
+		db:      newFakeDB(testDocs...),
+		migs:    testMigrations,
+		options: []kivik.Option{kivik.Param("batch_size", 2)},
+		want: &Result{
+			Version: 2,
+			Migrations: []*MigrationResult{
+				{Version: 1, Name: "activate", Status: StatusApplied, Matched: 5, Changed: 4, Updated: 4},
+				{Version: 2, Name: "user names", Status: StatusApplied, Matched: 4, Changed: 4, Updated: 4},
+			},
+		},
+		check: func(t *testing.T, db *fakeDB) {
+			if got := db.docs["a"]["name"]; got != "ALICE" {
+				t.Errorf("Unexpected name: %v", got)
+			}
+			if _, ok := db.docs["_design/foo"]["active"]; ok {
+				t.Error("Design document was migrated")
+			}
+			progress, _ := json.Marshal(db.local[DefaultProgressID])
+			want := `{"_id":"_local/kivik-migrate","_rev":"0-1","applied":[{"name":"activate","version":1},{"name":"user names","version":2}],"version":2}`
+			if string(progress) != want {
+				t.Errorf("Unexpected progress:\n%s", progress)
+			}
+		},
+	})
+	tests.Add("already applied", func() interface{} {
+		db := newFakeDB(testDocs...)
+		db.local[DefaultProgressID] = map[string]interface{}{"_rev": "0-1", "version": 2}
+		return tt{
+			db:   db,
+			migs: testMigrations,
+			want: &Result{StartVersion: 2, Version: 2, Migrations: []*MigrationResult{}},
+			check: func(t *testing.T, db *fakeDB) {
+				if db.finds != 0 {
+					t.Errorf("Unexpected %d _find requests", db.finds)
+				}
+			},
+		}
+	})
+	tests.Add("target version", tt{
+		db:      newFakeDB(testDocs...),
+		migs:    testMigrations,
+		options: []kivik.Option{kivik.Param("target_version", 1)},
+		want: &Result{
+			Version: 1,
+			Migrations: []*MigrationResult{
+				{Version: 1, Name: "activate", Status: StatusApplied, Matched: 5, Changed: 4, Updated: 4},
+			},
+		},
+	})
+	tests.Add("dry run", tt{
+		db:      newFakeDB(testDocs...),
+		migs:    testMigrations,
+		options: []kivik.Option{kivik.Param("dry_run", true)},
+		want: &Result{
+			Migrations: []*MigrationResult{
+				{Version: 1, Name: "activate", Status: StatusPending, Matched: 5, Changed: 4, Changes: []string{"a", "b", "c", "d"}},
+				{Version: 2, Name: "user names", Status: StatusPending, Matched: 4, Changed: 4, Changes: []string{"a", "b", "d", "e"}},
+			},
+		},
+		check: func(t *testing.T, db *fakeDB) {
+			if len(db.local) != 0 {
+				t.Error("Progress was saved in a dry run")
+			}
+			if _, ok := db.docs["a"]["active"]; ok {
+				t.Error("Document was saved in a dry run")
+			}
+		},
+	})
+	tests.Add("conflict retried", func() interface{} {
+		db := newFakeDB(testDocs...)
+		db.conflicts["b"] = true
+		return tt{
+			db:      db,
+			migs:    testMigrations,
+			options: []kivik.Option{kivik.Param("target_version", 1)},
+			want: &Result{
+				Version: 1,
+				Migrations: []*MigrationResult{
+					{Version: 1, Name: "activate", Status: StatusApplied, Matched: 5, Changed: 4, Updated: 4},
+				},
+			},
+		}
+	})
+	tests.Add("failure", func() interface{} {
+		db := newFakeDB(testDocs...)
+		db.forbidden["b"] = true
+		return tt{
+			db:   db,
+			migs: testMigrations,
+			want: &Result{
+				Migrations: []*MigrationResult{
+					{
+						Version: 1, Name: "activate", Status: StatusIncomplete, Matched: 5, Changed: 4, Updated: 3,
+						Failed: []*Failure{{ID: "b", Err: errors.New("Read only.")}},
+					},
+				},
+			},
+			check: func(t *testing.T, db *fakeDB) {
+				progress, _ := json.Marshal(db.local[DefaultProgressID])
+				want := `{"_id":"_local/kivik-migrate","_rev":"0-1","current":{"failed":["b"],"last_id":"e","version":1},"version":0}`
+				if string(progress) != want {
+					t.Errorf("Unexpected progress:\n%s", progress)
+				}
+			},
+		}
+	})
+	tests.Add("resume", func() interface{} {
+		db := newFakeDB(testDocs...)
+		db.local[DefaultProgressID] = map[string]interface{}{
+			"_rev":    "0-1",
+			"version": 0,
+			"current": map[string]interface{}{"version": 1, "last_id": "c", "failed": []string{"a"}},
+		}
+		return tt{
+			db:      db,
+			migs:    testMigrations,
+			options: []kivik.Option{kivik.Param("target_version", 1)},
+			want: &Result{
+				Version: 1,
+				Migrations: []*MigrationResult{
+					{Version: 1, Name: "activate", Status: StatusApplied, Matched: 3, Changed: 2, Updated: 2},
+				},
+			},
+			check: func(t *testing.T, db *fakeDB) {
+				for id, want := range map[string]bool{"a": true, "b": false, "d": true} {
+					if _, got := db.docs[id]["active"]; got != want {
+						t.Errorf("Unexpected migration of %s: %v", id, got)
+					}
+				}
+			},
+		}
+	})
+	tests.Add("in progress migration missing", func() interface{} {
+		db := newFakeDB(testDocs...)
+		db.local[DefaultProgressID] = map[string]interface{}{
+			"_rev":    "0-1",
+			"current": map[string]interface{}{"version": 3, "last_id": "c"},
+		}
+		return tt{
+			db:   db,
+			migs: testMigrations,
+			want: &Result{Migrations: []*MigrationResult{}},
+			err:  "migration 3 is in progress, but migration 1 is next",
+		}
+	})
+	tests.Add("function error", tt{
+		db: newFakeDB(testDocs...),
+		migs: []Migration{{
+			Version: 1,
+			Func: func(context.Context, *xkivik.Document) (bool, error) {
+				return false, fmt.Errorf("boom")
+			},
+		}},
+		want: &Result{Migrations: []*MigrationResult{
+			{Version: 1, Status: StatusApplied, Matched: 1},
+		}},
+		err: "migration 1: a: boom",
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		result, err := Run(context.Background(), tt.db.server(t), tt.migs, tt.options...)
+		if !testy.ErrorMatches(tt.err, err) {
+			t.Errorf("Unexpected error: %s", err)
+		}
+		if d := testy.DiffAsJSON(tt.want, result); d != nil {
+			t.Error(d)
+		}
+		if tt.check != nil {
+			tt.check(t, tt.db)
+		}
+	})
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		registry = map[int]Migration{}
+	}()
+	Register(testMigrations[0])
+	Register(testMigrations[1])
+	got := Registered()
+	if len(got) != 2 || got[0].Version != 1 || got[1].Version != 2 {
+		t.Errorf("Unexpected migrations: %v", got)
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected a panic for a duplicate version")
+		}
+	}()
+	Register(testMigrations[0])
+}
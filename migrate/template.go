@@ -0,0 +1,101 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"text/template"
+
+	"github.com/go-kivik/xkivik/v4"
+)
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		p, err := json.Marshal(v)
+		return string(p), err
+	},
+}
+
+// Template returns a Func which executes a text/template to migrate each
+// document. The template is executed with the document, including its _id and
+// _rev, as its data. Its output, if not blank, must be a JSON object, which is
+// applied to the document as a JSON merge patch (RFC 7386): null values remove
+// fields, objects are merged, and any other value replaces the field. The
+// special fields _id, _rev and _attachments may not be changed.
+//
+// The json function renders its argument as JSON, to embed existing values in
+// the output.
+func Template(name, text string) (Func, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(_ context.Context, doc *xkivik.Document) (bool, error) {
+		data := make(map[string]interface{}, len(doc.Data)+2) // nolint:gomnd
+		for k, v := range doc.Data {
+			data[k] = v
+		}
+		data["_id"] = doc.ID
+		data["_rev"] = doc.Rev
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return false, err
+		}
+		if len(bytes.TrimSpace(buf.Bytes())) == 0 {
+			return false, nil
+		}
+		var patch map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &patch); err != nil {
+			return false, fmt.Errorf("template output is not a JSON object: %w", err)
+		}
+		for _, field := range []string{"_id", "_rev", "_attachments"} {
+			if _, ok := patch[field]; ok {
+				return false, fmt.Errorf("template may not change %s", field)
+			}
+		}
+		if doc.Data == nil {
+			doc.Data = map[string]interface{}{}
+		}
+		updated := mergePatch(doc.Data, patch)
+		if reflect.DeepEqual(updated, doc.Data) {
+			return false, nil
+		}
+		doc.Data = updated
+		return true, nil
+	}, nil
+}
+
+// mergePatch returns a copy of target, with patch applied according to RFC
+// 7386.
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(target)+len(patch))
+	for k, v := range target {
+		result[k] = v
+	}
+	for k, v := range patch {
+		switch pv := v.(type) {
+		case nil:
+			delete(result, k)
+		case map[string]interface{}:
+			tv, _ := result[k].(map[string]interface{})
+			result[k] = mergePatch(tv, pv)
+		default:
+			result[k] = v
+		}
+	}
+	return result
+}
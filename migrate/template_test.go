@@ -0,0 +1,107 @@
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package migrate
+
+import (
+	"context"
+	"testing"
+
+	"gitlab.com/flimzy/testy"
+
+	"github.com/go-kivik/xkivik/v4"
+)
+
+func TestTemplate(t *testing.T) {
+	type tt struct {
+		tmpl    string
+		doc     *xkivik.Document
+		changed bool
+		want    *xkivik.Document
+		err     string
+	}
+
+	doc := func() *xkivik.Document {
+		return &xkivik.Document{
+			ID:  "foo",
+			Rev: "1-xxx",
+			Data: map[string]interface{}{
+				"name":    "Bob Smith",
+				"address": map[string]interface{}{"city": "Oslo", "zip": "0150"},
+			},
+		}
+	}
+
+	tests := testy.NewTable()
+	tests.Add("parse error", tt{
+		tmpl: "{{ .name ",
+		err:  `template: test:1: unclosed action`,
+	})
+	tests.Add("blank output", tt{
+		tmpl: "  \n",
+		doc:  doc(),
+		want: doc(),
+	})
+	tests.Add("invalid output", tt{
+		tmpl: "{{ .name }}",
+		doc:  doc(),
+		want: doc(),
+		err:  "template output is not a JSON object: invalid character 'B' looking for beginning of value",
+	})
+	tests.Add("change id", tt{
+		tmpl: `{"_id":"bar"}`,
+		doc:  doc(),
+		want: doc(),
+		err:  "template may not change _id",
+	})
+	tests.Add("unchanged", tt{
+		tmpl: `{"name":{{ json .name }}}`,
+		doc:  doc(),
+		want: doc(),
+	})
+	tests.Add("merge", tt{
+		tmpl:    `{"full_name":{{ json .name }},"name":null,"address":{"zip":null,"country":"NO"},"ref":{{ json ._id }}}`,
+		doc:     doc(),
+		changed: true,
+		want: &xkivik.Document{
+			ID:  "foo",
+			Rev: "1-xxx",
+			Data: map[string]interface{}{
+				"full_name": "Bob Smith",
+				"address":   map[string]interface{}{"city": "Oslo", "country": "NO"},
+				"ref":       "foo",
+			},
+		},
+	})
+	tests.Add("conditional", tt{
+		tmpl: `{{ if .missing }}{"found":true}{{ end }}`,
+		doc:  doc(),
+		want: doc(),
+	})
+
+	tests.Run(t, func(t *testing.T, tt tt) {
+		fn, err := Template("test", tt.tmpl)
+		if err == nil {
+			var changed bool
+			changed, err = fn(context.Background(), tt.doc)
+			if changed != tt.changed {
+				t.Errorf("Unexpected changed: %v", changed)
+			}
+		}
+		if !testy.ErrorMatches(tt.err, err) {
+			t.Errorf("Unexpected error: %s", err)
+		}
+		if d := testy.DiffInterface(tt.want, tt.doc); d != nil {
+			t.Error(d)
+		}
+	})
+}